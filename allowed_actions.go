@@ -0,0 +1,132 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// AllowedActionsResult holds the actions a principal may perform on a
+// resource, see AllowedActions.
+type AllowedActionsResult struct {
+	// Allowed are the allowed actions, in catalog order.
+	Allowed []ActionID `json:"allowed"`
+	// Deciders maps each action decided by a statement, allowed or denied, to
+	// the decider of its Response.
+	Deciders map[ActionID]string `json:"deciders"`
+}
+
+// IsAllowed reports whether action is among the allowed actions.
+func (r AllowedActionsResult) IsAllowed(action ActionID) bool {
+	return slices.Contains(r.Allowed, action)
+}
+
+// AllowedActions evaluates every action of catalog, such as
+// actions.AllActions() or a part of it, for principal on resource in context
+// c. Evaluators created by NewEvaluator and NewExpandingEvaluator list the
+// principal's statements once for all actions; other evaluators evaluate
+// each action in turn. The decisions only inform, for example which buttons
+// to render, so they are not passed to decision loggers.
+func AllowedActions(evaluator Evaluator, principal Principal, resource Resource, c Context, catalog []Action) (AllowedActionsResult, error) {
+	actions := make([]ActionID, len(catalog))
+	for i, action := range catalog {
+		actions[i] = action.ID
+	}
+	req := Request{Principal: principal, Resource: resource, Context: c}
+	responses, err := evaluateActions(context.Background(), evaluator, req, actions)
+	if err != nil {
+		return AllowedActionsResult{}, err
+	}
+
+	result := AllowedActionsResult{Deciders: make(map[ActionID]string)}
+	for i, resp := range responses {
+		if resp.Allowed() {
+			result.Allowed = append(result.Allowed, actions[i])
+		}
+		if resp.Decider != nil {
+			result.Deciders[actions[i]] = *resp.Decider
+		}
+	}
+	return result, nil
+}
+
+// actionsEvaluator is implemented by evaluators that decide several actions
+// for the same principal and resource at once.
+type actionsEvaluator interface {
+	evaluateActions(ctx context.Context, req Request, actions []ActionID) ([]Response, error)
+}
+
+// evaluateActions returns the responses to req for each of actions.
+func evaluateActions(ctx context.Context, e Evaluator, req Request, actions []ActionID) ([]Response, error) {
+	if ae, ok := e.(actionsEvaluator); ok {
+		return ae.evaluateActions(ctx, req, actions)
+	}
+	responses := make([]Response, len(actions))
+	for i, action := range actions {
+		req.Action = action
+		resp, err := evaluateWithContext(ctx, e, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate %s: %w", action, err)
+		}
+		responses[i] = resp
+	}
+	return responses, nil
+}
+
+func (e *evaluator) evaluateActions(ctx context.Context, req Request, actions []ActionID) ([]Response, error) {
+	if !e.asOf.IsZero() && req.Context.Request.At.IsZero() {
+		req.Context.Request.At = e.asOf
+	}
+	statements, err := e.listStatements(ctx, req.Principal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statements: %w", err)
+	}
+	responses := make([]Response, len(actions))
+	for i, action := range actions {
+		req.Action = action
+		resp, _, err := e.decide(ctx, statements, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate %s: %w", action, err)
+		}
+		responses[i] = resp
+	}
+	return responses, nil
+}
+
+func (e *ExpandingEvaluator) evaluateActions(ctx context.Context, req Request, actions []ActionID) ([]Response, error) {
+	responses := make([]Response, len(actions))
+	principals, err := e.resolvePrincipals(ctx, req.Principal)
+	if err != nil {
+		for i := range responses {
+			responses[i] = Response{
+				Effect:  EffectDeny,
+				Message: "failed to resolve principals: " + err.Error(),
+			}
+		}
+		return responses, nil
+	}
+
+	// byPrincipal[j][i] is the response for principals[j] and actions[i].
+	byPrincipal := make([][]Response, len(principals))
+	for j, principal := range principals {
+		expandedReq := req
+		expandedReq.Principal = principal
+		principalResponses, err := evaluateActions(ctx, e.baseEvaluator, expandedReq, actions)
+		if err != nil {
+			for i := range responses {
+				responses[i] = principalEvaluationFailed(principal, err)
+			}
+			return responses, nil
+		}
+		byPrincipal[j] = principalResponses
+	}
+
+	actionResponses := make([]Response, len(principals))
+	for i := range actions {
+		for j := range principals {
+			actionResponses[j] = byPrincipal[j][i]
+		}
+		responses[i], _ = combineExpandedResponses(principals, actionResponses)
+	}
+	return responses, nil
+}
@@ -0,0 +1,86 @@
+package authorization
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var allowedActionsTestCatalog = []Action{
+	NewAction("iam:GetUser", "", ""),
+	NewAction("iam:UpdateUser", "", ""),
+	NewAction("iam:DeleteUser", "", ""),
+	NewAction("iam:SignIn", "", ""),
+}
+
+// countingStorage counts the statement listings of the wrapped storage.
+type countingStorage struct {
+	Storage
+	lists int
+}
+
+func (s *countingStorage) ListStatementsByPrincipal(principal Principal) ([]Statement, error) {
+	s.lists++
+	return s.Storage.ListStatementsByPrincipal(principal)
+}
+
+var allowedActionsTestStatements = []Statement{
+	{ID: "admins", Effect: EffectAllow, Principals: []Principal{"roles/admin"}, Actions: []ActionID{"iam:*User"}, Resources: []Resource{"users/*"}},
+	{ID: "self", Effect: EffectAllow, Principals: []Principal{"users/alice"}, Actions: []ActionID{"iam:GetUser"}, Resources: []Resource{"users/alice"}},
+	{ID: "protect-root", Effect: EffectDeny, Principals: []Principal{"roles/admin"}, Actions: []ActionID{"iam:DeleteUser"}, Resources: []Resource{"users/root"}},
+	{ID: "office", Effect: EffectAllow, Principals: []Principal{"users/alice"}, Actions: []ActionID{"iam:SignIn"}, Resources: []Resource{"*"},
+		Conditions: []Condition{{Name: "office", Expression: `context.Request.IP startsWith "10."`}}},
+}
+
+func TestAllowedActions(t *testing.T) {
+	storage := &countingStorage{Storage: newTestStorage(t, allowedActionsTestStatements...)}
+	evaluator := NewEvaluator(storage)
+
+	var c Context
+	c.Request.IP = "10.0.0.1"
+	result, err := AllowedActions(evaluator, "users/alice", "users/alice", c, allowedActionsTestCatalog)
+	require.NoError(t, err)
+	assert.Equal(t, []ActionID{"iam:GetUser", "iam:SignIn"}, result.Allowed)
+	assert.Equal(t, map[ActionID]string{"iam:GetUser": "self", "iam:SignIn": "office"}, result.Deciders)
+	assert.True(t, result.IsAllowed("iam:SignIn"))
+	assert.False(t, result.IsAllowed("iam:DeleteUser"))
+	assert.Equal(t, 1, storage.lists, "statements are listed once for all actions")
+
+	result, err = AllowedActions(evaluator, "users/alice", "users/alice", Context{}, allowedActionsTestCatalog)
+	require.NoError(t, err)
+	assert.Equal(t, []ActionID{"iam:GetUser"}, result.Allowed, "conditions see the context")
+}
+
+func TestAllowedActions_ExpandingEvaluator(t *testing.T) {
+	storage := &countingStorage{Storage: newTestStorage(t, allowedActionsTestStatements...)}
+	resolver := NewInMemoryPrincipalResolver()
+	resolver.AddRoleMapping("users/alice", []Principal{"roles/admin"})
+	evaluator := NewExpandingEvaluator(NewEvaluator(storage), resolver)
+
+	result, err := AllowedActions(evaluator, "users/alice", "users/root", Context{}, allowedActionsTestCatalog)
+	require.NoError(t, err)
+	assert.Equal(t, []ActionID{"iam:GetUser", "iam:UpdateUser"}, result.Allowed)
+	assert.Equal(t, "principal_expansion:roles/admin", result.Deciders["iam:DeleteUser"], "denied by the role")
+	assert.Equal(t, 2, storage.lists, "statements are listed once per resolved principal")
+
+	// The answers agree with evaluating each action.
+	for _, action := range allowedActionsTestCatalog {
+		resp, err := evaluator.Evaluate(Request{Principal: "users/alice", Action: action.ID, Resource: "users/root"})
+		require.NoError(t, err)
+		assert.Equal(t, resp.Allowed(), result.IsAllowed(action.ID), action.ID)
+	}
+}
+
+func TestAllowedActions_OtherEvaluators(t *testing.T) {
+	evaluator := evaluatorFunc(func(req Request) (Response, error) {
+		if req.Action == "iam:GetUser" {
+			return Response{Effect: EffectAllow, Decider: stringPtr("stub")}, nil
+		}
+		return Response{Effect: EffectDeny}, nil
+	})
+	result, err := AllowedActions(evaluator, "users/alice", "users/bob", Context{}, allowedActionsTestCatalog)
+	require.NoError(t, err)
+	assert.Equal(t, []ActionID{"iam:GetUser"}, result.Allowed)
+	assert.Equal(t, map[ActionID]string{"iam:GetUser": "stub"}, result.Deciders)
+}
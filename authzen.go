@@ -0,0 +1,270 @@
+package authorization
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// AuthZENSubject is the subject of an OpenID AuthZEN evaluation. Principals
+// map to subjects by their collection: "users/42" is the subject of type
+// "user" and ID "42", and likewise for roles and services. Principals of
+// other collections keep the collection as type, and principals without a
+// collection have no type.
+type AuthZENSubject struct {
+	Type       string         `json:"type"`
+	ID         string         `json:"id"`
+	Properties map[string]any `json:"properties,omitempty"`
+}
+
+// AuthZENAction is the action of an OpenID AuthZEN evaluation, named by the
+// ActionID.
+type AuthZENAction struct {
+	Name       string         `json:"name"`
+	Properties map[string]any `json:"properties,omitempty"`
+}
+
+// AuthZENResource is the resource of an OpenID AuthZEN evaluation. The first
+// segment of a Resource is its type and the rest its ID, so "bets/1/legs/2"
+// is the resource of type "bets" and ID "1/legs/2".
+type AuthZENResource struct {
+	Type       string         `json:"type"`
+	ID         string         `json:"id"`
+	Properties map[string]any `json:"properties,omitempty"`
+}
+
+// AuthZENEvaluationRequest is the body of an OpenID AuthZEN access
+// evaluation. Its context carries Context.Request as "time" (RFC 3339), "ip"
+// and "user_agent".
+type AuthZENEvaluationRequest struct {
+	Subject  AuthZENSubject  `json:"subject"`
+	Action   AuthZENAction   `json:"action"`
+	Resource AuthZENResource `json:"resource"`
+	Context  map[string]any  `json:"context,omitempty"`
+}
+
+// AuthZENEvaluationResponse is the result of an OpenID AuthZEN access
+// evaluation. Its context carries the decision ID as "id", the message as
+// "reason_admin" and the deciding statement as "decider".
+type AuthZENEvaluationResponse struct {
+	Decision bool           `json:"decision"`
+	Context  map[string]any `json:"context,omitempty"`
+}
+
+// AuthZENEvaluation is one evaluation of an AuthZENEvaluationsRequest. Fields
+// left out are taken from the request.
+type AuthZENEvaluation struct {
+	Subject  *AuthZENSubject  `json:"subject,omitempty"`
+	Action   *AuthZENAction   `json:"action,omitempty"`
+	Resource *AuthZENResource `json:"resource,omitempty"`
+	Context  map[string]any   `json:"context,omitempty"`
+}
+
+// Evaluations semantics of an AuthZENEvaluationsRequest.
+const (
+	// AuthZENExecuteAll evaluates every evaluation. It is the default.
+	AuthZENExecuteAll = "execute_all"
+	// AuthZENDenyOnFirstDeny stops at the first evaluation denied.
+	AuthZENDenyOnFirstDeny = "deny_on_first_deny"
+	// AuthZENPermitOnFirstPermit stops at the first evaluation permitted.
+	AuthZENPermitOnFirstPermit = "permit_on_first_permit"
+)
+
+// AuthZENEvaluationsOptions are the options of an AuthZENEvaluationsRequest.
+type AuthZENEvaluationsOptions struct {
+	EvaluationsSemantic string `json:"evaluations_semantic,omitempty"`
+}
+
+// AuthZENEvaluationsRequest is the body of an OpenID AuthZEN access
+// evaluations (batch) request. The subject, action, resource and context
+// given at the top level are the defaults of every evaluation.
+type AuthZENEvaluationsRequest struct {
+	AuthZENEvaluation
+	Evaluations []AuthZENEvaluation        `json:"evaluations,omitempty"`
+	Options     *AuthZENEvaluationsOptions `json:"options,omitempty"`
+}
+
+// AuthZENEvaluationsResponse holds the results of an AuthZENEvaluationsRequest
+// in the order of its evaluations.
+type AuthZENEvaluationsResponse struct {
+	Evaluations []AuthZENEvaluationResponse `json:"evaluations"`
+}
+
+// authZENSubjectTypes maps subject types to principal collections.
+var authZENSubjectTypes = map[string]string{
+	"user":    "users",
+	"role":    "roles",
+	"service": "services",
+}
+
+// NewAuthZENEvaluationRequest maps req to an OpenID AuthZEN evaluation.
+func NewAuthZENEvaluationRequest(req Request) AuthZENEvaluationRequest {
+	subject := AuthZENSubject{ID: string(req.Principal)}
+	if collection, id, ok := strings.Cut(string(req.Principal), "/"); ok {
+		subject = AuthZENSubject{Type: collection, ID: id}
+		for typ, c := range authZENSubjectTypes {
+			if c == collection {
+				subject.Type = typ
+			}
+		}
+	}
+	resource := AuthZENResource{ID: string(req.Resource)}
+	if typ, id, ok := strings.Cut(string(req.Resource), "/"); ok {
+		resource = AuthZENResource{Type: typ, ID: id}
+	}
+
+	context := make(map[string]any)
+	if !req.Context.Request.At.IsZero() {
+		context["time"] = req.Context.Request.At.Format(time.RFC3339Nano)
+	}
+	if req.Context.Request.IP != "" {
+		context["ip"] = req.Context.Request.IP
+	}
+	if req.Context.Request.UserAgent != "" {
+		context["user_agent"] = req.Context.Request.UserAgent
+	}
+	if len(context) == 0 {
+		context = nil
+	}
+	return AuthZENEvaluationRequest{
+		Subject:  subject,
+		Action:   AuthZENAction{Name: string(req.Action)},
+		Resource: resource,
+		Context:  context,
+	}
+}
+
+// Request maps the evaluation to a Request. Context entries other than
+// "time", "ip" and "user_agent", and properties, are ignored.
+func (r AuthZENEvaluationRequest) Request() (Request, error) {
+	if r.Subject.ID == "" {
+		return Request{}, errors.New("subject.id is required")
+	}
+	if r.Action.Name == "" {
+		return Request{}, errors.New("action.name is required")
+	}
+	if r.Resource.ID == "" {
+		return Request{}, errors.New("resource.id is required")
+	}
+
+	req := Request{
+		Principal: Principal(r.Subject.ID),
+		Action:    ActionID(r.Action.Name),
+		Resource:  Resource(r.Resource.ID),
+	}
+	if r.Subject.Type != "" {
+		collection, ok := authZENSubjectTypes[r.Subject.Type]
+		if !ok {
+			collection = r.Subject.Type
+		}
+		req.Principal = Principal(collection + "/" + r.Subject.ID)
+	}
+	if r.Resource.Type != "" {
+		req.Resource = Resource(r.Resource.Type + "/" + r.Resource.ID)
+	}
+
+	if value, ok := r.Context["time"]; ok {
+		s, _ := value.(string)
+		at, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return Request{}, fmt.Errorf("context.time must be an RFC 3339 timestamp: %v", value)
+		}
+		req.Context.Request.At = at
+	}
+	req.Context.Request.IP, _ = r.Context["ip"].(string)
+	req.Context.Request.UserAgent, _ = r.Context["user_agent"].(string)
+	return req, nil
+}
+
+// NewAuthZENEvaluationResponse maps resp to an OpenID AuthZEN result.
+func NewAuthZENEvaluationResponse(resp Response) AuthZENEvaluationResponse {
+	context := make(map[string]any)
+	if resp.DecisionID != "" {
+		context["id"] = resp.DecisionID
+	}
+	if resp.Message != "" {
+		context["reason_admin"] = map[string]any{"en": resp.Message}
+	}
+	if resp.Decider != nil {
+		context["decider"] = *resp.Decider
+	}
+	if len(context) == 0 {
+		context = nil
+	}
+	return AuthZENEvaluationResponse{Decision: resp.Allowed(), Context: context}
+}
+
+// Response maps the result to a Response.
+func (r AuthZENEvaluationResponse) Response() Response {
+	resp := Response{Effect: EffectDeny}
+	if r.Decision {
+		resp.Effect = EffectAllow
+	}
+	resp.DecisionID, _ = r.Context["id"].(string)
+	if reason, ok := r.Context["reason_admin"].(map[string]any); ok {
+		resp.Message, _ = reason["en"].(string)
+	}
+	if decider, ok := r.Context["decider"].(string); ok {
+		resp.Decider = &decider
+	}
+	return resp
+}
+
+// merge returns e with the fields it leaves out taken from defaults.
+func (e AuthZENEvaluation) merge(defaults AuthZENEvaluation) AuthZENEvaluation {
+	if e.Subject == nil {
+		e.Subject = defaults.Subject
+	}
+	if e.Action == nil {
+		e.Action = defaults.Action
+	}
+	if e.Resource == nil {
+		e.Resource = defaults.Resource
+	}
+	if e.Context == nil {
+		e.Context = defaults.Context
+	}
+	return e
+}
+
+func (e AuthZENEvaluation) request() (Request, error) {
+	if e.Subject == nil || e.Action == nil || e.Resource == nil {
+		return Request{}, errors.New("subject, action and resource are required")
+	}
+	return AuthZENEvaluationRequest{
+		Subject:  *e.Subject,
+		Action:   *e.Action,
+		Resource: *e.Resource,
+		Context:  e.Context,
+	}.Request()
+}
+
+// authZENEvaluationPath is the path of the access evaluation endpoint.
+const authZENEvaluationPath = "/access/v1/evaluation"
+
+// authZENProtocol speaks the OpenID AuthZEN access evaluation API.
+type authZENProtocol struct{}
+
+func (authZENProtocol) encodeRequest(req Request) ([]byte, error) {
+	return json.Marshal(NewAuthZENEvaluationRequest(req))
+}
+
+func (authZENProtocol) decodeResponse(body io.Reader) (Response, error) {
+	var response AuthZENEvaluationResponse
+	if err := json.NewDecoder(body).Decode(&response); err != nil {
+		return Response{}, err
+	}
+	return response.Response(), nil
+}
+
+// NewAuthZENAuthorizer creates a RemoteAuthorizer calling the OpenID AuthZEN
+// access evaluation endpoint of the policy decision point at pdpURL. It
+// accepts the options of NewBetandbeatRemoteAuthorizer. With
+// WithResponseVerification the decision is taken from the signature, which
+// ResponseSigningMiddleware makes over the Response the result maps to.
+func NewAuthZENAuthorizer(pdpURL string, bearerTokenFn func() (string, error), opts ...RemoteAuthorizerOption) RemoteAuthorizer {
+	return newRemoteAuthorizer(strings.TrimRight(pdpURL, "/")+authZENEvaluationPath, bearerTokenFn, authZENProtocol{}, opts)
+}
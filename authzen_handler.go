@@ -0,0 +1,147 @@
+package authorization
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// authZENEvaluationsPath is the path of the access evaluations endpoint.
+	authZENEvaluationsPath = "/access/v1/evaluations"
+	authZENMaxBodyBytes    = 1 << 20
+	// authZENEvaluationFailed is the detail of failed evaluations, whose
+	// errors go to AuthZENHandlerConfig.OnError.
+	authZENEvaluationFailed = "evaluation failed"
+)
+
+// AuthZENHandlerConfig configures NewAuthZENHandler.
+type AuthZENHandlerConfig struct {
+	// OnError is called with the error when evaluating a request fails,
+	// which is answered with a generic "evaluation failed" detail.
+	OnError func(r *http.Request, err error)
+}
+
+type authZENHandler struct {
+	evaluator Evaluator
+	config    AuthZENHandlerConfig
+}
+
+// NewAuthZENHandler serves the OpenID AuthZEN access evaluation API over
+// evaluator: POST /access/v1/evaluation evaluates a single request and POST
+// /access/v1/evaluations a batch. The X-Request-ID of a request is echoed in
+// its response. Evaluator errors are not revealed to the caller.
+func NewAuthZENHandler(evaluator Evaluator, config AuthZENHandlerConfig) http.Handler {
+	h := &authZENHandler{evaluator: evaluator, config: config}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+authZENEvaluationPath, h.evaluation)
+	mux.HandleFunc("POST "+authZENEvaluationsPath, h.evaluations)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestID := r.Header.Get("X-Request-ID"); requestID != "" {
+			w.Header().Set("X-Request-ID", requestID)
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, authZENMaxBodyBytes)
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (h *authZENHandler) evaluation(w http.ResponseWriter, r *http.Request) {
+	var body AuthZENEvaluationRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeProblem(w, http.StatusBadRequest, "invalid evaluation request: "+err.Error())
+		return
+	}
+	req, err := body.Request()
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	resp, err := evaluateWithContext(r.Context(), h.evaluator, req)
+	if err != nil {
+		h.onError(r, req, err)
+		writeProblem(w, http.StatusInternalServerError, authZENEvaluationFailed)
+		return
+	}
+	writeJSON(w, NewAuthZENEvaluationResponse(resp))
+}
+
+func (h *authZENHandler) evaluations(w http.ResponseWriter, r *http.Request) {
+	var body AuthZENEvaluationsRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeProblem(w, http.StatusBadRequest, "invalid evaluations request: "+err.Error())
+		return
+	}
+	// Without evaluations, the request is a single evaluation.
+	if len(body.Evaluations) == 0 {
+		req, err := body.AuthZENEvaluation.request()
+		if err != nil {
+			writeProblem(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		resp, err := evaluateWithContext(r.Context(), h.evaluator, req)
+		if err != nil {
+			h.onError(r, req, err)
+			writeProblem(w, http.StatusInternalServerError, authZENEvaluationFailed)
+			return
+		}
+		writeJSON(w, NewAuthZENEvaluationResponse(resp))
+		return
+	}
+
+	semantic := AuthZENExecuteAll
+	if body.Options != nil && body.Options.EvaluationsSemantic != "" {
+		semantic = body.Options.EvaluationsSemantic
+	}
+	switch semantic {
+	case AuthZENExecuteAll, AuthZENDenyOnFirstDeny, AuthZENPermitOnFirstPermit:
+	default:
+		writeProblem(w, http.StatusBadRequest, fmt.Sprintf("unsupported evaluations_semantic %q", semantic))
+		return
+	}
+
+	results := make([]AuthZENEvaluationResponse, 0, len(body.Evaluations))
+	for _, evaluation := range body.Evaluations {
+		result := h.evaluate(r, evaluation.merge(body.AuthZENEvaluation))
+		results = append(results, result)
+		if semantic == AuthZENDenyOnFirstDeny && !result.Decision ||
+			semantic == AuthZENPermitOnFirstPermit && result.Decision {
+			break
+		}
+	}
+	writeJSON(w, AuthZENEvaluationsResponse{Evaluations: results})
+}
+
+// evaluate evaluates one evaluation of a batch. Errors deny it and are
+// reported in its context rather than failing the batch.
+func (h *authZENHandler) evaluate(r *http.Request, evaluation AuthZENEvaluation) AuthZENEvaluationResponse {
+	req, err := evaluation.request()
+	if err != nil {
+		return authZENError(http.StatusBadRequest, err.Error())
+	}
+	resp, err := evaluateWithContext(r.Context(), h.evaluator, req)
+	if err != nil {
+		h.onError(r, req, err)
+		return authZENError(http.StatusInternalServerError, authZENEvaluationFailed)
+	}
+	return NewAuthZENEvaluationResponse(resp)
+}
+
+func (h *authZENHandler) onError(r *http.Request, req Request, err error) {
+	if h.config.OnError != nil {
+		h.config.OnError(r, fmt.Errorf("failed to evaluate %s on %s: %w", req.Action, req.Resource, err))
+	}
+}
+
+func authZENError(status int, message string) AuthZENEvaluationResponse {
+	return AuthZENEvaluationResponse{
+		Decision: false,
+		Context: map[string]any{
+			"error": map[string]any{"status": status, "message": message},
+		},
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
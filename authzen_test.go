@@ -0,0 +1,250 @@
+package authorization
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAuthZENTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(NewAuthZENHandler(newAuthZENTestEvaluator(t), AuthZENHandlerConfig{}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newAuthZENTestEvaluator(t *testing.T) Evaluator {
+	t.Helper()
+	storage := NewInMemoryStorage()
+	require.NoError(t, storage.SaveStatement(Statement{
+		ID:         "readers",
+		Active:     true,
+		Effect:     EffectAllow,
+		Principals: []Principal{"users/alice"},
+		Actions:    []ActionID{"bets:read"},
+		Resources:  []Resource{"bets/*"},
+		Conditions: []Condition{{Name: "office", Expression: `context.Request.IP != "10.6.6.6"`}},
+	}))
+	return NewEvaluator(storage)
+}
+
+func postAuthZEN(t *testing.T, url string, body string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(url, "application/json", bytes.NewBufferString(body))
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestAuthZENMapping_RoundTrip(t *testing.T) {
+	req := Request{Principal: "users/alice", Action: "bets:read", Resource: "bets/1/legs/2"}
+	req.Context.Request.At = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	req.Context.Request.IP = "10.0.0.1"
+	req.Context.Request.UserAgent = "test"
+
+	evaluation := NewAuthZENEvaluationRequest(req)
+	assert.Equal(t, AuthZENSubject{Type: "user", ID: "alice"}, evaluation.Subject)
+	assert.Equal(t, AuthZENResource{Type: "bets", ID: "1/legs/2"}, evaluation.Resource)
+	assert.Equal(t, "2026-01-02T03:04:05Z", evaluation.Context["time"])
+
+	mapped, err := evaluation.Request()
+	require.NoError(t, err)
+	assert.Equal(t, req, mapped)
+
+	for _, principal := range []Principal{"groups/admins", "anonymous"} {
+		mapped, err := NewAuthZENEvaluationRequest(Request{Principal: principal, Action: "a", Resource: "r"}).Request()
+		require.NoError(t, err)
+		assert.Equal(t, principal, mapped.Principal)
+	}
+
+	decider := "readers"
+	resp := Response{Effect: EffectAllow, Message: "allowed", Decider: &decider, DecisionID: "d1"}
+	assert.Equal(t, resp, NewAuthZENEvaluationResponse(resp).Response())
+}
+
+func TestAuthZENMapping_Invalid(t *testing.T) {
+	_, err := AuthZENEvaluationRequest{Action: AuthZENAction{Name: "a"}, Resource: AuthZENResource{ID: "r"}}.Request()
+	assert.ErrorContains(t, err, "subject.id is required")
+
+	_, err = AuthZENEvaluationRequest{
+		Subject:  AuthZENSubject{Type: "user", ID: "alice"},
+		Action:   AuthZENAction{Name: "a"},
+		Resource: AuthZENResource{ID: "r"},
+		Context:  map[string]any{"time": "yesterday"},
+	}.Request()
+	assert.ErrorContains(t, err, "context.time")
+}
+
+func TestAuthZENHandler_Evaluation(t *testing.T) {
+	server := newAuthZENTestServer(t)
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/access/v1/evaluation", bytes.NewBufferString(`{
+		"subject": {"type": "user", "id": "alice"},
+		"action": {"name": "bets:read"},
+		"resource": {"type": "bets", "id": "42"}
+	}`))
+	require.NoError(t, err)
+	req.Header.Set("X-Request-ID", "req-1")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "req-1", resp.Header.Get("X-Request-ID"))
+	var result AuthZENEvaluationResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.True(t, result.Decision)
+	assert.Equal(t, "readers", result.Context["decider"])
+
+	resp = postAuthZEN(t, server.URL+"/access/v1/evaluation", `{"subject": {"type": "user"}, "action": {"name": "bets:read"}, "resource": {"type": "bets", "id": "42"}}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+
+	resp = postAuthZEN(t, server.URL+"/access/v1/evaluation", `{`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAuthZENHandler_Evaluations(t *testing.T) {
+	server := newAuthZENTestServer(t)
+	batch := func(semantic string) []AuthZENEvaluationResponse {
+		resp := postAuthZEN(t, server.URL+"/access/v1/evaluations", `{
+			"subject": {"type": "user", "id": "alice"},
+			"action": {"name": "bets:read"},
+			"evaluations": [
+				{"resource": {"type": "bets", "id": "1"}},
+				{"resource": {"type": "accounts", "id": "1"}},
+				{"resource": {"type": "bets", "id": "2"}, "context": {"ip": "10.6.6.6"}},
+				{"subject": {"type": "user", "id": "bob"}},
+				{"resource": {"type": "bets", "id": "3"}}
+			],
+			"options": {"evaluations_semantic": "`+semantic+`"}
+		}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var result AuthZENEvaluationsResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result.Evaluations
+	}
+	decisions := func(results []AuthZENEvaluationResponse) []bool {
+		var decisions []bool
+		for _, result := range results {
+			decisions = append(decisions, result.Decision)
+		}
+		return decisions
+	}
+
+	all := batch("")
+	assert.Equal(t, []bool{true, false, false, false, true}, decisions(all))
+	assert.Equal(t, map[string]any{"status": float64(400), "message": "subject, action and resource are required"},
+		all[3].Context["error"], "an evaluation without a resource reports an error")
+
+	assert.Equal(t, []bool{true, false}, decisions(batch(AuthZENDenyOnFirstDeny)))
+	assert.Equal(t, []bool{true}, decisions(batch(AuthZENPermitOnFirstPermit)))
+
+	resp := postAuthZEN(t, server.URL+"/access/v1/evaluations", `{"evaluations": [{}], "options": {"evaluations_semantic": "most"}}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Without evaluations, the request is a single evaluation.
+	resp = postAuthZEN(t, server.URL+"/access/v1/evaluations", `{
+		"subject": {"type": "user", "id": "alice"},
+		"action": {"name": "bets:read"},
+		"resource": {"type": "bets", "id": "1"}
+	}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var single AuthZENEvaluationResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&single))
+	assert.True(t, single.Decision)
+}
+
+func TestAuthZENAuthorizer(t *testing.T) {
+	server := newAuthZENTestServer(t)
+	authorizer := NewAuthZENAuthorizer(server.URL+"/", func() (string, error) { return "token", nil })
+
+	req := Request{Principal: "users/alice", Action: "bets:read", Resource: "bets/7"}
+	resp, err := authorizer.Authorize(t.Context(), req)
+	require.NoError(t, err)
+	assert.Equal(t, EffectAllow, resp.Effect)
+	require.NotNil(t, resp.Decider)
+	assert.Equal(t, "readers", *resp.Decider)
+
+	req.Context.Request.IP = "10.6.6.6"
+	resp, err = authorizer.Authorize(t.Context(), req)
+	require.NoError(t, err)
+	assert.Equal(t, EffectDeny, resp.Effect)
+
+	_, err = authorizer.Authorize(t.Context(), Request{Action: "bets:read", Resource: "bets/7"})
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+}
+
+func TestAuthZENAuthorizer_ResponseVerification(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	server := httptest.NewServer(ResponseSigningMiddleware("k1", priv)(NewAuthZENHandler(newAuthZENTestEvaluator(t), AuthZENHandlerConfig{})))
+	t.Cleanup(server.Close)
+	authorizer := NewAuthZENAuthorizer(server.URL, func() (string, error) { return "token", nil },
+		WithResponseVerification(map[string]ed25519.PublicKey{"k1": pub}))
+
+	req := Request{Principal: "users/alice", Action: "bets:read", Resource: "bets/7"}
+	resp, err := authorizer.Authorize(t.Context(), req)
+	require.NoError(t, err)
+	assert.Equal(t, EffectAllow, resp.Effect)
+	require.NotNil(t, resp.Decider)
+	assert.Equal(t, "readers", *resp.Decider)
+
+	req.Context.Request.IP = "10.6.6.6"
+	resp, err = authorizer.Authorize(t.Context(), req)
+	require.NoError(t, err)
+	assert.Equal(t, EffectDeny, resp.Effect)
+
+	// Batch results carry no single decision and are not signed.
+	batch := postAuthZEN(t, server.URL+authZENEvaluationsPath,
+		`{"subject":{"type":"user","id":"alice"},"action":{"name":"bets:read"},"evaluations":[{"resource":{"type":"bets","id":"1"}}]}`)
+	assert.Equal(t, http.StatusOK, batch.StatusCode)
+	assert.Empty(t, batch.Header.Get(responseSignatureHeader))
+}
+
+func TestAuthZENHandler_EvaluatorError(t *testing.T) {
+	var errs []error
+	server := httptest.NewServer(NewAuthZENHandler(evaluatorFunc(func(Request) (Response, error) {
+		return Response{}, errors.New("dial tcp 10.0.0.5:5432: connection refused")
+	}), AuthZENHandlerConfig{OnError: func(r *http.Request, err error) { errs = append(errs, err) }}))
+	t.Cleanup(server.Close)
+
+	single := `{"subject": {"type": "user", "id": "alice"}, "action": {"name": "bets:read"}, "resource": {"type": "bets", "id": "1"}}`
+	for _, path := range []string{"/access/v1/evaluation", "/access/v1/evaluations"} {
+		resp := postAuthZEN(t, server.URL+path, single)
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "evaluation failed")
+		assert.NotContains(t, string(body), "10.0.0.5")
+	}
+
+	resp := postAuthZEN(t, server.URL+"/access/v1/evaluations", `{
+		"subject": {"type": "user", "id": "alice"},
+		"action": {"name": "bets:read"},
+		"evaluations": [{"resource": {"type": "bets", "id": "1"}}]
+	}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "10.0.0.5")
+	var result AuthZENEvaluationsResponse
+	require.NoError(t, json.Unmarshal(body, &result))
+	require.Len(t, result.Evaluations, 1)
+	assert.False(t, result.Evaluations[0].Decision)
+	assert.Equal(t, map[string]any{"status": float64(500), "message": "evaluation failed"}, result.Evaluations[0].Context["error"])
+
+	require.Len(t, errs, 3)
+	for _, err := range errs {
+		assert.ErrorContains(t, err, "connection refused")
+	}
+}
@@ -0,0 +1,46 @@
+package authorization
+
+import "fmt"
+
+// BatchOperation is a single put or delete applied by StatementStore.ApplyBatch.
+// Build operations with BatchPut and BatchDelete.
+type BatchOperation struct {
+	Type ChangeType
+	// Statement is the statement to save, for puts.
+	Statement Statement
+	// StatementID is the statement to delete, for deletes.
+	StatementID string
+	Options     WriteOptions
+}
+
+// BatchPut returns an operation saving the statement subject to opts.
+func BatchPut(statement Statement, opts WriteOptions) BatchOperation {
+	return BatchOperation{Type: ChangePut, Statement: statement, Options: opts}
+}
+
+// BatchDelete returns an operation deleting the statement subject to opts.
+func BatchDelete(id string, opts WriteOptions) BatchOperation {
+	return BatchOperation{Type: ChangeDelete, StatementID: id, Options: opts}
+}
+
+func (op BatchOperation) id() string {
+	if op.Type == ChangePut {
+		return op.Statement.ID
+	}
+	return op.StatementID
+}
+
+// BatchError identifies the operation that caused a batch to be rolled back.
+type BatchError struct {
+	Index       int
+	StatementID string
+	Err         error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch operation %d on statement %q failed: %s", e.Index, e.StatementID, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,154 @@
+package authorization
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryStorage_ApplyBatch(t *testing.T) {
+	storage := NewInMemoryStorage()
+	for _, id := range []string{"old-1", "old-2"} {
+		require.NoError(t, storage.SaveStatement(Statement{ID: id, Effect: EffectAllow, Principals: []Principal{"users/mark"}}))
+	}
+
+	err := storage.ApplyBatch([]BatchOperation{
+		BatchPut(Statement{ID: "new", Effect: EffectAllow, Principals: []Principal{"users/mark"}}, WriteOptions{Actor: "users/admin", IfNotExists: true}),
+		BatchDelete("old-1", WriteOptions{IfMatch: 1}),
+		BatchDelete("old-2", WriteOptions{}),
+	})
+	require.NoError(t, err)
+
+	statements, err := storage.ListStatementsByPrincipal("users/mark")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new"}, statementIDs(statements))
+	assert.Equal(t, "users/admin", statements[0].CreatedBy)
+	assert.Equal(t, uint64(3), statements[0].Revision)
+	assert.Equal(t, uint64(5), storage.Revision())
+}
+
+func TestInMemoryStorage_ApplyBatchRollback(t *testing.T) {
+	testCases := []struct {
+		name  string
+		ops   []BatchOperation
+		index int
+		err   error
+	}{
+		{
+			name: "Conflict on last operation",
+			ops: []BatchOperation{
+				BatchPut(Statement{ID: "new", Effect: EffectAllow}, WriteOptions{}),
+				BatchDelete("old", WriteOptions{IfMatch: 42}),
+			},
+			index: 1,
+			err:   ErrConflict,
+		},
+		{
+			name: "Delete of missing statement",
+			ops: []BatchOperation{
+				BatchDelete("old", WriteOptions{}),
+				BatchDelete("missing", WriteOptions{}),
+			},
+			index: 1,
+			err:   ErrStatementNotFound,
+		},
+		{
+			name: "Invalid statement",
+			ops: []BatchOperation{
+				BatchDelete("old", WriteOptions{}),
+				BatchPut(Statement{ID: "new", Effect: "maybe"}, WriteOptions{}),
+			},
+			index: 1,
+		},
+		{
+			name: "Later operation sees earlier one",
+			ops: []BatchOperation{
+				BatchDelete("old", WriteOptions{}),
+				BatchDelete("old", WriteOptions{}),
+			},
+			index: 1,
+			err:   ErrStatementNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := NewInMemoryStorage()
+			require.NoError(t, storage.SaveStatement(Statement{ID: "old", Effect: EffectAllow}))
+
+			err := storage.ApplyBatch(tc.ops)
+			var batchErr *BatchError
+			require.ErrorAs(t, err, &batchErr)
+			assert.Equal(t, tc.index, batchErr.Index)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+			}
+
+			page, err := storage.List(StatementFilter{})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"old"}, statementIDs(page.Statements), "storage must be unchanged")
+			assert.Equal(t, uint64(1), storage.Revision())
+		})
+	}
+}
+
+// TestInMemoryStorage_ApplyBatchIsAtomic swaps an allow statement for another
+// while readers are running; no reader may ever observe zero or two of them.
+func TestInMemoryStorage_ApplyBatchIsAtomic(t *testing.T) {
+	storage := NewInMemoryStorage()
+	stmt := func(id string) Statement {
+		return Statement{ID: id, Effect: EffectAllow, Principals: []Principal{"users/mark"}}
+	}
+	require.NoError(t, storage.SaveStatement(stmt("a")))
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				statements, err := storage.ListStatementsByPrincipal("users/mark")
+				if !assert.NoError(t, err) || !assert.Len(t, statements, 1) {
+					return
+				}
+			}
+		}()
+	}
+
+	from, to := "a", "b"
+	for range 200 {
+		require.NoError(t, storage.ApplyBatch([]BatchOperation{
+			BatchPut(stmt(to), WriteOptions{}),
+			BatchDelete(from, WriteOptions{}),
+		}))
+		from, to = to, from
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestInMemoryStorage_ApplyBatchWatch(t *testing.T) {
+	storage := NewInMemoryStorage()
+	require.NoError(t, storage.SaveStatement(Statement{ID: "old", Effect: EffectAllow}))
+	events, err := storage.Watch(t.Context(), storage.Revision())
+	require.NoError(t, err)
+
+	require.NoError(t, storage.ApplyBatch([]BatchOperation{
+		BatchPut(Statement{ID: "new", Effect: EffectAllow}, WriteOptions{}),
+		BatchDelete("old", WriteOptions{}),
+	}))
+
+	got := receiveEvents(t, events, 2)
+	assert.Equal(t, ChangePut, got[0].Type)
+	assert.Equal(t, uint64(2), got[0].Revision)
+	assert.Equal(t, ChangeDelete, got[1].Type)
+	assert.Equal(t, uint64(3), got[1].Revision)
+}
@@ -0,0 +1,75 @@
+package authorization
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+type DecisionSource string
+
+const (
+	DecisionSourceEvaluator          DecisionSource = "evaluator"
+	DecisionSourceExpandingEvaluator DecisionSource = "expanding_evaluator"
+	DecisionSourceRemote             DecisionSource = "remote"
+)
+
+// Decision is the record of a single authorization decision passed to a
+// DecisionLogger.
+type Decision struct {
+	ID       string
+	Source   DecisionSource
+	Time     time.Time
+	Request  Request
+	Response Response
+	// StatementID is the ID of the deciding statement, empty for default
+	// denies and remote decisions without a decider.
+	StatementID string
+	// Statement is the deciding statement, only known to the local evaluator.
+	Statement *Statement
+	// Principals are the expanded principals, only set by ExpandingEvaluator.
+	Principals []Principal
+	Latency    time.Duration
+	// Err is the error returned alongside the response, if any.
+	Err error
+}
+
+// DecisionLogger receives every decision made by an evaluator or authorizer
+// it is attached to with WithDecisionLogger. It is called synchronously, so
+// implementations should be fast and must be safe for concurrent use.
+//
+// Attach the logger to the outermost evaluator only: an ExpandingEvaluator
+// whose base evaluator also logs records every decision several times.
+type DecisionLogger interface {
+	LogDecision(decision Decision)
+}
+
+// DecisionLoggerOption attaches a DecisionLogger. It is accepted by
+// NewEvaluator, NewExpandingEvaluator and NewBetandbeatRemoteAuthorizer.
+type DecisionLoggerOption struct {
+	logger DecisionLogger
+}
+
+// WithDecisionLogger logs every decision to logger and sets Response.DecisionID.
+func WithDecisionLogger(logger DecisionLogger) DecisionLoggerOption {
+	return DecisionLoggerOption{logger: logger}
+}
+
+func (o DecisionLoggerOption) applyEvaluator(e *evaluator) {
+	e.decisionLogger = o.logger
+}
+
+func (o DecisionLoggerOption) applyExpandingEvaluator(e *ExpandingEvaluator) {
+	e.decisionLogger = o.logger
+}
+
+func (o DecisionLoggerOption) applyRemoteAuthorizer(r *remoteAuthorizer) {
+	r.decisionLogger = o.logger
+}
+
+// newDecisionID returns a random 128-bit identifier in hex.
+func newDecisionID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,493 @@
+package authorization
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	chainEntryDecision   = "decision"
+	chainEntryCheckpoint = "checkpoint"
+
+	defaultChainCheckpointEvery = 1000
+	defaultChainMaxFileBytes    = 64 << 20
+	// maxChainLineBytes bounds a single log line when reading a log back.
+	maxChainLineBytes = 16 << 20
+)
+
+// ChainedDecisionLoggerConfig configures the tamper-evident decision logger.
+type ChainedDecisionLoggerConfig struct {
+	// Dir is the directory the log files are written to.
+	Dir string
+	// Prefix names the log files, "<prefix>-000001.jsonl" and so on. Defaults
+	// to "decisions".
+	Prefix string
+	// SigningKey signs the checkpoints.
+	SigningKey ed25519.PrivateKey
+	// KeyID is recorded in checkpoints to select the verification key.
+	KeyID string
+	// CheckpointEvery is the number of decisions between checkpoints,
+	// defaulting to 1000.
+	CheckpointEvery int
+	// MaxFileBytes is the size after which the current file is sealed with a
+	// checkpoint and a new one is started, defaulting to 64 MiB.
+	MaxFileBytes int64
+	// RedactContextFields are redacted as in JSONDecisionLoggerConfig.
+	RedactContextFields []string
+	// OnError is called when a decision cannot be written.
+	OnError func(error)
+	// OnCheckpoint is called with every checkpoint written. Record the latest
+	// anchor outside the log, so that verifying against it detects newer
+	// entries or files removed from the end of the log. It is called with
+	// the logger locked and must not block.
+	OnCheckpoint func(ChainAnchor)
+}
+
+// ChainAnchor identifies a checkpoint of a chained decision log, see
+// ChainedDecisionLoggerConfig.OnCheckpoint and VerifyChainedDecisionLog.
+type ChainAnchor struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// chainEntry is a single line of a chained decision log. Hash covers the
+// previous entry's hash, the sequence number, the type and the payload, so
+// modifying, dropping or reordering entries breaks the chain.
+type chainEntry struct {
+	Seq     uint64          `json:"seq"`
+	Type    string          `json:"type"`
+	Prev    string          `json:"prev"`
+	Payload json.RawMessage `json:"payload"`
+	Hash    string          `json:"hash"`
+}
+
+// chainCheckpoint is the payload of a checkpoint entry. Signature is the
+// ed25519 signature of checkpointMessage, binding the key ID, the entry's
+// previous hash, its sequence number and whether it seals its file, and so
+// vouching for every entry before it. Only the
+// last entry of a file seals it, so a file cut short after a periodic
+// checkpoint is detected.
+type chainCheckpoint struct {
+	Time      time.Time `json:"time"`
+	KeyID     string    `json:"keyId,omitempty"`
+	Seal      bool      `json:"seal,omitempty"`
+	Signature string    `json:"signature"`
+}
+
+// chainedDecisionLogger writes decisions to hash-chained JSON lines files and
+// periodically seals them with signed checkpoints.
+type chainedDecisionLogger struct {
+	mu     sync.Mutex
+	config ChainedDecisionLoggerConfig
+	now    func() time.Time
+
+	file      *os.File
+	fileIndex int
+	fileBytes int64
+	seq       uint64
+	prev      [sha256.Size]byte
+	// unsigned counts decisions since the last checkpoint.
+	unsigned int
+}
+
+// NewChainedDecisionLogger creates a tamper-evident DecisionLogger. If Dir
+// already holds a log, the chain is continued in a new file; a last file left
+// without a final checkpoint, e.g. after a crash, is sealed first, after
+// cutting off a line the crash left incomplete. Close the logger to seal the
+// current file.
+func NewChainedDecisionLogger(config ChainedDecisionLoggerConfig) (*chainedDecisionLogger, error) {
+	if len(config.SigningKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("a valid ed25519 signing key is required")
+	}
+	if config.Prefix == "" {
+		config.Prefix = "decisions"
+	}
+	if config.CheckpointEvery <= 0 {
+		config.CheckpointEvery = defaultChainCheckpointEvery
+	}
+	if config.MaxFileBytes <= 0 {
+		config.MaxFileBytes = defaultChainMaxFileBytes
+	}
+	l := &chainedDecisionLogger{config: config, now: time.Now}
+	if err := l.resume(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *chainedDecisionLogger) LogDecision(decision Decision) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.logDecision(decision)
+	if err != nil && l.config.OnError != nil {
+		l.config.OnError(err)
+	}
+}
+
+func (l *chainedDecisionLogger) logDecision(decision Decision) error {
+	payload, err := json.Marshal(newDecisionRecord(decision, l.config.RedactContextFields))
+	if err != nil {
+		return err
+	}
+	if err := l.append(chainEntryDecision, payload); err != nil {
+		return err
+	}
+	l.unsigned++
+	if l.fileBytes >= l.config.MaxFileBytes {
+		return l.seal()
+	}
+	if l.unsigned >= l.config.CheckpointEvery {
+		return l.checkpoint(false)
+	}
+	return nil
+}
+
+// Close writes a final checkpoint and closes the current file.
+func (l *chainedDecisionLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	return l.seal()
+}
+
+// seal checkpoints and closes the current file; the next entry opens a new one.
+func (l *chainedDecisionLogger) seal() error {
+	if err := l.checkpoint(true); err != nil {
+		return err
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func (l *chainedDecisionLogger) checkpoint(seal bool) error {
+	payload, err := json.Marshal(chainCheckpoint{
+		Time:      l.now().UTC(),
+		KeyID:     l.config.KeyID,
+		Seal:      seal,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(l.config.SigningKey, checkpointMessage(l.config.KeyID, l.prev, l.seq+1, seal))),
+	})
+	if err != nil {
+		return err
+	}
+	if err := l.append(chainEntryCheckpoint, payload); err != nil {
+		return err
+	}
+	l.unsigned = 0
+	if l.config.OnCheckpoint != nil {
+		l.config.OnCheckpoint(ChainAnchor{Seq: l.seq, Hash: hex.EncodeToString(l.prev[:])})
+	}
+	return nil
+}
+
+// append links an entry to the chain and writes it to the current file,
+// opening the next file first if needed.
+func (l *chainedDecisionLogger) append(entryType string, payload []byte) error {
+	if l.file == nil {
+		l.fileIndex++
+		file, err := os.OpenFile(l.filePath(l.fileIndex), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		l.file = file
+		l.fileBytes = 0
+	}
+
+	seq := l.seq + 1
+	hash := chainHash(l.prev, seq, entryType, payload)
+	line, err := json.Marshal(chainEntry{
+		Seq:     seq,
+		Type:    entryType,
+		Prev:    hex.EncodeToString(l.prev[:]),
+		Payload: payload,
+		Hash:    hex.EncodeToString(hash[:]),
+	})
+	if err != nil {
+		return err
+	}
+	n, err := l.file.Write(append(line, '\n'))
+	l.fileBytes += int64(n)
+	if err != nil {
+		return err
+	}
+	l.seq = seq
+	l.prev = hash
+	return nil
+}
+
+func (l *chainedDecisionLogger) filePath(index int) string {
+	return filepath.Join(l.config.Dir, fmt.Sprintf("%s-%06d.jsonl", l.config.Prefix, index))
+}
+
+// resume continues the chain of an existing log in Dir, sealing its last file
+// if it does not end with a sealing checkpoint. A last line written only in
+// part before a crash is cut off, and a last file left empty is removed.
+func (l *chainedDecisionLogger) resume() error {
+	files, err := ChainedDecisionLogFiles(l.config.Dir, l.config.Prefix)
+	if err != nil {
+		return err
+	}
+	for ; len(files) > 0; files = files[:len(files)-1] {
+		last := files[len(files)-1]
+		index, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(last), l.config.Prefix+"-"), ".jsonl"))
+		if err != nil {
+			return fmt.Errorf("unexpected log file name %q", last)
+		}
+		entry, err := readLastChainEntry(last)
+		if err != nil {
+			return err
+		}
+		if entry.Seq == 0 {
+			if err := os.Remove(last); err != nil {
+				return err
+			}
+			continue
+		}
+		l.fileIndex = index
+		hash, err := hex.DecodeString(entry.Hash)
+		if err != nil || len(hash) != sha256.Size {
+			return fmt.Errorf("failed to read %q: invalid hash at seq %d", last, entry.Seq)
+		}
+		l.seq = entry.Seq
+		copy(l.prev[:], hash)
+
+		if !isSeal(entry) {
+			file, err := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0)
+			if err != nil {
+				return err
+			}
+			l.file = file
+			return l.seal()
+		}
+		return nil
+	}
+	return nil
+}
+
+// readLastChainEntry returns the last entry of a log file, truncating the
+// file after its last complete line.
+func readLastChainEntry(path string) (chainEntry, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return chainEntry{}, err
+	}
+	defer f.Close()
+
+	var entry chainEntry
+	var complete int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return chainEntry{}, err
+		}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return chainEntry{}, fmt.Errorf("failed to read %q: %w", path, err)
+		}
+		complete += int64(len(line))
+	}
+	// A line without its newline was torn by a crash while being written.
+	if info, err := f.Stat(); err != nil {
+		return chainEntry{}, err
+	} else if info.Size() > complete {
+		if err := f.Truncate(complete); err != nil {
+			return chainEntry{}, err
+		}
+	}
+	return entry, nil
+}
+
+// ChainedDecisionLogFiles returns the files of the chained decision log with
+// the given prefix in dir, in chain order.
+func ChainedDecisionLogFiles(dir, prefix string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, prefix+"-[0-9]*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// isSeal reports whether entry is a checkpoint sealing its file.
+func isSeal(entry chainEntry) bool {
+	var checkpoint chainCheckpoint
+	return entry.Type == chainEntryCheckpoint && json.Unmarshal(entry.Payload, &checkpoint) == nil && checkpoint.Seal
+}
+
+// ChainVerification summarizes a successfully verified chained decision log.
+type ChainVerification struct {
+	Files       int
+	Decisions   int
+	Checkpoints int
+	// FirstSeq is the sequence number the verified log starts at; it is 1
+	// unless older files were removed.
+	FirstSeq uint64
+	LastSeq  uint64
+	LastHash string
+}
+
+// VerifyChainedDecisionLog checks the files of a chained decision log, given
+// in chain order. It verifies that entries are consecutive, that every hash
+// links to the previous entry, that every checkpoint is signed by the key
+// registered for its key ID, and that every file ends with the checkpoint
+// sealing it. It thereby detects modified, reordered, inserted and removed
+// entries as well as truncated files.
+//
+// On its own, success proves that the files are an untampered part of the
+// log, from FirstSeq to LastSeq. Removing whole files from the end of the
+// log leaves such a part, so pass the latest anchors recorded outside the log
+// with ChainedDecisionLoggerConfig.OnCheckpoint: each must match a
+// checkpoint of the files.
+func VerifyChainedDecisionLog(files []io.Reader, keys map[string]ed25519.PublicKey, anchors ...ChainAnchor) (ChainVerification, error) {
+	var result ChainVerification
+	var prev [sha256.Size]byte
+	for i, file := range files {
+		result.Files++
+		var last chainEntry
+		scanner := newChainScanner(file)
+		for scanner.Scan() {
+			var entry chainEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				return result, fmt.Errorf("file %d: malformed entry after seq %d: %w", i+1, result.LastSeq, err)
+			}
+			if isSeal(last) {
+				return result, fmt.Errorf("file %d: seq %d follows the seal at seq %d", i+1, entry.Seq, last.Seq)
+			}
+			if err := verifyChainEntry(entry, &result, &prev, keys); err != nil {
+				return result, fmt.Errorf("file %d: %w", i+1, err)
+			}
+			for _, anchor := range anchors {
+				if anchor.Seq == entry.Seq && (entry.Type != chainEntryCheckpoint || anchor.Hash != entry.Hash) {
+					return result, fmt.Errorf("file %d: seq %d does not match the anchor", i+1, entry.Seq)
+				}
+			}
+			last = entry
+		}
+		if err := scanner.Err(); err != nil {
+			return result, fmt.Errorf("file %d: %w", i+1, err)
+		}
+		if last.Seq == 0 {
+			return result, fmt.Errorf("file %d: empty log file", i+1)
+		}
+		if !isSeal(last) {
+			return result, fmt.Errorf("file %d: truncated, entries after seq %d are not sealed by a checkpoint", i+1, last.Seq)
+		}
+	}
+	if result.Files == 0 {
+		return result, errors.New("no log files")
+	}
+	for _, anchor := range anchors {
+		if anchor.Seq > result.LastSeq {
+			return result, fmt.Errorf("truncated, the log ends at seq %d before the anchor at seq %d", result.LastSeq, anchor.Seq)
+		}
+		if anchor.Seq < result.FirstSeq {
+			return result, fmt.Errorf("the anchor at seq %d precedes the log, which starts at seq %d", anchor.Seq, result.FirstSeq)
+		}
+	}
+	return result, nil
+}
+
+func verifyChainEntry(entry chainEntry, result *ChainVerification, prev *[sha256.Size]byte, keys map[string]ed25519.PublicKey) error {
+	entryPrev, err := hex.DecodeString(entry.Prev)
+	if err != nil || len(entryPrev) != sha256.Size {
+		return fmt.Errorf("seq %d: invalid previous hash", entry.Seq)
+	}
+	if result.LastSeq == 0 {
+		// The first entry anchors the chain; older files may have been removed.
+		result.FirstSeq = entry.Seq
+		copy(prev[:], entryPrev)
+	} else {
+		if entry.Seq != result.LastSeq+1 {
+			return fmt.Errorf("seq %d follows seq %d: entries are missing or reordered", entry.Seq, result.LastSeq)
+		}
+		if !bytes.Equal(entryPrev, prev[:]) {
+			return fmt.Errorf("seq %d: previous hash does not match seq %d", entry.Seq, result.LastSeq)
+		}
+	}
+	hash := chainHash(*prev, entry.Seq, entry.Type, entry.Payload)
+	if hex.EncodeToString(hash[:]) != entry.Hash {
+		return fmt.Errorf("seq %d: hash mismatch, the entry was modified", entry.Seq)
+	}
+
+	switch entry.Type {
+	case chainEntryDecision:
+		result.Decisions++
+	case chainEntryCheckpoint:
+		var checkpoint chainCheckpoint
+		if err := json.Unmarshal(entry.Payload, &checkpoint); err != nil {
+			return fmt.Errorf("seq %d: malformed checkpoint: %w", entry.Seq, err)
+		}
+		key, ok := keys[checkpoint.KeyID]
+		if !ok {
+			return fmt.Errorf("seq %d: no public key for key ID %q", entry.Seq, checkpoint.KeyID)
+		}
+		signature, err := base64.StdEncoding.DecodeString(checkpoint.Signature)
+		if err != nil || !ed25519.Verify(key, checkpointMessage(checkpoint.KeyID, *prev, entry.Seq, checkpoint.Seal), signature) {
+			return fmt.Errorf("seq %d: invalid checkpoint signature", entry.Seq)
+		}
+		result.Checkpoints++
+	default:
+		return fmt.Errorf("seq %d: unknown entry type %q", entry.Seq, entry.Type)
+	}
+
+	*prev = hash
+	result.LastSeq = entry.Seq
+	result.LastHash = entry.Hash
+	return nil
+}
+
+func chainHash(prev [sha256.Size]byte, seq uint64, entryType string, payload []byte) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(prev[:])
+	binary.Write(h, binary.BigEndian, seq)
+	h.Write([]byte(entryType))
+	h.Write([]byte{0})
+	h.Write(payload)
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// checkpointSignatureDomain separates checkpoint signatures from anything
+// else signed with the same key.
+const checkpointSignatureDomain = "betandbeat-authorization-decision-log-checkpoint-v1\x00"
+
+// checkpointMessage is the message a checkpoint signs.
+func checkpointMessage(keyID string, prev [sha256.Size]byte, seq uint64, seal bool) []byte {
+	message := []byte(checkpointSignatureDomain)
+	message = binary.BigEndian.AppendUint32(message, uint32(len(keyID)))
+	message = append(message, keyID...)
+	message = append(message, prev[:]...)
+	message = binary.BigEndian.AppendUint64(message, seq)
+	if seal {
+		return append(message, 1)
+	}
+	return append(message, 0)
+}
+
+func newChainScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxChainLineBytes)
+	return scanner
+}
@@ -0,0 +1,316 @@
+package authorization
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestChainedLogger(t *testing.T, dir string, config ChainedDecisionLoggerConfig) (*chainedDecisionLogger, map[string]ed25519.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	config.Dir = dir
+	config.SigningKey = priv
+	config.KeyID = "k1"
+	config.OnError = func(err error) { t.Errorf("unexpected log error: %v", err) }
+	logger, err := NewChainedDecisionLogger(config)
+	require.NoError(t, err)
+	return logger, map[string]ed25519.PublicKey{"k1": pub}
+}
+
+func logTestDecisions(logger DecisionLogger, from, count int) {
+	for i := from; i < from+count; i++ {
+		logger.LogDecision(Decision{
+			ID:       fmt.Sprintf("d%d", i),
+			Source:   DecisionSourceEvaluator,
+			Request:  Request{Principal: "users/mark", Action: "read", Resource: "doc"},
+			Response: Response{Effect: EffectAllow},
+		})
+	}
+}
+
+// readChainedLog returns the lines of every log file in dir.
+func readChainedLog(t *testing.T, dir string) [][]string {
+	t.Helper()
+	paths, err := ChainedDecisionLogFiles(dir, "decisions")
+	require.NoError(t, err)
+	var files [][]string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		files = append(files, strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"))
+	}
+	return files
+}
+
+func verifyChainedLines(files [][]string, keys map[string]ed25519.PublicKey, anchors ...ChainAnchor) (ChainVerification, error) {
+	readers := make([]io.Reader, len(files))
+	for i, lines := range files {
+		readers[i] = strings.NewReader(strings.Join(lines, "\n") + "\n")
+	}
+	return VerifyChainedDecisionLog(readers, keys, anchors...)
+}
+
+func TestChainedDecisionLogger(t *testing.T) {
+	dir := t.TempDir()
+	logger, keys := newTestChainedLogger(t, dir, ChainedDecisionLoggerConfig{CheckpointEvery: 3})
+	logTestDecisions(logger, 0, 7)
+	require.NoError(t, logger.Close())
+
+	files := readChainedLog(t, dir)
+	require.Len(t, files, 1)
+	assert.Len(t, files[0], 10, "7 decisions, checkpoints after 3 and 6 and on close")
+
+	result, err := verifyChainedLines(files, keys)
+	require.NoError(t, err)
+	assert.Equal(t, 7, result.Decisions)
+	assert.Equal(t, 3, result.Checkpoints)
+	assert.Equal(t, uint64(1), result.FirstSeq)
+	assert.Equal(t, uint64(10), result.LastSeq)
+}
+
+func TestChainedDecisionLogger_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	logger, keys := newTestChainedLogger(t, dir, ChainedDecisionLoggerConfig{MaxFileBytes: 1000})
+	logTestDecisions(logger, 0, 10)
+	require.NoError(t, logger.Close())
+
+	files := readChainedLog(t, dir)
+	require.Greater(t, len(files), 1)
+	result, err := verifyChainedLines(files, keys)
+	require.NoError(t, err)
+	assert.Equal(t, 10, result.Decisions)
+	assert.Equal(t, len(files), result.Checkpoints, "every file is sealed")
+
+	_, err = verifyChainedLines(append(files[:1:1], files[2:]...), keys)
+	assert.ErrorContains(t, err, "missing or reordered", "a removed middle file is detected")
+
+	result, err = verifyChainedLines(files[1:], keys)
+	require.NoError(t, err, "older files may be removed")
+	assert.Greater(t, result.FirstSeq, uint64(1))
+
+	joined := append(append([]string(nil), files[0]...), files[1]...)
+	_, err = verifyChainedLines([][]string{joined}, keys)
+	assert.ErrorContains(t, err, "follows the seal", "files are sealed by their last entry only")
+}
+
+func TestVerifyChainedDecisionLog_Anchors(t *testing.T) {
+	dir := t.TempDir()
+	var anchors []ChainAnchor
+	logger, keys := newTestChainedLogger(t, dir, ChainedDecisionLoggerConfig{
+		MaxFileBytes: 1000,
+		OnCheckpoint: func(anchor ChainAnchor) { anchors = append(anchors, anchor) },
+	})
+	logTestDecisions(logger, 0, 10)
+	require.NoError(t, logger.Close())
+
+	files := readChainedLog(t, dir)
+	require.Greater(t, len(files), 1)
+	require.Len(t, anchors, len(files))
+	latest := anchors[len(anchors)-1]
+
+	result, err := verifyChainedLines(files, keys, latest)
+	require.NoError(t, err)
+	assert.Equal(t, latest.Seq, result.LastSeq)
+	assert.Equal(t, latest.Hash, result.LastHash)
+
+	_, err = verifyChainedLines(files[:len(files)-1], keys)
+	require.NoError(t, err, "without an anchor, removed trailing files leave a valid log")
+	_, err = verifyChainedLines(files[:len(files)-1], keys, latest)
+	assert.ErrorContains(t, err, "before the anchor", "the anchor detects removed trailing files")
+
+	_, err = verifyChainedLines(files, keys, ChainAnchor{Seq: latest.Seq, Hash: anchors[0].Hash})
+	assert.ErrorContains(t, err, "does not match the anchor")
+	_, err = verifyChainedLines(files, keys, ChainAnchor{Seq: 1})
+	assert.ErrorContains(t, err, "does not match the anchor", "anchors name checkpoints")
+}
+
+func TestChainedDecisionLogger_Resume(t *testing.T) {
+	dir := t.TempDir()
+	logger, keys := newTestChainedLogger(t, dir, ChainedDecisionLoggerConfig{})
+	logTestDecisions(logger, 0, 2)
+	// Simulate a crash: the file is left without a final checkpoint.
+	require.NoError(t, logger.file.Close())
+
+	resumed, err := NewChainedDecisionLogger(logger.config)
+	require.NoError(t, err)
+	logTestDecisions(resumed, 2, 2)
+	require.NoError(t, resumed.Close())
+
+	files := readChainedLog(t, dir)
+	require.Len(t, files, 2)
+	result, err := verifyChainedLines(files, keys)
+	require.NoError(t, err)
+	assert.Equal(t, 4, result.Decisions)
+	assert.Equal(t, 2, result.Checkpoints)
+}
+
+func TestChainedDecisionLogger_ResumeTornLine(t *testing.T) {
+	dir := t.TempDir()
+	logger, keys := newTestChainedLogger(t, dir, ChainedDecisionLoggerConfig{})
+	logTestDecisions(logger, 0, 2)
+	// Simulate a crash while writing the third decision.
+	_, err := logger.file.WriteString(`{"seq":3,"type":"decision","prev":"`)
+	require.NoError(t, err)
+	require.NoError(t, logger.file.Close())
+
+	resumed, err := NewChainedDecisionLogger(logger.config)
+	require.NoError(t, err, "a torn last line does not keep the logger from reopening")
+	logTestDecisions(resumed, 2, 1)
+	require.NoError(t, resumed.Close())
+
+	files := readChainedLog(t, dir)
+	require.Len(t, files, 2)
+	assert.Len(t, files[0], 3, "the torn line is cut off and the file sealed")
+	result, err := verifyChainedLines(files, keys)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Decisions)
+}
+
+func TestChainedDecisionLogger_ResumeEmptyFile(t *testing.T) {
+	dir := t.TempDir()
+	logger, keys := newTestChainedLogger(t, dir, ChainedDecisionLoggerConfig{})
+	logTestDecisions(logger, 0, 2)
+	require.NoError(t, logger.Close())
+	// Simulate a crash right after creating the next file.
+	require.NoError(t, os.WriteFile(logger.filePath(2), []byte(`{"seq":4,"ty`), 0o600))
+
+	resumed, err := NewChainedDecisionLogger(logger.config)
+	require.NoError(t, err)
+	logTestDecisions(resumed, 2, 1)
+	require.NoError(t, resumed.Close())
+
+	files := readChainedLog(t, dir)
+	require.Len(t, files, 2)
+	result, err := verifyChainedLines(files, keys)
+	require.NoError(t, err, "the chain continues from the last complete file")
+	assert.Equal(t, 3, result.Decisions)
+}
+
+func TestVerifyChainedDecisionLog_DetectsTampering(t *testing.T) {
+	dir := t.TempDir()
+	logger, keys := newTestChainedLogger(t, dir, ChainedDecisionLoggerConfig{CheckpointEvery: 2})
+	logTestDecisions(logger, 0, 5)
+	require.NoError(t, logger.Close())
+	lines := readChainedLog(t, dir)[0]
+	require.Len(t, lines, 8)
+
+	tests := []struct {
+		name   string
+		tamper func([]string) []string
+		err    string
+	}{
+		{
+			name: "modified decision",
+			tamper: func(lines []string) []string {
+				lines[3] = strings.Replace(lines[3], `"effect":"allow"`, `"effect":"deny"`, 1)
+				return lines
+			},
+			err: "hash mismatch",
+		},
+		{
+			name: "reordered decisions",
+			tamper: func(lines []string) []string {
+				lines[3], lines[4] = lines[4], lines[3]
+				return lines
+			},
+			err: "missing or reordered",
+		},
+		{
+			name: "removed decision",
+			tamper: func(lines []string) []string {
+				return append(lines[:1], lines[2:]...)
+			},
+			err: "missing or reordered",
+		},
+		{
+			name: "truncated after a checkpoint",
+			tamper: func(lines []string) []string {
+				return lines[:4]
+			},
+			err: "truncated",
+		},
+		{
+			name: "truncated at a periodic checkpoint",
+			tamper: func(lines []string) []string {
+				return lines[:6]
+			},
+			err: "truncated",
+		},
+		{
+			name: "periodic checkpoint relabeled as seal",
+			tamper: func(lines []string) []string {
+				var entry chainEntry
+				if err := json.Unmarshal([]byte(lines[5]), &entry); err != nil {
+					panic(err)
+				}
+				entry.Payload = json.RawMessage(strings.Replace(string(entry.Payload), `"keyId":"k1",`, `"keyId":"k1","seal":true,`, 1))
+				var prev [sha256.Size]byte
+				hex.Decode(prev[:], []byte(entry.Prev))
+				hash := chainHash(prev, entry.Seq, entry.Type, entry.Payload)
+				entry.Hash = hex.EncodeToString(hash[:])
+				line, _ := json.Marshal(entry)
+				return append(lines[:5], string(line))
+			},
+			err: "invalid checkpoint signature",
+		},
+		{
+			name: "truncated mid-stream",
+			tamper: func(lines []string) []string {
+				return lines[:7]
+			},
+			err: "truncated",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifyChainedLines([][]string{tt.tamper(append([]string(nil), lines...))}, keys)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+
+	t.Run("key ID relabeled", func(t *testing.T) {
+		tampered := append([]string(nil), lines...)
+		var prev [sha256.Size]byte
+		for i, line := range tampered {
+			var entry chainEntry
+			require.NoError(t, json.Unmarshal([]byte(line), &entry))
+			entry.Prev = hex.EncodeToString(prev[:])
+			entry.Payload = json.RawMessage(strings.Replace(string(entry.Payload), `"keyId":"k1"`, `"keyId":"k2"`, 1))
+			hash := chainHash(prev, entry.Seq, entry.Type, entry.Payload)
+			entry.Hash = hex.EncodeToString(hash[:])
+			prev = hash
+			data, err := json.Marshal(entry)
+			require.NoError(t, err)
+			tampered[i] = string(data)
+		}
+		// Both IDs name the same key, so only the signed key ID tells them apart.
+		_, err := verifyChainedLines([][]string{tampered}, map[string]ed25519.PublicKey{"k1": keys["k1"], "k2": keys["k1"]})
+		assert.ErrorContains(t, err, "invalid checkpoint signature")
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		other, _, err := ed25519.GenerateKey(nil)
+		require.NoError(t, err)
+		_, err = verifyChainedLines([][]string{lines}, map[string]ed25519.PublicKey{"k1": other})
+		assert.ErrorContains(t, err, "invalid checkpoint signature")
+	})
+}
+
+func TestNewChainedDecisionLogger_RequiresKey(t *testing.T) {
+	_, err := NewChainedDecisionLogger(ChainedDecisionLoggerConfig{Dir: t.TempDir()})
+	assert.Error(t, err)
+	_, err = VerifyChainedDecisionLog([]io.Reader{bytes.NewReader(nil)}, nil)
+	assert.ErrorContains(t, err, "empty log file")
+}
@@ -0,0 +1,148 @@
+package authorization
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redactedValue replaces the values of redacted context fields.
+const redactedValue = "[REDACTED]"
+
+// JSONDecisionLoggerConfig configures the JSON lines decision logger.
+type JSONDecisionLoggerConfig struct {
+	// SampleRate is the fraction of decisions written, between 0 and 1. Zero
+	// writes every decision.
+	SampleRate float64
+	// AlwaysLogDenied writes denied decisions and decisions with errors
+	// regardless of SampleRate.
+	AlwaysLogDenied bool
+	// RedactContextFields are dot separated paths into the request context,
+	// such as "Request.ip", whose values are replaced by "[REDACTED]". Path
+	// segments match JSON keys case-insensitively.
+	RedactContextFields []string
+	// OnError is called when a decision cannot be written.
+	OnError func(error)
+}
+
+// jsonDecisionLogger writes one JSON object per decision and line.
+type jsonDecisionLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	config JSONDecisionLoggerConfig
+	random func() float64
+}
+
+// NewJSONDecisionLogger creates a DecisionLogger writing JSON lines to w.
+func NewJSONDecisionLogger(w io.Writer, config JSONDecisionLoggerConfig) *jsonDecisionLogger {
+	return &jsonDecisionLogger{
+		w:      w,
+		config: config,
+		random: rand.Float64,
+	}
+}
+
+func (l *jsonDecisionLogger) LogDecision(decision Decision) {
+	if !l.sampled(decision) {
+		return
+	}
+	line, err := json.Marshal(newDecisionRecord(decision, l.config.RedactContextFields))
+	if err == nil {
+		l.mu.Lock()
+		_, err = l.w.Write(append(line, '\n'))
+		l.mu.Unlock()
+	}
+	if err != nil && l.config.OnError != nil {
+		l.config.OnError(err)
+	}
+}
+
+func (l *jsonDecisionLogger) sampled(decision Decision) bool {
+	if l.config.SampleRate <= 0 || l.config.SampleRate >= 1 {
+		return true
+	}
+	if l.config.AlwaysLogDenied && (decision.Response.Denied() || decision.Err != nil) {
+		return true
+	}
+	return l.random() < l.config.SampleRate
+}
+
+// decisionRecord is the serialized form of a Decision.
+type decisionRecord struct {
+	DecisionID  string                `json:"decisionId"`
+	Source      DecisionSource        `json:"source"`
+	Time        time.Time             `json:"time"`
+	Request     decisionRecordRequest `json:"request"`
+	Response    Response              `json:"response"`
+	StatementID string                `json:"statementId,omitempty"`
+	Statement   *Statement            `json:"statement,omitempty"`
+	Principals  []Principal           `json:"principals,omitempty"`
+	LatencyMs   float64               `json:"latencyMs"`
+	Error       string                `json:"error,omitempty"`
+}
+
+type decisionRecordRequest struct {
+	Principal Principal `json:"principal"`
+	Action    ActionID  `json:"action"`
+	Resource  Resource  `json:"resource"`
+	Context   any       `json:"context"`
+}
+
+func newDecisionRecord(decision Decision, redact []string) decisionRecord {
+	record := decisionRecord{
+		DecisionID: decision.ID,
+		Source:     decision.Source,
+		Time:       decision.Time.UTC(),
+		Request: decisionRecordRequest{
+			Principal: decision.Request.Principal,
+			Action:    decision.Request.Action,
+			Resource:  decision.Request.Resource,
+			Context:   redactContext(decision.Request.Context, redact),
+		},
+		Response:    decision.Response,
+		StatementID: decision.StatementID,
+		Statement:   decision.Statement,
+		Principals:  decision.Principals,
+		LatencyMs:   float64(decision.Latency) / float64(time.Millisecond),
+	}
+	if decision.Err != nil {
+		record.Error = decision.Err.Error()
+	}
+	return record
+}
+
+// redactContext returns the context as generic JSON with the values at the
+// given paths replaced, or the context itself if there is nothing to redact.
+func redactContext(ctx Context, paths []string) any {
+	if len(paths) == 0 {
+		return ctx
+	}
+	data, err := json.Marshal(ctx)
+	if err != nil {
+		return ctx
+	}
+	var tree map[string]any
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return ctx
+	}
+	for _, path := range paths {
+		redactPath(tree, strings.Split(path, "."))
+	}
+	return tree
+}
+
+func redactPath(node map[string]any, path []string) {
+	for key, value := range node {
+		if !strings.EqualFold(key, path[0]) {
+			continue
+		}
+		if len(path) == 1 {
+			node[key] = redactedValue
+		} else if child, ok := value.(map[string]any); ok {
+			redactPath(child, path[1:])
+		}
+	}
+}
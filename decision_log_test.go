@@ -0,0 +1,176 @@
+package authorization
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingDecisionLogger keeps every decision in memory.
+type recordingDecisionLogger struct {
+	mu        sync.Mutex
+	decisions []Decision
+}
+
+func (l *recordingDecisionLogger) LogDecision(decision Decision) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.decisions = append(l.decisions, decision)
+}
+
+func TestEvaluator_DecisionLogger(t *testing.T) {
+	storage := NewInMemoryStorage()
+	require.NoError(t, storage.SaveStatement(Statement{
+		ID: "allow-read", Effect: EffectAllow,
+		Principals: []Principal{"users/mark"}, Actions: []ActionID{"read"}, Resources: []Resource{"*"},
+	}))
+	logger := &recordingDecisionLogger{}
+	evaluator := NewEvaluator(storage, WithDecisionLogger(logger))
+
+	req := Request{Principal: "users/mark", Action: "read", Resource: "doc"}
+	resp, err := evaluator.Evaluate(req)
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.DecisionID)
+
+	require.Len(t, logger.decisions, 1)
+	decision := logger.decisions[0]
+	assert.Equal(t, resp.DecisionID, decision.ID)
+	assert.Equal(t, DecisionSourceEvaluator, decision.Source)
+	assert.Equal(t, req, decision.Request)
+	assert.Equal(t, resp, decision.Response)
+	assert.Equal(t, "allow-read", decision.StatementID)
+	require.NotNil(t, decision.Statement)
+	assert.Equal(t, EffectAllow, decision.Statement.Effect)
+	assert.False(t, decision.Time.IsZero())
+	assert.Positive(t, decision.Latency)
+
+	resp, err = evaluator.Evaluate(req.WithAction("write"))
+	require.NoError(t, err)
+	require.Len(t, logger.decisions, 2)
+	assert.Empty(t, logger.decisions[1].StatementID, "default deny has no deciding statement")
+	assert.NotEqual(t, logger.decisions[0].ID, logger.decisions[1].ID)
+}
+
+func TestEvaluator_DecisionLoggerStorageError(t *testing.T) {
+	logger := &recordingDecisionLogger{}
+	evaluator := NewEvaluator(&mockStorage{listStatementsErr: errors.New("database is down")}, WithDecisionLogger(logger))
+
+	_, err := evaluator.Evaluate(Request{Principal: "users/mark"})
+	require.Error(t, err)
+	require.Len(t, logger.decisions, 1)
+	assert.Equal(t, err, logger.decisions[0].Err)
+}
+
+func TestExpandingEvaluator_DecisionLogger(t *testing.T) {
+	storage := NewInMemoryStorage()
+	require.NoError(t, storage.SaveStatement(Statement{
+		ID: "allow-moderators", Effect: EffectAllow,
+		Principals: []Principal{"roles/moderator"}, Actions: []ActionID{"read"}, Resources: []Resource{"*"},
+	}))
+	resolver := NewInMemoryPrincipalResolver()
+	resolver.AddRoleMapping("users/mark", []Principal{"roles/moderator"})
+	logger := &recordingDecisionLogger{}
+	evaluator := NewExpandingEvaluator(NewEvaluator(storage), resolver, WithDecisionLogger(logger))
+
+	resp, err := evaluator.Evaluate(Request{Principal: "users/mark", Action: "read", Resource: "doc"})
+	require.NoError(t, err)
+	assert.Equal(t, EffectAllow, resp.Effect)
+
+	require.Len(t, logger.decisions, 1)
+	decision := logger.decisions[0]
+	assert.Equal(t, resp.DecisionID, decision.ID)
+	assert.Equal(t, DecisionSourceExpandingEvaluator, decision.Source)
+	assert.Equal(t, []Principal{"users/mark", "roles/moderator"}, decision.Principals)
+	assert.Equal(t, "allow-moderators", decision.StatementID)
+}
+
+func TestRemoteAuthorizer_DecisionLogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Response{Effect: EffectAllow, Decider: stringPtr("remote-stmt"), DecisionID: "server-id"})
+	}))
+	defer server.Close()
+
+	logger := &recordingDecisionLogger{}
+	authorizer := NewBetandbeatRemoteAuthorizer(server.URL, func() (string, error) { return "token", nil }, WithDecisionLogger(logger))
+
+	resp, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark", Action: "read", Resource: "doc"})
+	require.NoError(t, err)
+	assert.Equal(t, "server-id", resp.DecisionID)
+
+	require.Len(t, logger.decisions, 1)
+	decision := logger.decisions[0]
+	assert.Equal(t, "server-id", decision.ID)
+	assert.Equal(t, DecisionSourceRemote, decision.Source)
+	assert.Equal(t, "remote-stmt", decision.StatementID)
+}
+
+func TestJSONDecisionLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewJSONDecisionLogger(&buf, JSONDecisionLoggerConfig{RedactContextFields: []string{"request.ip"}})
+
+	req := Request{Principal: "users/mark", Action: "read", Resource: "doc"}
+	req.Context.Request.IP = "10.0.0.1"
+	req.Context.Request.UserAgent = "curl"
+	logger.LogDecision(Decision{
+		ID:          "d1",
+		Source:      DecisionSourceEvaluator,
+		Time:        time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC),
+		Request:     req,
+		Response:    Response{Effect: EffectAllow, Message: "allowed", DecisionID: "d1"},
+		StatementID: "allow-read",
+		Latency:     1500 * time.Microsecond,
+	})
+	logger.LogDecision(Decision{ID: "d2", Response: Response{Effect: EffectDeny}, Err: errors.New("boom")})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "d1", record["decisionId"])
+	assert.Equal(t, "evaluator", record["source"])
+	assert.Equal(t, "allow-read", record["statementId"])
+	assert.Equal(t, 1.5, record["latencyMs"])
+	request := record["request"].(map[string]any)
+	assert.Equal(t, "users/mark", request["principal"])
+	context := request["context"].(map[string]any)["Request"].(map[string]any)
+	assert.Equal(t, "[REDACTED]", context["ip"])
+	assert.Equal(t, "curl", context["user_agent"])
+	assert.NotContains(t, buf.String(), "10.0.0.1")
+
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.Equal(t, "boom", record["error"])
+}
+
+func TestJSONDecisionLogger_Sampling(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewJSONDecisionLogger(&buf, JSONDecisionLoggerConfig{SampleRate: 0.25, AlwaysLogDenied: true})
+	draws := []float64{0.1, 0.5, 0.9, 0.2}
+	logger.random = func() float64 {
+		draw := draws[0]
+		draws = draws[1:]
+		return draw
+	}
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		logger.LogDecision(Decision{ID: id, Response: Response{Effect: EffectAllow}})
+	}
+	logger.LogDecision(Decision{ID: "denied", Response: Response{Effect: EffectDeny}})
+
+	var ids []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record decisionRecord
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		ids = append(ids, record.DecisionID)
+	}
+	assert.Equal(t, []string{"a", "d", "denied"}, ids)
+}
@@ -0,0 +1,196 @@
+package authorization
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// EffectivePermissions is what a principal may do, see
+// ListEffectivePermissions.
+type EffectivePermissions struct {
+	Principal Principal `json:"principal"`
+	// Principals are the resolved principals whose statements apply.
+	Principals  []Principal  `json:"principals"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// Permission is an allow statement applying to a principal.
+type Permission struct {
+	StatementID string `json:"statementId"`
+	// Principal is the resolved principal the statement applies to.
+	Principal Principal  `json:"principal"`
+	Actions   []ActionID `json:"actions"`
+	Resources []Resource `json:"resources"`
+	// Conditions must hold for the permission to apply.
+	Conditions []Condition `json:"conditions,omitempty"`
+	// Except are the parts of the permission denied by deny statements.
+	Except []PermissionException `json:"except,omitempty"`
+}
+
+// PermissionException is the part of a Permission a deny statement carves
+// out: its actions and resources overlapping the permission's.
+type PermissionException struct {
+	StatementID string `json:"statementId"`
+	// Principal is the resolved principal the deny statement applies to.
+	Principal Principal  `json:"principal"`
+	Actions   []ActionID `json:"actions"`
+	Resources []Resource `json:"resources"`
+	// Conditions must hold for the exception to apply.
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// ListEffectivePermissions returns the effective permissions of principal:
+// the allow statements of the principals it resolves to, ordered by
+// statement ID and principal, less what their deny statements carve out. A
+// statement reached through several principals is listed for each, as its
+// conditions may depend on the principal. Permissions
+// entirely denied without conditions are left out; partially denied ones
+// list the denied part in Except. resolver may be nil.
+//
+// Patterns are compared by matching one against the other, so two patterns
+// overlapping only partially, such as "users/a*" and "users/*z", are not
+// recognized as overlapping.
+func ListEffectivePermissions(storage Storage, resolver PrincipalResolver, principal Principal) (*EffectivePermissions, error) {
+	principals := []Principal{principal}
+	if resolver != nil {
+		resolved, err := resolver.ResolvePrincipals(principal)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve principals: %w", err)
+		}
+		principals = resolved
+	}
+
+	var allows, denies []Permission
+	seen := make(map[statementPrincipal]bool)
+	for _, p := range principals {
+		statements, err := storage.ListStatementsByPrincipal(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list statements: %w", err)
+		}
+		for _, stmt := range statements {
+			// Storages may list statements loosely; keep those the evaluator
+			// would apply.
+			key := statementPrincipal{stmt.ID, p}
+			if seen[key] || !principalMatches(stmt.Principals, p) {
+				continue
+			}
+			seen[key] = true
+			permission := Permission{
+				StatementID: stmt.ID,
+				Principal:   p,
+				Actions:     stmt.Actions,
+				Resources:   stmt.Resources,
+				Conditions:  stmt.Conditions,
+			}
+			if stmt.Effect == EffectDeny {
+				denies = append(denies, permission)
+			} else {
+				allows = append(allows, permission)
+			}
+		}
+	}
+
+	permissions := make([]Permission, 0, len(allows))
+	for _, allow := range allows {
+		denied := false
+		for _, deny := range denies {
+			exception, ok := carveOut(allow, deny)
+			if !ok {
+				continue
+			}
+			if len(deny.Conditions) == 0 && coversAll(deny.Actions, allow.Actions) && coversAll(deny.Resources, allow.Resources) {
+				denied = true
+				break
+			}
+			allow.Except = append(allow.Except, exception)
+		}
+		if !denied {
+			permissions = append(permissions, allow)
+		}
+	}
+	sort.Slice(permissions, func(i, j int) bool {
+		if permissions[i].StatementID != permissions[j].StatementID {
+			return permissions[i].StatementID < permissions[j].StatementID
+		}
+		return permissions[i].Principal < permissions[j].Principal
+	})
+	return &EffectivePermissions{Principal: principal, Principals: principals, Permissions: permissions}, nil
+}
+
+// statementPrincipal identifies a statement applied to one of the resolved
+// principals.
+type statementPrincipal struct {
+	statementID string
+	principal   Principal
+}
+
+// carveOut returns the part of allow that deny overlaps, if any.
+func carveOut(allow, deny Permission) (PermissionException, bool) {
+	actions := overlappingPatterns(allow.Actions, deny.Actions)
+	resources := overlappingPatterns(allow.Resources, deny.Resources)
+	if len(actions) == 0 || len(resources) == 0 {
+		return PermissionException{}, false
+	}
+	return PermissionException{
+		StatementID: deny.StatementID,
+		Principal:   deny.Principal,
+		Actions:     actions,
+		Resources:   resources,
+		Conditions:  deny.Conditions,
+	}, true
+}
+
+// overlappingPatterns returns, for each pair of overlapping patterns, the
+// narrower one.
+func overlappingPatterns[T ~string](patterns, others []T) []T {
+	var overlap []T
+	seen := make(map[T]bool)
+	for _, p := range patterns {
+		for _, o := range others {
+			var narrower T
+			switch {
+			case patternCovers(p, o):
+				narrower = o
+			case patternCovers(o, p):
+				narrower = p
+			default:
+				continue
+			}
+			if !seen[narrower] {
+				seen[narrower] = true
+				overlap = append(overlap, narrower)
+			}
+		}
+	}
+	return overlap
+}
+
+// coversAll reports whether every pattern of others is covered by one of
+// patterns.
+func coversAll[T ~string](patterns, others []T) bool {
+	for _, o := range others {
+		covered := false
+		for _, p := range patterns {
+			if patternCovers(p, o) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// patternCovers reports whether pattern matches everything other matches,
+// as far as matching other as a literal tells.
+func patternCovers[T ~string](pattern, other T) bool {
+	if pattern == other {
+		return true
+	}
+	matched, _ := doublestar.Match(enhancePattern(string(pattern)), string(other))
+	return matched
+}
@@ -0,0 +1,79 @@
+package authorization
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListEffectivePermissions(t *testing.T) {
+	storage := newTestStorage(t, []Statement{
+		{ID: "admins", Effect: EffectAllow, Principals: []Principal{"roles/admin"}, Actions: []ActionID{"iam:*"}, Resources: []Resource{"users/*"}},
+		{ID: "bets", Effect: EffectAllow, Principals: []Principal{"users/alice"}, Actions: []ActionID{"bets:read", "bets:create"}, Resources: []Resource{"bets/*"},
+			Conditions: []Condition{{Name: "office", Expression: `context.Request.IP startsWith "10."`}}},
+		{ID: "legacy", Effect: EffectAllow, Principals: []Principal{"users/alice"}, Actions: []ActionID{"legacy:read"}, Resources: []Resource{"legacy/*"}},
+		{ID: "others", Effect: EffectAllow, Principals: []Principal{"users/bob"}, Actions: []ActionID{"*"}, Resources: []Resource{"*"}},
+		{ID: "protect-root", Effect: EffectDeny, Principals: []Principal{"roles/admin"}, Actions: []ActionID{"iam:DeleteUser"}, Resources: []Resource{"users/root"}},
+		{ID: "no-legacy", Effect: EffectDeny, Principals: []Principal{"users/*"}, Actions: []ActionID{"legacy:*"}, Resources: []Resource{"*"}},
+		{ID: "night", Effect: EffectDeny, Principals: []Principal{"users/alice"}, Actions: []ActionID{"bets:create"}, Resources: []Resource{"**"},
+			Conditions: []Condition{{Name: "night", Expression: `context.Request.At.Hour() < 6`}}},
+	}...)
+	resolver := NewInMemoryPrincipalResolver()
+	resolver.AddRoleMapping("users/alice", []Principal{"roles/admin"})
+
+	permissions, err := ListEffectivePermissions(storage, resolver, "users/alice")
+	require.NoError(t, err)
+	assert.Equal(t, []Principal{"users/alice", "roles/admin"}, permissions.Principals)
+	assert.Equal(t, []Permission{
+		{
+			StatementID: "admins",
+			Principal:   "roles/admin",
+			Actions:     []ActionID{"iam:*"},
+			Resources:   []Resource{"users/*"},
+			Except: []PermissionException{
+				{StatementID: "protect-root", Principal: "roles/admin", Actions: []ActionID{"iam:DeleteUser"}, Resources: []Resource{"users/root"}},
+			},
+		},
+		{
+			StatementID: "bets",
+			Principal:   "users/alice",
+			Actions:     []ActionID{"bets:read", "bets:create"},
+			Resources:   []Resource{"bets/*"},
+			Conditions:  []Condition{{Name: "office", Expression: `context.Request.IP startsWith "10."`}},
+			Except: []PermissionException{
+				{StatementID: "night", Principal: "users/alice", Actions: []ActionID{"bets:create"}, Resources: []Resource{"bets/*"},
+					Conditions: []Condition{{Name: "night", Expression: `context.Request.At.Hour() < 6`}}},
+			},
+		},
+	}, permissions.Permissions, "legacy is denied entirely, bob's statement does not apply")
+
+	data, err := json.Marshal(permissions)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"except":[{"statementId":"protect-root","principal":"roles/admin","actions":["iam:DeleteUser"],"resources":["users/root"]}]`)
+
+	permissions, err = ListEffectivePermissions(storage, nil, "users/carol")
+	require.NoError(t, err)
+	assert.Empty(t, permissions.Permissions)
+	assert.Equal(t, []Principal{"users/carol"}, permissions.Principals)
+}
+
+func TestListEffectivePermissions_PrincipalConditions(t *testing.T) {
+	storage := NewInMemoryStorage()
+	require.NoError(t, storage.SaveStatement(Statement{
+		ID: "editors", Effect: EffectAllow, Principals: []Principal{"**"}, Actions: []ActionID{"docs:edit"}, Resources: []Resource{"docs/*"},
+		Conditions: []Condition{{Name: "editor", Expression: `string(principal) == "roles/editor"`}},
+	}))
+	resolver := NewInMemoryPrincipalResolver()
+	resolver.AddRoleMapping("users/mark", []Principal{"roles/editor"})
+
+	permissions, err := ListEffectivePermissions(storage, resolver, "users/mark")
+	require.NoError(t, err)
+	var principals []Principal
+	for _, permission := range permissions.Permissions {
+		assert.Equal(t, "editors", permission.StatementID)
+		principals = append(principals, permission.Principal)
+	}
+	assert.Equal(t, []Principal{"roles/editor", "users/mark"}, principals, "the statement applies to each principal with its own conditions")
+}
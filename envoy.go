@@ -0,0 +1,147 @@
+package authorization
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// envoyDecisionIDHeader carries the decision ID in check responses, to be
+	// listed in Envoy's allowed_upstream_headers and allowed_client_headers.
+	envoyDecisionIDHeader = "X-Authz-Decision-Id"
+	// envoyPrincipalHeader passes the authorized principal upstream.
+	envoyPrincipalHeader = "X-Authz-Principal"
+)
+
+// EnvoyExtAuthzConfig configures NewEnvoyExtAuthzHandler.
+type EnvoyExtAuthzConfig struct {
+	// Routes map the original requests to actions and resources. Requests
+	// matching no route are denied.
+	Routes []Route
+	// PathPrefix is the path_prefix of Envoy's http_service, removed from the
+	// path before matching routes.
+	PathPrefix string
+	// Principal extracts the principal from the check request. Defaults to
+	// the X-Authz-Principal header, e.g. set by Envoy's jwt_authn filter with
+	// claim_to_headers.
+	Principal PrincipalExtractor
+	// SourceIPHeader holds the client IP appended by Envoy, which must list it
+	// in allowed_headers. The last address is used. Defaults to
+	// X-Forwarded-For; the peer address is used without it.
+	SourceIPHeader string
+	// OnError is called with the error when identifying the principal of a
+	// check request fails, which is answered with a generic 401, or when
+	// evaluating it fails, which is answered with a generic 500. The reasons
+	// for denials are recorded by the evaluator's DecisionLogger under the
+	// decision ID returned in X-Authz-Decision-Id.
+	OnError func(r *http.Request, err error)
+}
+
+type envoyExtAuthzHandler struct {
+	evaluator Evaluator
+	config    EnvoyExtAuthzConfig
+	routes    *routeMatcher
+	now       func() time.Time
+}
+
+// NewEnvoyExtAuthzHandler creates the authorization service of Envoy's
+// ext_authz HTTP filter. Envoy forwards the method, path and headers of
+// each request; the handler answers 200 OK to allow it, with the principal
+// and decision ID in the X-Authz-Principal and X-Authz-Decision-Id headers,
+// 401 Unauthorized without a principal and 403 Forbidden to deny it. A
+// failing evaluator results in 500, which Envoy's failure_mode_allow decides
+// on. Responses do not reveal the statements or errors behind a decision. It
+// panics if a route pattern is invalid.
+func NewEnvoyExtAuthzHandler(evaluator Evaluator, config EnvoyExtAuthzConfig) http.Handler {
+	if config.Principal == nil {
+		config.Principal = PrincipalFromHeader(envoyPrincipalHeader)
+	}
+	if config.SourceIPHeader == "" {
+		config.SourceIPHeader = "X-Forwarded-For"
+	}
+	return &envoyExtAuthzHandler{
+		evaluator: evaluator,
+		config:    config,
+		routes:    newRouteMatcher(config.Routes),
+		now:       time.Now,
+	}
+}
+
+func (h *envoyExtAuthzHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	original := r.Clone(r.Context())
+	original.URL.Path = trimPathPrefix(r.URL.Path, h.config.PathPrefix)
+	original.URL.RawPath = ""
+	action, resource, ok := h.routes.match(original)
+	if !ok {
+		writeProblem(w, http.StatusForbidden, fmt.Sprintf("no route for %s %s", r.Method, original.URL.Path))
+		return
+	}
+
+	principal, err := h.config.Principal(r)
+	if err != nil {
+		if !errors.Is(err, ErrNoPrincipal) && h.config.OnError != nil {
+			h.config.OnError(r, fmt.Errorf("failed to identify principal: %w", err))
+		}
+		writeProblem(w, http.StatusUnauthorized, "missing or invalid principal")
+		return
+	}
+
+	req := Request{Principal: principal, Action: action, Resource: resource}
+	req.Context.Request.At = h.now()
+	req.Context.Request.IP = h.sourceIP(r)
+	req.Context.Request.UserAgent = r.UserAgent()
+
+	resp, err := evaluateWithContext(r.Context(), h.evaluator, req)
+	if resp.DecisionID != "" {
+		w.Header().Set(envoyDecisionIDHeader, resp.DecisionID)
+	}
+	if err != nil {
+		if h.config.OnError != nil {
+			h.config.OnError(r, fmt.Errorf("failed to authorize %s on %s: %w", action, resource, err))
+		}
+		writeProblem(w, http.StatusInternalServerError, "authorization failed")
+		return
+	}
+	if !resp.Allowed() {
+		writeProblem(w, http.StatusForbidden, "access denied")
+		return
+	}
+	w.Header().Set(envoyPrincipalHeader, string(principal))
+	w.WriteHeader(http.StatusOK)
+}
+
+// sourceIP returns the last address of the source IP header, the one Envoy
+// appended, or the peer address.
+func (h *envoyExtAuthzHandler) sourceIP(r *http.Request) string {
+	if values := r.Header.Values(h.config.SourceIPHeader); len(values) > 0 {
+		addresses := strings.Split(values[len(values)-1], ",")
+		if ip := strings.TrimSpace(addresses[len(addresses)-1]); net.ParseIP(ip) != nil {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// trimPathPrefix removes prefix from path when it ends at a segment boundary,
+// so "/authz" is removed from "/authz/bets" but not from "/authzbets".
+func trimPathPrefix(path, prefix string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return path
+	}
+	if path == prefix {
+		return "/"
+	}
+	if rest, ok := strings.CutPrefix(path, prefix+"/"); ok {
+		return "/" + rest
+	}
+	return path
+}
@@ -0,0 +1,166 @@
+package authorization
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEnvoyTestHandler(t *testing.T, evaluator Evaluator) http.Handler {
+	t.Helper()
+	if evaluator == nil {
+		storage := NewInMemoryStorage()
+		require.NoError(t, storage.SaveStatement(Statement{
+			ID:         "bettors",
+			Active:     true,
+			Effect:     EffectAllow,
+			Principals: []Principal{"users/alice"},
+			Actions:    []ActionID{"bets:*"},
+			Resources:  []Resource{"bets/*", "bets/*/legs/**"},
+			Conditions: []Condition{{Name: "office", Expression: `context.Request.IP == "203.0.113.7"`}},
+		}))
+		evaluator = NewEvaluator(storage)
+	}
+	return NewEnvoyExtAuthzHandler(evaluator, EnvoyExtAuthzConfig{
+		PathPrefix: "/authz",
+		Routes: []Route{
+			{Pattern: "GET /bets/{id}", Action: "bets:read", Resource: "bets/{id}"},
+			{Pattern: "DELETE /bets/{id}", Action: "bets:cancel", Resource: "bets/{id}"},
+			{Pattern: "GET /bets/{id}/legs/{rest...}", Action: "bets:read", Resource: "bets/{id}/legs/{rest}"},
+			{Pattern: "GET /accounts/{id}", Action: "accounts:read", Resource: "accounts/{id}"},
+		},
+	})
+}
+
+func envoyCheck(handler http.Handler, method, path, principal string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "10.0.0.2:5555"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7")
+	if principal != "" {
+		req.Header.Set("X-Authz-Principal", principal)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestEnvoyExtAuthzHandler(t *testing.T) {
+	handler := newEnvoyTestHandler(t, nil)
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		principal string
+		status    int
+	}{
+		{name: "allowed", method: http.MethodGet, path: "/authz/bets/42", principal: "users/alice", status: http.StatusOK},
+		{name: "remaining wildcard", method: http.MethodGet, path: "/authz/bets/42/legs/1/odds", principal: "users/alice", status: http.StatusOK},
+		{name: "other method", method: http.MethodDelete, path: "/authz/bets/42", principal: "users/alice", status: http.StatusOK},
+		{name: "other principal", method: http.MethodGet, path: "/authz/bets/42", principal: "users/bob", status: http.StatusForbidden},
+		{name: "other resource", method: http.MethodGet, path: "/authz/accounts/1", principal: "users/alice", status: http.StatusForbidden},
+		{name: "no route", method: http.MethodPost, path: "/authz/bets/42", principal: "users/alice", status: http.StatusForbidden},
+		{name: "prefix without segment boundary", method: http.MethodGet, path: "/authzbets/42", principal: "users/alice", status: http.StatusForbidden},
+		{name: "no principal", method: http.MethodGet, path: "/authz/bets/42", status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := envoyCheck(handler, tt.method, tt.path, tt.principal)
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			if tt.status == http.StatusOK {
+				assert.Equal(t, tt.principal, rec.Header().Get("X-Authz-Principal"))
+			} else {
+				assert.Empty(t, rec.Header().Get("X-Authz-Principal"))
+				assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestEnvoyExtAuthzHandler_Request(t *testing.T) {
+	var got Request
+	handler := newEnvoyTestHandler(t, evaluatorFunc(func(req Request) (Response, error) {
+		got = req
+		return Response{Effect: EffectAllow, DecisionID: "d1"}, nil
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/authz/bets/7/legs/2", nil)
+	req.RemoteAddr = "10.0.0.2:5555"
+	req.Header.Set("X-Authz-Principal", "users/alice")
+	req.Header.Set("User-Agent", "bettor/1.0")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "d1", rec.Header().Get("X-Authz-Decision-Id"))
+	assert.Equal(t, Principal("users/alice"), got.Principal)
+	assert.Equal(t, ActionID("bets:read"), got.Action)
+	assert.Equal(t, Resource("bets/7/legs/2"), got.Resource)
+	assert.Equal(t, "10.0.0.2", got.Context.Request.IP, "the peer address is used without X-Forwarded-For")
+	assert.Equal(t, "bettor/1.0", got.Context.Request.UserAgent)
+	assert.False(t, got.Context.Request.At.IsZero())
+}
+
+func TestEnvoyExtAuthzHandler_EvaluatorError(t *testing.T) {
+	var logged error
+	handler := NewEnvoyExtAuthzHandler(evaluatorFunc(func(req Request) (Response, error) {
+		return Response{Effect: EffectDeny}, errors.New("database is down")
+	}), EnvoyExtAuthzConfig{
+		Routes:  []Route{{Pattern: "GET /bets/{id}", Action: "bets:read", Resource: "bets/{id}"}},
+		OnError: func(r *http.Request, err error) { logged = err },
+	})
+	rec := envoyCheck(handler, http.MethodGet, "/bets/42", "users/alice")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "database", "errors are not revealed")
+	assert.ErrorContains(t, logged, "database is down", "errors are passed to OnError")
+}
+
+func TestEnvoyExtAuthzHandler_PrincipalError(t *testing.T) {
+	var logged []error
+	handler := NewEnvoyExtAuthzHandler(evaluatorFunc(func(req Request) (Response, error) {
+		return Response{Effect: EffectAllow}, nil
+	}), EnvoyExtAuthzConfig{
+		Routes: []Route{{Pattern: "GET /bets/{id}", Action: "bets:read", Resource: "bets/{id}"}},
+		Principal: func(r *http.Request) (Principal, error) {
+			if r.Header.Get("Authorization") == "" {
+				return "", ErrNoPrincipal
+			}
+			return "", errors.New("token signed by unknown key k-internal-7")
+		},
+		OnError: func(r *http.Request, err error) { logged = append(logged, err) },
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/bets/42", nil)
+	req.Header.Set("Authorization", "Bearer forged")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), "missing or invalid principal")
+	assert.NotContains(t, rec.Body.String(), "k-internal-7", "errors are not revealed")
+	require.Len(t, logged, 1)
+	assert.ErrorContains(t, logged[0], "k-internal-7", "errors are passed to OnError")
+
+	rec = envoyCheck(handler, http.MethodGet, "/bets/42", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Len(t, logged, 1, "a missing principal is not an error")
+}
+
+func TestEnvoyExtAuthzHandler_DenialDoesNotRevealPolicy(t *testing.T) {
+	handler := newEnvoyTestHandler(t, evaluatorFunc(func(req Request) (Response, error) {
+		return Response{Effect: EffectDeny, Message: "denied by statement protect-vip-bets", DecisionID: "d1"}, nil
+	}))
+	rec := envoyCheck(handler, http.MethodGet, "/authz/bets/42", "users/alice")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "protect-vip-bets")
+	assert.Equal(t, "d1", rec.Header().Get("X-Authz-Decision-Id"), "the decision ID leads to the decision log")
+}
+
+type evaluatorFunc func(req Request) (Response, error)
+
+func (f evaluatorFunc) Evaluate(req Request) (Response, error) {
+	return f(req)
+}
@@ -1,7 +1,9 @@
 package authorization
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/bmatcuk/doublestar/v4"
 )
@@ -11,26 +13,97 @@ type Evaluator interface {
 }
 
 type evaluator struct {
-	storage Storage
+	storage        Storage
+	asOf           time.Time
+	decisionLogger DecisionLogger
+	tracer         Tracer
+	// onConditionError is called for every condition that fails to evaluate.
+	onConditionError func(stmt Statement, err error)
 }
 
-func NewEvaluator(storage Storage) Evaluator {
-	return &evaluator{
+// EvaluatorOption configures an evaluator created by NewEvaluator.
+type EvaluatorOption interface {
+	applyEvaluator(e *evaluator)
+}
+
+type evaluatorOptionFunc func(e *evaluator)
+
+func (f evaluatorOptionFunc) applyEvaluator(e *evaluator) {
+	f(e)
+}
+
+// WithPointInTime evaluates requests against the policy as it was at the given
+// time, which requires a storage implementing StatementHistory. Requests
+// without Context.Request.At are evaluated as if they were made at that time.
+func WithPointInTime(at time.Time) EvaluatorOption {
+	return evaluatorOptionFunc(func(e *evaluator) {
+		e.asOf = at
+	})
+}
+
+func NewEvaluator(storage Storage, opts ...EvaluatorOption) Evaluator {
+	e := &evaluator{
 		storage: storage,
 	}
+	for _, opt := range opts {
+		opt.applyEvaluator(e)
+	}
+	return e
 }
 
 func (e *evaluator) Evaluate(req Request) (Response, error) {
-	statements, err := e.storage.ListStatementsByPrincipal(req.Principal)
+	return e.evaluateContext(context.Background(), req)
+}
+
+func (e *evaluator) evaluateContext(ctx context.Context, req Request) (Response, error) {
+	if !e.asOf.IsZero() && req.Context.Request.At.IsZero() {
+		req.Context.Request.At = e.asOf
+	}
+	ctx, span := startSpan(ctx, e.tracer, SpanEvaluate)
+	defer span.End()
+	setRequestAttributes(span, req)
+
+	start := time.Now()
+	resp, stmt, err := e.evaluate(ctx, req)
+	setResponseAttributes(span, resp, err)
+	if e.decisionLogger == nil {
+		return resp, err
+	}
+
+	resp.DecisionID = newDecisionID()
+	decision := Decision{
+		ID:        resp.DecisionID,
+		Source:    DecisionSourceEvaluator,
+		Time:      start,
+		Request:   req,
+		Response:  resp,
+		Statement: stmt,
+		Latency:   time.Since(start),
+		Err:       err,
+	}
+	if stmt != nil {
+		decision.StatementID = stmt.ID
+	}
+	e.decisionLogger.LogDecision(decision)
+	return resp, err
+}
+
+// evaluate decides the request and returns the deciding statement, if any.
+func (e *evaluator) evaluate(ctx context.Context, req Request) (Response, *Statement, error) {
+	statements, err := e.listStatements(ctx, req.Principal)
 	if err != nil {
-		return Response{}, fmt.Errorf("failed to list statements: %w", err)
+		return Response{}, nil, fmt.Errorf("failed to list statements: %w", err)
 	}
+	return e.decide(ctx, statements, req)
+}
 
+// decide decides the request with the statements listed for its principal.
+func (e *evaluator) decide(ctx context.Context, statements []Statement, req Request) (Response, *Statement, error) {
 	if len(statements) == 0 {
 		return Response{
 			Effect:  EffectDeny,
 			Message: "no applicable statements found, access denied by default",
-		}, nil
+		}, nil, nil
 	}
 
 	// Separate statements by effect for clear processing order.
@@ -40,29 +113,31 @@ func (e *evaluator) Evaluate(req Request) (Response, error) {
 	// Deny statements have the highest precedence. If any deny statement
 	// matches, we deny the request immediately.
 	for _, stmt := range denyStatements {
-		matches, err := statementMatches(stmt, req)
+		matches, err := e.statementMatches(ctx, stmt, req)
 		if err != nil {
+			e.conditionError(stmt, err)
 			// It's safer to deny if a condition evaluation fails.
 			return Response{
 				Effect:  EffectDeny,
 				Message: fmt.Sprintf("failed to evaluate condition for deny statement %q: %s", stmt.ID, err),
 				Decider: &stmt.ID,
-			}, nil
+			}, &stmt, nil
 		}
 		if matches {
 			return Response{
 				Effect:  EffectDeny,
 				Message: fmt.Sprintf("denied by statement %q", stmt.ID),
 				Decider: &stmt.ID,
-			}, nil
+			}, &stmt, nil
 		}
 	}
 
 	// If no deny statements matched, we check for allow statements.
 	// A single matching allow statement is sufficient to grant access.
 	for _, stmt := range allowStatements {
-		matches, err := statementMatches(stmt, req)
+		matches, err := e.statementMatches(ctx, stmt, req)
 		if err != nil {
+			e.conditionError(stmt, err)
 			// Log the error but don't deny, as other allow statements might still match.
 			// A failed condition in an allow statement is treated as a non-match.
 			fmt.Printf("skipping allow statement %q due to condition error: %s\n", stmt.ID, err)
@@ -73,7 +148,7 @@ func (e *evaluator) Evaluate(req Request) (Response, error) {
 				Effect:  EffectAllow,
 				Message: fmt.Sprintf("allowed by statement %q", stmt.ID),
 				Decider: &stmt.ID,
-			}, nil
+			}, &stmt, nil
 		}
 	}
 
@@ -81,7 +156,37 @@ func (e *evaluator) Evaluate(req Request) (Response, error) {
 	return Response{
 		Effect:  EffectDeny,
 		Message: "no matching statement found, access denied by default",
-	}, nil
+	}, nil, nil
+}
+
+func (e *evaluator) conditionError(stmt Statement, err error) {
+	if e.onConditionError != nil {
+		e.onConditionError(stmt, err)
+	}
+}
+
+func (e *evaluator) listStatements(ctx context.Context, principal Principal) ([]Statement, error) {
+	_, span := startSpan(ctx, e.tracer, SpanListStatements)
+	defer span.End()
+	span.SetAttribute("authz.principal", string(principal))
+
+	statements, err := e.listStatementsAt(principal)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.SetAttribute("authz.statement_count", len(statements))
+	return statements, err
+}
+
+func (e *evaluator) listStatementsAt(principal Principal) ([]Statement, error) {
+	if e.asOf.IsZero() {
+		return e.storage.ListStatementsByPrincipal(principal)
+	}
+	history, ok := e.storage.(StatementHistory)
+	if !ok {
+		return nil, fmt.Errorf("storage %T does not support point-in-time evaluation: %w", e.storage, ErrNotSupported)
+	}
+	return history.ListStatementsByPrincipalAt(principal, e.asOf)
 }
 
 func enhancePattern(pattern string) string {
@@ -93,7 +198,7 @@ func enhancePattern(pattern string) string {
 
 // statementMatches checks if a statement's principals, actions, resources, and conditions
 // are all satisfied by the request.
-func statementMatches(stmt Statement, req Request) (bool, error) {
+func (e *evaluator) statementMatches(ctx context.Context, stmt Statement, req Request) (bool, error) {
 	if !principalMatches(stmt.Principals, req.Principal) {
 		return false, nil
 	}
@@ -106,7 +211,7 @@ func statementMatches(stmt Statement, req Request) (bool, error) {
 		return false, nil
 	}
 
-	conditionsMet, err := allConditionsMet(stmt.Conditions, req)
+	conditionsMet, err := e.allConditionsMet(ctx, stmt, req)
 	if err != nil {
 		return false, err
 	}
@@ -146,9 +251,9 @@ func principalMatches(principals []Principal, requestedPrincipal Principal) bool
 
 // allConditionsMet evaluates all conditions in a statement against the request.
 // It returns true only if all conditions pass.
-func allConditionsMet(conditions []Condition, req Request) (bool, error) {
-	for _, c := range conditions {
-		met, err := c.Evaluate(req)
+func (e *evaluator) allConditionsMet(ctx context.Context, stmt Statement, req Request) (bool, error) {
+	for _, c := range stmt.Conditions {
+		met, err := e.evaluateCondition(ctx, stmt, c, req)
 		if err != nil {
 			return false, fmt.Errorf("failed to evaluate condition %q: %w", c.Name, err)
 		}
@@ -159,6 +264,22 @@ func allConditionsMet(conditions []Condition, req Request) (bool, error) {
 	return true, nil
 }
 
+// evaluateCondition evaluates a single condition in its own span.
+func (e *evaluator) evaluateCondition(ctx context.Context, stmt Statement, c Condition, req Request) (bool, error) {
+	_, span := startSpan(ctx, e.tracer, SpanCondition)
+	defer span.End()
+	span.SetAttribute("authz.statement_id", stmt.ID)
+	span.SetAttribute("authz.condition", c.Name)
+
+	met, err := c.Evaluate(req)
+	if err != nil {
+		span.RecordError(err)
+	} else {
+		span.SetAttribute("authz.condition_met", met)
+	}
+	return met, err
+}
+
 // filterStatementsByEffect is a utility to get statements of a specific effect.
 func filterStatementsByEffect(statements []Statement, effect Effect) []Statement {
 	var filtered []Statement
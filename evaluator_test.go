@@ -161,12 +161,12 @@ func TestEvaluator_Evaluate(t *testing.T) {
 					Principals: []Principal{user1},
 					Actions:    []ActionID{readAction},
 					Resources:  []Resource{doc1},
-					Conditions: []Condition{{Name: "BadCond", Expression: `invalid syntax`}},
+					Conditions: []Condition{{Name: "BadCond", Expression: `int("not a number") > 0`}},
 				},
 			},
 			request:        Request{Principal: user1, Action: readAction, Resource: doc1},
 			expectedEffect: EffectDeny,
-			expectedMsg:    "failed to evaluate condition for deny statement \"deny-bad-cond\": failed to evaluate condition \"BadCond\": unexpected token",
+			expectedMsg:    "failed to evaluate condition for deny statement \"deny-bad-cond\": failed to evaluate condition \"BadCond\": invalid operation",
 		},
 		{
 			name: "Allow Skips on Condition Error: Non-matching, default deny",
@@ -177,7 +177,7 @@ func TestEvaluator_Evaluate(t *testing.T) {
 					Principals: []Principal{user1},
 					Actions:    []ActionID{readAction},
 					Resources:  []Resource{doc1},
-					Conditions: []Condition{{Name: "BadCond", Expression: `invalid syntax`}},
+					Conditions: []Condition{{Name: "BadCond", Expression: `int("not a number") > 0`}},
 				},
 			},
 			request:        Request{Principal: user1, Action: readAction, Resource: doc1},
@@ -0,0 +1,17 @@
+package authorization
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestStorage returns an in-memory storage holding stmts.
+func newTestStorage(t *testing.T, stmts ...Statement) *inMemoryStorage {
+	t.Helper()
+	storage := NewInMemoryStorage()
+	for _, stmt := range stmts {
+		require.NoError(t, storage.SaveStatement(stmt))
+	}
+	return storage
+}
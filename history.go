@@ -0,0 +1,26 @@
+package authorization
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrVersionNotFound is returned when a statement has no version with the
+// requested revision, or that version is a deletion.
+var ErrVersionNotFound = errors.New("statement version not found")
+
+// StatementHistory is implemented by storages that retain every change of
+// every statement as an immutable version, recorded as a ChangeEvent with the
+// acting principal and time.
+type StatementHistory interface {
+	// ListStatementVersions returns all versions of the statement, oldest
+	// first, including deletions. It returns ErrStatementNotFound if the
+	// statement never existed.
+	ListStatementVersions(id string) ([]ChangeEvent, error)
+	// RestoreStatementVersion saves the statement as it was at the given
+	// revision, subject to opts, creating a new version.
+	RestoreStatementVersion(id string, revision uint64, opts WriteOptions) (Statement, error)
+	// ListStatementsByPrincipalAt is ListStatementsByPrincipal against the
+	// statements as they were at the given time.
+	ListStatementsByPrincipalAt(principal Principal, at time.Time) ([]Statement, error)
+}
@@ -0,0 +1,107 @@
+package authorization
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryStorage_Versions(t *testing.T) {
+	storage := NewInMemoryStorage()
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	storage.now = func() time.Time { return now }
+
+	stmt, err := storage.SaveStatementWithOptions(Statement{ID: "a", Effect: EffectAllow, Description: "v1"}, WriteOptions{Actor: "users/alice"})
+	require.NoError(t, err)
+	now = now.Add(time.Hour)
+	stmt.Description = "v2"
+	_, err = storage.SaveStatementWithOptions(stmt, WriteOptions{Actor: "users/bob"})
+	require.NoError(t, err)
+	now = now.Add(time.Hour)
+	require.NoError(t, storage.DeleteStatementWithOptions("a", WriteOptions{Actor: "users/carol"}))
+
+	versions, err := storage.ListStatementVersions("a")
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, []ChangeType{ChangePut, ChangePut, ChangeDelete}, []ChangeType{versions[0].Type, versions[1].Type, versions[2].Type})
+	assert.Equal(t, "v1", versions[0].Statement.Description)
+	assert.Equal(t, "users/alice", versions[0].Actor)
+	assert.Equal(t, "v2", versions[1].Statement.Description)
+	assert.Equal(t, "users/bob", versions[1].Actor)
+	assert.Equal(t, "users/carol", versions[2].Actor)
+	assert.Equal(t, now, versions[2].At)
+
+	_, err = storage.ListStatementVersions("missing")
+	assert.ErrorIs(t, err, ErrStatementNotFound)
+
+	// Restoring the first version recreates the deleted statement as a new version.
+	restored, err := storage.RestoreStatementVersion("a", versions[0].Revision, WriteOptions{Actor: "users/dave", IfNotExists: true})
+	require.NoError(t, err)
+	assert.Equal(t, "v1", restored.Description)
+	assert.Equal(t, uint64(4), restored.Revision)
+	assert.Equal(t, "users/dave", restored.UpdatedBy)
+
+	versions, err = storage.ListStatementVersions("a")
+	require.NoError(t, err)
+	assert.Len(t, versions, 4)
+
+	_, err = storage.RestoreStatementVersion("a", 3, WriteOptions{})
+	assert.ErrorIs(t, err, ErrVersionNotFound, "a deletion cannot be restored")
+	_, err = storage.RestoreStatementVersion("a", 99, WriteOptions{})
+	assert.ErrorIs(t, err, ErrVersionNotFound)
+}
+
+func TestEvaluator_PointInTime(t *testing.T) {
+	storage := NewInMemoryStorage()
+	monday := time.Date(2025, 6, 30, 9, 0, 0, 0, time.UTC)
+	tuesday := monday.AddDate(0, 0, 1)
+	wednesday := monday.AddDate(0, 0, 2)
+
+	storage.now = func() time.Time { return monday }
+	require.NoError(t, storage.SaveStatement(Statement{
+		ID: "allow-delete", Effect: EffectAllow,
+		Principals: []Principal{"users/mark"}, Actions: []ActionID{"iam:DeleteUser"}, Resources: []Resource{"users/*"},
+	}))
+	storage.now = func() time.Time { return wednesday }
+	require.NoError(t, storage.DeleteStatement("allow-delete"))
+
+	req := Request{Principal: "users/mark", Action: "iam:DeleteUser", Resource: "users/johndoe"}
+
+	resp, err := NewEvaluator(storage).Evaluate(req)
+	require.NoError(t, err)
+	assert.Equal(t, EffectDeny, resp.Effect, "currently denied")
+
+	resp, err = NewEvaluator(storage, WithPointInTime(tuesday)).Evaluate(req)
+	require.NoError(t, err)
+	assert.Equal(t, EffectAllow, resp.Effect, "allowed last Tuesday")
+
+	resp, err = NewEvaluator(storage, WithPointInTime(monday.Add(-time.Hour))).Evaluate(req)
+	require.NoError(t, err)
+	assert.Equal(t, EffectDeny, resp.Effect, "not yet allowed before the statement existed")
+}
+
+func TestEvaluator_PointInTimeConditionsUseEvaluationTime(t *testing.T) {
+	storage := NewInMemoryStorage()
+	tuesday := time.Date(2025, 7, 1, 9, 0, 0, 0, time.UTC)
+	storage.now = func() time.Time { return tuesday.Add(-time.Hour) }
+	require.NoError(t, storage.SaveStatement(Statement{
+		ID: "weekdays", Effect: EffectAllow,
+		Principals: []Principal{"users/mark"}, Actions: []ActionID{"read"}, Resources: []Resource{"*"},
+		Conditions: []Condition{{Name: "Tuesday", Expression: `context.Request.At.Weekday().String() == "Tuesday"`}},
+	}))
+
+	resp, err := NewEvaluator(storage, WithPointInTime(tuesday)).Evaluate(Request{Principal: "users/mark", Action: "read", Resource: "doc"})
+	require.NoError(t, err)
+	assert.Equal(t, EffectAllow, resp.Effect)
+}
+
+func TestEvaluator_PointInTimeUnsupportedStorage(t *testing.T) {
+	_, err := NewEvaluator(&mockStorage{}, WithPointInTime(time.Now())).Evaluate(Request{Principal: "users/mark"})
+	assert.ErrorContains(t, err, "does not support point-in-time evaluation")
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	_, err = NewEvaluator(NewInstrumentedStorage(&mockStorage{}, NewPrometheusMetrics()), WithPointInTime(time.Now())).Evaluate(Request{Principal: "users/mark"})
+	assert.ErrorIs(t, err, ErrNotSupported, "the instrumented storage does not pretend to keep history")
+}
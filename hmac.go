@@ -0,0 +1,250 @@
+package authorization
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hmacScheme is the Authorization scheme of HMAC signed requests:
+//
+//	Authorization: AUTHZ-HMAC-SHA256 keyId=<id>,timestamp=<unix>,nonce=<hex>,signature=<base64>
+//
+// The signature is an HMAC-SHA256 over the scheme, the method, the request
+// URI, the timestamp, the nonce and the hex SHA-256 of the body, joined by
+// newlines. The body hash is also sent in the X-Content-SHA256 header.
+const hmacScheme = "AUTHZ-HMAC-SHA256"
+
+const (
+	hmacContentHashHeader   = "X-Content-SHA256"
+	defaultHMACReplayWindow = 5 * time.Minute
+	defaultHMACMaxBodyBytes = 1 << 20
+)
+
+// hmacSigner signs the requests of a remote authorizer.
+type hmacSigner struct {
+	keyID string
+	key   []byte
+}
+
+// WithHMACSigning authenticates requests by signing them with key instead of
+// sending a bearer token, so a leaked request cannot be replayed. keyID tells
+// the server which key to verify with, allowing keys to be rotated. The
+// bearerTokenFn passed to NewBetandbeatRemoteAuthorizer may be nil.
+func WithHMACSigning(keyID string, key []byte) RemoteAuthorizerOption {
+	return remoteAuthorizerOptionFunc(func(r *remoteAuthorizer) {
+		r.signer = &hmacSigner{keyID: keyID, key: key}
+	})
+}
+
+func (s *hmacSigner) sign(req *http.Request, body []byte, now time.Time) {
+	bodyHash := sha256.Sum256(body)
+	contentHash := hex.EncodeToString(bodyHash[:])
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	nonce := randomHex(16)
+	signature := hmacSignature(s.key, req.Method, req.URL.RequestURI(), timestamp, nonce, contentHash)
+
+	req.Header.Set(hmacContentHashHeader, contentHash)
+	req.Header.Set("Authorization", fmt.Sprintf("%s keyId=%s,timestamp=%s,nonce=%s,signature=%s",
+		hmacScheme, s.keyID, timestamp, nonce, base64.StdEncoding.EncodeToString(signature)))
+}
+
+func hmacSignature(key []byte, method, requestURI, timestamp, nonce, contentHash string) []byte {
+	mac := hmac.New(sha256.New, key)
+	io.WriteString(mac, strings.Join([]string{hmacScheme, method, requestURI, timestamp, nonce, contentHash}, "\n"))
+	return mac.Sum(nil)
+}
+
+// NonceStore remembers the nonces of verified requests. Use a shared store
+// when several servers verify requests signed with the same keys.
+type NonceStore interface {
+	// Remember records nonce until expiry and reports whether it was new.
+	Remember(keyID, nonce string, expiry time.Time) bool
+}
+
+// inMemoryNonceStore keeps nonces in memory, dropping expired ones as new
+// ones are recorded.
+type inMemoryNonceStore struct {
+	mu     sync.Mutex
+	now    func() time.Time
+	nonces map[string]time.Time
+	// sweepAt is when expired nonces are dropped next.
+	sweepAt time.Time
+}
+
+// NewInMemoryNonceStore creates a NonceStore for a single server.
+func NewInMemoryNonceStore() *inMemoryNonceStore {
+	return &inMemoryNonceStore{now: time.Now, nonces: make(map[string]time.Time)}
+}
+
+func (s *inMemoryNonceStore) Remember(keyID, nonce string, expiry time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now.After(s.sweepAt) {
+		for key, exp := range s.nonces {
+			if now.After(exp) {
+				delete(s.nonces, key)
+			}
+		}
+		s.sweepAt = now.Add(time.Minute)
+	}
+	key := keyID + "\x00" + nonce
+	if exp, ok := s.nonces[key]; ok && !now.After(exp) {
+		return false
+	}
+	s.nonces[key] = expiry
+	return true
+}
+
+// HMACVerifierConfig configures HMACVerificationMiddleware.
+type HMACVerifierConfig struct {
+	// Keys maps key IDs to shared keys. Keep the previous key while clients
+	// rotate to a new one.
+	Keys map[string][]byte
+	// ReplayWindow is how far a request's timestamp may be from the server's
+	// clock. Nonces are remembered for as long. Defaults to 5 minutes.
+	ReplayWindow time.Duration
+	// Nonces defaults to an in-memory store.
+	Nonces NonceStore
+	// MaxBodyBytes limits the size of request bodies, 1 MiB if zero.
+	MaxBodyBytes int64
+}
+
+type hmacKeyIDKey struct{}
+
+// HMACKeyIDFromContext returns the key ID a request verified by
+// HMACVerificationMiddleware was signed with.
+func HMACKeyIDFromContext(ctx context.Context) (string, bool) {
+	keyID, ok := ctx.Value(hmacKeyIDKey{}).(string)
+	return keyID, ok
+}
+
+// HMACVerificationMiddleware rejects requests that are not signed with one of
+// the configured keys, whose timestamp is outside the replay window, or whose
+// nonce was seen before, with 401 Unauthorized.
+func HMACVerificationMiddleware(config HMACVerifierConfig) func(http.Handler) http.Handler {
+	if config.ReplayWindow <= 0 {
+		config.ReplayWindow = defaultHMACReplayWindow
+	}
+	if config.Nonces == nil {
+		config.Nonces = NewInMemoryNonceStore()
+	}
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = defaultHMACMaxBodyBytes
+	}
+	verifier := &hmacVerifier{config: config, now: time.Now}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keyID, err := verifier.verify(r)
+			if err != nil {
+				writeUnauthorized(w, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), hmacKeyIDKey{}, keyID)))
+		})
+	}
+}
+
+type hmacVerifier struct {
+	config HMACVerifierConfig
+	now    func() time.Time
+}
+
+// verify checks the signature of r and returns its key ID. The body is read
+// and replaced, so handlers can still read it.
+func (v *hmacVerifier) verify(r *http.Request) (string, error) {
+	params, ok := parseHMACAuthorization(r.Header.Get("Authorization"))
+	if !ok {
+		return "", errors.New("missing or malformed HMAC signature")
+	}
+	key, ok := v.config.Keys[params["keyId"]]
+	if !ok {
+		return "", fmt.Errorf("unknown key ID %q", params["keyId"])
+	}
+	unix, err := strconv.ParseInt(params["timestamp"], 10, 64)
+	if err != nil {
+		return "", errors.New("invalid timestamp")
+	}
+	timestamp := time.Unix(unix, 0)
+	now := v.now()
+	if timestamp.Before(now.Add(-v.config.ReplayWindow)) || timestamp.After(now.Add(v.config.ReplayWindow)) {
+		return "", errors.New("timestamp outside the replay window")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, v.config.MaxBodyBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read body: %w", err)
+	}
+	if int64(len(body)) > v.config.MaxBodyBytes {
+		return "", errors.New("request body too large")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	bodyHash := sha256.Sum256(body)
+	contentHash := hex.EncodeToString(bodyHash[:])
+
+	signature, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return "", errors.New("invalid signature encoding")
+	}
+	expected := hmacSignature(key, r.Method, r.URL.RequestURI(), params["timestamp"], params["nonce"], contentHash)
+	if !hmac.Equal(signature, expected) {
+		return "", errors.New("invalid signature")
+	}
+	// Only remember nonces of authentic requests, so forged requests cannot
+	// burn the nonces of legitimate ones.
+	if !v.config.Nonces.Remember(params["keyId"], params["nonce"], timestamp.Add(v.config.ReplayWindow)) {
+		return "", errors.New("replayed request")
+	}
+	return params["keyId"], nil
+}
+
+// parseHMACAuthorization parses the parameters of an HMAC Authorization header.
+func parseHMACAuthorization(header string) (map[string]string, bool) {
+	rest, ok := strings.CutPrefix(header, hmacScheme+" ")
+	if !ok {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for _, part := range strings.Split(rest, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, false
+		}
+		params[name] = value
+	}
+	for _, name := range []string{"keyId", "timestamp", "nonce", "signature"} {
+		if params[name] == "" {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func writeUnauthorized(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", hmacScheme)
+	writeProblem(w, http.StatusUnauthorized, err.Error())
+}
+
+// writeProblem writes an RFC 9457 problem details response.
+func writeProblem(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ProblemDetails{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	})
+}
@@ -0,0 +1,147 @@
+package authorization
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newHMACTestHandler(t *testing.T, config HMACVerifierConfig) http.Handler {
+	t.Helper()
+	return HMACVerificationMiddleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyID, ok := HMACKeyIDFromContext(r.Context())
+		assert.True(t, ok)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "users/mark", "the body is still readable")
+		w.Write([]byte(`{"effect":"allow","message":"verified with ` + keyID + `"}`))
+	}))
+}
+
+// signedTestRequest returns a request signed with the given key at the given time.
+func signedTestRequest(keyID string, key []byte, body string, at time.Time) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/v1/authorize?tenant=acme", bytes.NewBufferString(body))
+	(&hmacSigner{keyID: keyID, key: key}).sign(req, []byte(body), at)
+	return req
+}
+
+func TestHMACSigning(t *testing.T) {
+	handler := newHMACTestHandler(t, HMACVerifierConfig{Keys: map[string][]byte{
+		"2025-06": []byte("old-secret"),
+		"2025-07": []byte("new-secret"),
+	}})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for _, keyID := range []string{"2025-06", "2025-07"} {
+		key := map[string]string{"2025-06": "old-secret", "2025-07": "new-secret"}[keyID]
+		authorizer := NewBetandbeatRemoteAuthorizer(server.URL+"/v1/authorize", nil, WithHMACSigning(keyID, []byte(key)))
+		resp, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark", Action: "read"})
+		require.NoError(t, err)
+		assert.Equal(t, EffectAllow, resp.Effect)
+		assert.Equal(t, "verified with "+keyID, resp.Message)
+	}
+
+	authorizer := NewBetandbeatRemoteAuthorizer(server.URL, nil, WithHMACSigning("2025-07", []byte("guessed")))
+	_, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+	assert.Error(t, err)
+}
+
+func TestHMACVerificationMiddleware_Rejects(t *testing.T) {
+	key := []byte("secret")
+	handler := newHMACTestHandler(t, HMACVerifierConfig{Keys: map[string][]byte{"k1": key}, ReplayWindow: time.Minute})
+	body := `{"principal":"users/mark"}`
+
+	tests := []struct {
+		name string
+		req  func() *http.Request
+	}{
+		{
+			name: "unsigned",
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/v1/authorize", bytes.NewBufferString(body))
+				req.Header.Set("Authorization", "Bearer token")
+				return req
+			},
+		},
+		{
+			name: "unknown key ID",
+			req:  func() *http.Request { return signedTestRequest("k2", key, body, time.Now()) },
+		},
+		{
+			name: "wrong key",
+			req:  func() *http.Request { return signedTestRequest("k1", []byte("other"), body, time.Now()) },
+		},
+		{
+			name: "stale timestamp",
+			req:  func() *http.Request { return signedTestRequest("k1", key, body, time.Now().Add(-2*time.Minute)) },
+		},
+		{
+			name: "timestamp in the future",
+			req:  func() *http.Request { return signedTestRequest("k1", key, body, time.Now().Add(2*time.Minute)) },
+		},
+		{
+			name: "tampered body",
+			req: func() *http.Request {
+				req := signedTestRequest("k1", key, body, time.Now())
+				req.Body = io.NopCloser(bytes.NewBufferString(`{"principal":"users/admin"}`))
+				return req
+			},
+		},
+		{
+			name: "tampered path",
+			req: func() *http.Request {
+				req := signedTestRequest("k1", key, body, time.Now())
+				req.URL.RawQuery = "tenant=other"
+				return req
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tt.req())
+			assert.Equal(t, http.StatusUnauthorized, rec.Code)
+			assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func TestHMACVerificationMiddleware_Replay(t *testing.T) {
+	key := []byte("secret")
+	handler := newHMACTestHandler(t, HMACVerifierConfig{Keys: map[string][]byte{"k1": key}})
+	body := `{"principal":"users/mark"}`
+
+	req := signedTestRequest("k1", key, body, time.Now())
+	replay := req.Clone(req.Context())
+	replay.Body = io.NopCloser(bytes.NewBufferString(body))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, replay)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), "replayed request")
+}
+
+func TestInMemoryNonceStore(t *testing.T) {
+	store := NewInMemoryNonceStore()
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	assert.True(t, store.Remember("k1", "n1", now.Add(time.Minute)))
+	assert.False(t, store.Remember("k1", "n1", now.Add(time.Minute)))
+	assert.True(t, store.Remember("k2", "n1", now.Add(time.Minute)), "nonces are scoped to the key")
+
+	now = now.Add(2 * time.Minute)
+	assert.True(t, store.Remember("k3", "n2", now.Add(time.Minute)))
+	assert.Len(t, store.nonces, 1, "expired nonces are swept")
+}
@@ -0,0 +1,152 @@
+package authorization
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// ParseTrustedProxies parses the CIDRs of trusted proxies for
+// ContextFromHTTPRequest. Single addresses are accepted as well.
+func ParseTrustedProxies(cidrs ...string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// TrustedProxies describes the reverse proxies in front of a service, for
+// ContextFromHTTPRequest.
+type TrustedProxies struct {
+	// Prefixes are the addresses of the proxies, see ParseTrustedProxies.
+	Prefixes []netip.Prefix
+	// Header is the forwarding header the proxies set, such as "Forwarded",
+	// "X-Forwarded-For" or "X-Real-IP". Other forwarding headers are ignored:
+	// the proxies pass them on from the client unchecked.
+	Header string
+}
+
+// ContextFromHTTPRequest returns the Context of r: the client IP, the user
+// agent, the current time and the TLS connection, if any.
+//
+// The client IP is the peer address unless the peer is one of the trusted
+// proxies and they name their forwarding header. Only then is that header
+// consulted: the client IP is the last address not of a trusted proxy,
+// walking the chain from the peer back. A client can thus prepend addresses
+// to the header, but not impersonate another address.
+func ContextFromHTTPRequest(r *http.Request, proxies TrustedProxies) Context {
+	var c Context
+	c.Request.At = time.Now()
+	c.Request.IP = clientIP(r, proxies)
+	c.Request.UserAgent = r.UserAgent()
+	if r.TLS != nil {
+		c.TLS = TLSInfo{
+			Version:     tls.VersionName(r.TLS.Version),
+			CipherSuite: tls.CipherSuiteName(r.TLS.CipherSuite),
+			ServerName:  r.TLS.ServerName,
+		}
+		if len(r.TLS.PeerCertificates) > 0 {
+			c.TLS.ClientSubject = r.TLS.PeerCertificates[0].Subject.String()
+		}
+	}
+	return c
+}
+
+func clientIP(r *http.Request, proxies TrustedProxies) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	peer = peer.Unmap()
+	if proxies.Header == "" || !trusted(peer, proxies.Prefixes) {
+		return peer.String()
+	}
+
+	// Only the header the proxies set is consulted: a client may send any
+	// other, and the proxies pass it on.
+	var chain []string
+	values := r.Header.Values(proxies.Header)
+	if http.CanonicalHeaderKey(proxies.Header) == "Forwarded" {
+		chain = forwardedFor(values)
+	} else {
+		for _, value := range values {
+			chain = append(chain, strings.Split(value, ",")...)
+		}
+	}
+
+	// Walk back from the peer while the hops are trusted. An address that
+	// does not parse cannot be vouched for, so the last trusted hop is used.
+	client := peer
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, ok := parseForwardedAddr(chain[i])
+		if !ok {
+			break
+		}
+		client = addr
+		if !trusted(addr, proxies.Prefixes) {
+			break
+		}
+	}
+	return client.String()
+}
+
+func trusted(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the for= addresses of RFC 7239 Forwarded headers.
+func forwardedFor(values []string) []string {
+	var addresses []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					addresses = append(addresses, value)
+				}
+			}
+		}
+	}
+	return addresses
+}
+
+// parseForwardedAddr parses an address of a forwarding header, which may be
+// quoted and carry a port, as in "[2001:db8::1]:4711".
+func parseForwardedAddr(s string) (netip.Addr, bool) {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
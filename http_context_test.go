@@ -0,0 +1,217 @@
+package authorization
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextFromHTTPRequest_ClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8", "2001:db8::/32", "192.0.2.1")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		headers    map[string][]string
+		want       string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "198.51.100.7:1234",
+			header:     "X-Forwarded-For",
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "untrusted peer cannot spoof X-Forwarded-For",
+			remoteAddr: "198.51.100.7:1234",
+			header:     "X-Forwarded-For",
+			headers:    map[string][]string{"X-Forwarded-For": {"203.0.113.1"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "untrusted peer cannot spoof X-Real-IP",
+			remoteAddr: "198.51.100.7:1234",
+			header:     "X-Real-IP",
+			headers:    map[string][]string{"X-Real-Ip": {"127.0.0.1"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.1.2.3:1234",
+			header:     "X-Forwarded-For",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.7"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "client prepends a spoofed address",
+			remoteAddr: "10.1.2.3:1234",
+			header:     "X-Forwarded-For",
+			headers:    map[string][]string{"X-Forwarded-For": {"127.0.0.1, 198.51.100.7"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "chain of trusted proxies",
+			remoteAddr: "10.1.2.3:1234",
+			header:     "X-Forwarded-For",
+			headers:    map[string][]string{"X-Forwarded-For": {"203.0.113.5, 198.51.100.7, 10.9.9.9", "192.0.2.1"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "client claims a trusted address",
+			remoteAddr: "10.1.2.3:1234",
+			header:     "X-Forwarded-For",
+			headers:    map[string][]string{"X-Forwarded-For": {"10.6.6.6"}},
+			want:       "10.6.6.6",
+		},
+		{
+			name:       "garbage stops at the last trusted hop",
+			remoteAddr: "10.1.2.3:1234",
+			header:     "X-Forwarded-For",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.7, not-an-ip, 10.9.9.9"}},
+			want:       "10.9.9.9",
+		},
+		{
+			name:       "Forwarded",
+			remoteAddr: "10.1.2.3:1234",
+			header:     "Forwarded",
+			headers: map[string][]string{
+				"Forwarded":       {`for=127.0.0.1, For="[2001:db8:cafe::17]:4711";proto=https, for=198.51.100.7:80;by=10.0.0.1`},
+				"X-Forwarded-For": {"203.0.113.9"},
+			},
+			want: "198.51.100.7",
+		},
+		{
+			name:       "Forwarded IPv6",
+			remoteAddr: "[2001:db8::1]:443",
+			header:     "Forwarded",
+			headers:    map[string][]string{"Forwarded": {`for="[2001:db9::17]:4711"`}},
+			want:       "2001:db9::17",
+		},
+		{
+			name:       "obfuscated Forwarded identifier",
+			remoteAddr: "10.1.2.3:1234",
+			header:     "Forwarded",
+			headers:    map[string][]string{"Forwarded": {"for=_hidden"}},
+			want:       "10.1.2.3",
+		},
+		{
+			name:       "X-Real-IP from trusted proxy",
+			remoteAddr: "10.1.2.3:1234",
+			header:     "X-Real-IP",
+			headers:    map[string][]string{"X-Real-Ip": {"198.51.100.7"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "IPv4-mapped peer",
+			remoteAddr: "[::ffff:10.1.2.3]:1234",
+			header:     "X-Forwarded-For",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.7"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "forged Forwarded is ignored when the proxy sets X-Forwarded-For",
+			remoteAddr: "10.0.0.1:1234",
+			header:     "X-Forwarded-For",
+			headers: map[string][]string{
+				"Forwarded":       {"for=127.0.0.1"},
+				"X-Forwarded-For": {"203.0.113.9"},
+			},
+			want: "203.0.113.9",
+		},
+		{
+			name:       "forged X-Forwarded-For is ignored when the proxy sets X-Real-IP",
+			remoteAddr: "10.0.0.1:1234",
+			header:     "X-Real-IP",
+			headers: map[string][]string{
+				"X-Forwarded-For": {"127.0.0.1"},
+				"X-Real-Ip":       {"203.0.113.9"},
+			},
+			want: "203.0.113.9",
+		},
+		{
+			name:       "forged header when the proxy sets none",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"127.0.0.1"}},
+			want:       "10.0.0.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, values := range tt.headers {
+				req.Header[name] = values
+			}
+			assert.Equal(t, tt.want, ContextFromHTTPRequest(req, TrustedProxies{Prefixes: proxies, Header: tt.header}).Request.IP)
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.1.2.3:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	assert.Equal(t, "10.1.2.3", ContextFromHTTPRequest(req, TrustedProxies{Header: "X-Forwarded-For"}).Request.IP, "no proxy is trusted by default")
+}
+
+func TestContextFromHTTPRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("User-Agent", "bettor/1.0")
+	c := ContextFromHTTPRequest(req, TrustedProxies{})
+	assert.Equal(t, "bettor/1.0", c.Request.UserAgent)
+	assert.False(t, c.Request.At.IsZero())
+	assert.Equal(t, TLSInfo{}, c.TLS)
+
+	req.TLS = &tls.ConnectionState{
+		Version:          tls.VersionTLS13,
+		CipherSuite:      tls.TLS_AES_128_GCM_SHA256,
+		ServerName:       "authz.example.com",
+		PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "billing"}}},
+	}
+	assert.Equal(t, TLSInfo{
+		Version:       "TLS 1.3",
+		CipherSuite:   "TLS_AES_128_GCM_SHA256",
+		ServerName:    "authz.example.com",
+		ClientSubject: "CN=billing",
+	}, ContextFromHTTPRequest(req, TrustedProxies{}).TLS)
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	_, err := ParseTrustedProxies("10.0.0.0/33")
+	assert.Error(t, err)
+	_, err = ParseTrustedProxies("proxy.internal")
+	assert.Error(t, err)
+}
+
+func TestContextFromHTTPRequest_Conditions(t *testing.T) {
+	storage := NewInMemoryStorage()
+	require.NoError(t, storage.SaveStatement(Statement{
+		ID:         "billing",
+		Active:     true,
+		Effect:     EffectAllow,
+		Principals: []Principal{"services/billing"},
+		Actions:    []ActionID{"payouts:create"},
+		Resources:  []Resource{"payouts/*"},
+		Conditions: []Condition{{Name: "mtls", Expression: `context.TLS.ClientSubject == "CN=billing"`}},
+	}))
+	evaluator := NewEvaluator(storage)
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	request := Request{Principal: "services/billing", Action: "payouts:create", Resource: "payouts/1"}
+	request.Context = ContextFromHTTPRequest(req, TrustedProxies{})
+	resp, err := evaluator.Evaluate(request)
+	require.NoError(t, err)
+	assert.False(t, resp.Allowed())
+
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "billing"}}}}
+	request.Context = ContextFromHTTPRequest(req, TrustedProxies{})
+	resp, err = evaluator.Evaluate(request)
+	require.NoError(t, err)
+	assert.True(t, resp.Allowed())
+}
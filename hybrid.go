@@ -0,0 +1,128 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// DegradationPolicy decides requests the remote authorization service could
+// not answer.
+type DegradationPolicy string
+
+const (
+	// DegradeFailClosed denies the request.
+	DegradeFailClosed DegradationPolicy = "fail_closed"
+	// DegradeFailOpen allows the request. Only use it for read-only actions.
+	DegradeFailOpen DegradationPolicy = "fail_open"
+	// DegradeLocalFallback evaluates the request with the local evaluator,
+	// typically backed by a cached copy of the policy.
+	DegradeLocalFallback DegradationPolicy = "local_fallback"
+)
+
+// Degradation marks a decision made without the remote authorization service.
+type Degradation struct {
+	Policy DegradationPolicy `json:"policy"`
+	// Reason is the error returned by the remote authorizer.
+	Reason string `json:"reason"`
+}
+
+// DegradationRule applies a policy to the actions matching any of Actions,
+// which are patterns like those of statements.
+type DegradationRule struct {
+	Actions []ActionID
+	Policy  DegradationPolicy
+}
+
+// HybridAuthorizerConfig configures NewHybridAuthorizer.
+type HybridAuthorizerConfig struct {
+	// Rules are checked in order; the first rule matching the action decides
+	// the policy.
+	Rules []DegradationRule
+	// DefaultPolicy applies to actions no rule matches. Defaults to
+	// DegradeFailClosed.
+	DefaultPolicy DegradationPolicy
+	// DegradeOn reports whether a remote error should be handled by the
+	// degradation policy. By default every error is, except the caller's
+	// context being cancelled, ErrInvalidRequest, ErrUnauthorized and
+	// ErrInvalidResponseSignature: those are not outages, and failing open
+	// on a tampered response would defeat its signature.
+	DegradeOn func(err error) bool
+}
+
+type hybridAuthorizer struct {
+	remote RemoteAuthorizer
+	local  Evaluator
+	config HybridAuthorizerConfig
+}
+
+// NewHybridAuthorizer asks remote and, when it fails, decides according to
+// the degradation policy of the requested action. Degraded decisions are
+// returned without an error and with Response.Degraded set, including the
+// denial when the local evaluation fails. local may be nil if no policy falls
+// back to it; DegradeLocalFallback then fails closed.
+func NewHybridAuthorizer(remote RemoteAuthorizer, local Evaluator, config HybridAuthorizerConfig) RemoteAuthorizer {
+	if config.DefaultPolicy == "" {
+		config.DefaultPolicy = DegradeFailClosed
+	}
+	return &hybridAuthorizer{remote: remote, local: local, config: config}
+}
+
+func (h *hybridAuthorizer) Authorize(ctx context.Context, req Request) (Response, error) {
+	resp, err := h.remote.Authorize(ctx, req)
+	if err == nil || !h.degradeOn(err) {
+		return resp, err
+	}
+
+	policy := h.policy(req.Action)
+	degradation := &Degradation{Policy: policy, Reason: err.Error()}
+	switch policy {
+	case DegradeFailOpen:
+		return Response{
+			Effect:   EffectAllow,
+			Message:  fmt.Sprintf("authorization service unavailable, allowed by fail-open policy: %s", err),
+			Degraded: degradation,
+		}, nil
+	case DegradeLocalFallback:
+		if h.local == nil {
+			break
+		}
+		local, localErr := h.local.Evaluate(req)
+		if localErr != nil {
+			return Response{
+				Effect:   EffectDeny,
+				Message:  fmt.Sprintf("authorization service unavailable and local evaluation failed: %s", localErr),
+				Degraded: degradation,
+			}, nil
+		}
+		local.Degraded = degradation
+		return local, nil
+	}
+	degradation.Policy = DegradeFailClosed
+	return Response{
+		Effect:   EffectDeny,
+		Message:  fmt.Sprintf("authorization service unavailable, denied by fail-closed policy: %s", err),
+		Degraded: degradation,
+	}, nil
+}
+
+func (h *hybridAuthorizer) policy(action ActionID) DegradationPolicy {
+	for _, rule := range h.config.Rules {
+		if actionMatches(rule.Actions, action) {
+			return rule.Policy
+		}
+	}
+	return h.config.DefaultPolicy
+}
+
+func (h *hybridAuthorizer) degradeOn(err error) bool {
+	if h.config.DegradeOn != nil {
+		return h.config.DegradeOn(err)
+	}
+	for _, target := range []error{context.Canceled, ErrInvalidRequest, ErrUnauthorized, ErrInvalidResponseSignature} {
+		if errors.Is(err, target) {
+			return false
+		}
+	}
+	return true
+}
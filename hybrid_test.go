@@ -0,0 +1,137 @@
+package authorization
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// remoteAuthorizerFunc adapts a function to RemoteAuthorizer.
+type remoteAuthorizerFunc func(ctx context.Context, req Request) (Response, error)
+
+func (f remoteAuthorizerFunc) Authorize(ctx context.Context, req Request) (Response, error) {
+	return f(ctx, req)
+}
+
+func TestHybridAuthorizer(t *testing.T) {
+	// The remote service is down.
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	remote := NewBetandbeatRemoteAuthorizer(server.URL, func() (string, error) { return "token", nil })
+
+	storage := NewInMemoryStorage()
+	require.NoError(t, storage.SaveStatement(Statement{
+		ID: "allow-billing", Effect: EffectAllow,
+		Principals: []Principal{"users/mark"}, Actions: []ActionID{"billing:*"}, Resources: []Resource{"*"},
+	}))
+	authorizer := NewHybridAuthorizer(remote, NewEvaluator(storage), HybridAuthorizerConfig{
+		Rules: []DegradationRule{
+			{Actions: []ActionID{"*:Get*", "*:List*"}, Policy: DegradeFailOpen},
+			{Actions: []ActionID{"billing:*"}, Policy: DegradeLocalFallback},
+		},
+	})
+
+	tests := []struct {
+		action ActionID
+		effect Effect
+		policy DegradationPolicy
+	}{
+		{action: "documents:GetDocument", effect: EffectAllow, policy: DegradeFailOpen},
+		{action: "billing:Refund", effect: EffectAllow, policy: DegradeLocalFallback},
+		{action: "iam:DeleteUser", effect: EffectDeny, policy: DegradeFailClosed},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.action), func(t *testing.T) {
+			resp, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark", Action: tt.action, Resource: "x"})
+			require.NoError(t, err)
+			assert.Equal(t, tt.effect, resp.Effect)
+			require.NotNil(t, resp.Degraded)
+			assert.Equal(t, tt.policy, resp.Degraded.Policy)
+			assert.Contains(t, resp.Degraded.Reason, "connection refused")
+		})
+	}
+
+	resp, err := authorizer.Authorize(t.Context(), Request{Principal: "users/anna", Action: "billing:Refund", Resource: "x"})
+	require.NoError(t, err)
+	assert.Equal(t, EffectDeny, resp.Effect, "the local policy denies users it does not allow")
+	assert.Equal(t, DegradeLocalFallback, resp.Degraded.Policy)
+}
+
+func TestHybridAuthorizer_RemoteAvailable(t *testing.T) {
+	remote := remoteAuthorizerFunc(func(ctx context.Context, req Request) (Response, error) {
+		return Response{Effect: EffectDeny, Message: "denied remotely"}, nil
+	})
+	authorizer := NewHybridAuthorizer(remote, nil, HybridAuthorizerConfig{DefaultPolicy: DegradeFailOpen})
+
+	resp, err := authorizer.Authorize(t.Context(), Request{Action: "documents:GetDocument"})
+	require.NoError(t, err)
+	assert.Equal(t, EffectDeny, resp.Effect)
+	assert.Nil(t, resp.Degraded)
+}
+
+func TestHybridAuthorizer_DegradeOn(t *testing.T) {
+	errInvalid := errors.New("invalid request")
+	remote := remoteAuthorizerFunc(func(ctx context.Context, req Request) (Response, error) {
+		return Response{Effect: EffectDeny}, errInvalid
+	})
+	authorizer := NewHybridAuthorizer(remote, nil, HybridAuthorizerConfig{
+		DefaultPolicy: DegradeFailOpen,
+		DegradeOn:     func(err error) bool { return !errors.Is(err, errInvalid) },
+	})
+
+	resp, err := authorizer.Authorize(t.Context(), Request{Action: "documents:GetDocument"})
+	assert.ErrorIs(t, err, errInvalid)
+	assert.Nil(t, resp.Degraded)
+
+	canceled := NewHybridAuthorizer(remoteAuthorizerFunc(func(ctx context.Context, req Request) (Response, error) {
+		return Response{Effect: EffectDeny}, context.Canceled
+	}), nil, HybridAuthorizerConfig{DefaultPolicy: DegradeFailOpen})
+	_, err = canceled.Authorize(t.Context(), Request{})
+	assert.ErrorIs(t, err, context.Canceled, "a cancelled caller is not degraded")
+}
+
+func TestHybridAuthorizer_InvalidSignatureNotDegraded(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	server := newSignedDecisionServer(t, priv)
+	// A proxy flips the decision and strips the signature.
+	remote := NewBetandbeatRemoteAuthorizer(server.URL, func() (string, error) { return "token", nil },
+		WithResponseVerification(map[string]ed25519.PublicKey{"k1": pub}),
+		WithTransport(tamperingTransport(func(resp *http.Response) {
+			resp.Header.Del(responseSignatureHeader)
+			resp.Body = io.NopCloser(strings.NewReader(`{"effect":"allow"}`))
+		})))
+	authorizer := NewHybridAuthorizer(remote, nil, HybridAuthorizerConfig{DefaultPolicy: DegradeFailOpen})
+
+	resp, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark", Action: "delete"})
+	assert.ErrorIs(t, err, ErrInvalidResponseSignature)
+	assert.Nil(t, resp.Degraded, "a tampered response must not fail open")
+	assert.NotEqual(t, EffectAllow, resp.Effect)
+}
+
+func TestHybridAuthorizer_LocalFallbackFailures(t *testing.T) {
+	remote := remoteAuthorizerFunc(func(ctx context.Context, req Request) (Response, error) {
+		return Response{Effect: EffectDeny}, ErrCircuitOpen
+	})
+	config := HybridAuthorizerConfig{DefaultPolicy: DegradeLocalFallback}
+
+	resp, err := NewHybridAuthorizer(remote, nil, config).Authorize(t.Context(), Request{})
+	require.NoError(t, err)
+	assert.Equal(t, EffectDeny, resp.Effect)
+	assert.Equal(t, DegradeFailClosed, resp.Degraded.Policy, "without a local evaluator the request fails closed")
+
+	local := NewEvaluator(&mockStorage{listStatementsErr: errors.New("cache is empty")})
+	resp, err = NewHybridAuthorizer(remote, local, config).Authorize(t.Context(), Request{})
+	require.NoError(t, err, "degraded decisions are returned without an error")
+	assert.Equal(t, EffectDeny, resp.Effect)
+	assert.Equal(t, DegradeLocalFallback, resp.Degraded.Policy)
+	assert.Contains(t, resp.Message, "cache is empty")
+}
@@ -0,0 +1,390 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Metric names recorded by the instrumented decorators.
+const (
+	MetricDecisions                 = "authz_decisions_total"
+	MetricDecisionErrors            = "authz_decision_errors_total"
+	MetricDecisionDuration          = "authz_decision_duration_seconds"
+	MetricConditionErrors           = "authz_condition_errors_total"
+	MetricStorageDuration           = "authz_storage_duration_seconds"
+	MetricStorageErrors             = "authz_storage_errors_total"
+	MetricResolvePrincipalsDuration = "authz_resolve_principals_duration_seconds"
+	MetricResolvePrincipalsErrors   = "authz_resolve_principals_errors_total"
+)
+
+// Labels are the label names and values of a single metric series.
+type Labels map[string]string
+
+// Metrics is the sink the instrumented decorators record to. Implementations
+// must be safe for concurrent use.
+type Metrics interface {
+	// IncCounter adds one to the counter with the given name and labels.
+	IncCounter(name string, labels Labels)
+	// ObserveHistogram records a value, in seconds for durations, in the
+	// histogram with the given name and labels.
+	ObserveHistogram(name string, labels Labels, value float64)
+}
+
+// InstrumentationOption configures NewInstrumentedEvaluator and
+// NewInstrumentedRemoteAuthorizer.
+type InstrumentationOption interface {
+	applyInstrumentation(i *instrumentation)
+}
+
+type instrumentationOptionFunc func(i *instrumentation)
+
+func (f instrumentationOptionFunc) applyInstrumentation(i *instrumentation) {
+	f(i)
+}
+
+// WithActionLabel labels authz_decisions_total with the requested action.
+// Every distinct action creates new series, so only use it when callers
+// pass actions from a fixed catalog.
+func WithActionLabel() InstrumentationOption {
+	return instrumentationOptionFunc(func(i *instrumentation) {
+		i.actionLabel = true
+	})
+}
+
+type instrumentation struct {
+	metrics     Metrics
+	source      DecisionSource
+	actionLabel bool
+}
+
+func newInstrumentation(metrics Metrics, source DecisionSource, opts []InstrumentationOption) instrumentation {
+	i := instrumentation{metrics: metrics, source: source}
+	for _, opt := range opts {
+		opt.applyInstrumentation(&i)
+	}
+	return i
+}
+
+type instrumentedEvaluator struct {
+	evaluator Evaluator
+	instrumentation
+}
+
+// NewInstrumentedEvaluator records the decisions, errors and latency of e, which
+// may be an evaluator created by NewEvaluator or an ExpandingEvaluator. For the
+// former, condition evaluation errors are counted per statement as well.
+func NewInstrumentedEvaluator(e Evaluator, metrics Metrics, opts ...InstrumentationOption) Evaluator {
+	source := DecisionSourceEvaluator
+	switch inner := e.(type) {
+	case *evaluator:
+		// Instrument a copy so the caller's evaluator is left unchanged.
+		instrumented := *inner
+		instrumented.onConditionError = func(stmt Statement, err error) {
+			metrics.IncCounter(MetricConditionErrors, Labels{"statement": stmt.ID})
+		}
+		e = &instrumented
+	case *ExpandingEvaluator:
+		source = DecisionSourceExpandingEvaluator
+	}
+	return &instrumentedEvaluator{evaluator: e, instrumentation: newInstrumentation(metrics, source, opts)}
+}
+
+func (e *instrumentedEvaluator) Evaluate(req Request) (Response, error) {
+	return e.evaluateContext(context.Background(), req)
+}
+
+func (e *instrumentedEvaluator) evaluateContext(ctx context.Context, req Request) (Response, error) {
+	start := time.Now()
+	resp, err := evaluateWithContext(ctx, e.evaluator, req)
+	e.recordDecision(req, resp, err, time.Since(start))
+	return resp, err
+}
+
+type instrumentedRemoteAuthorizer struct {
+	authorizer RemoteAuthorizer
+	instrumentation
+}
+
+// NewInstrumentedRemoteAuthorizer records the decisions, errors and latency
+// of a RemoteAuthorizer.
+func NewInstrumentedRemoteAuthorizer(authorizer RemoteAuthorizer, metrics Metrics, opts ...InstrumentationOption) RemoteAuthorizer {
+	return &instrumentedRemoteAuthorizer{authorizer: authorizer, instrumentation: newInstrumentation(metrics, DecisionSourceRemote, opts)}
+}
+
+func (r *instrumentedRemoteAuthorizer) Authorize(ctx context.Context, req Request) (Response, error) {
+	start := time.Now()
+	resp, err := r.authorizer.Authorize(ctx, req)
+	r.recordDecision(req, resp, err, time.Since(start))
+	return resp, err
+}
+
+func (i instrumentation) recordDecision(req Request, resp Response, err error, latency time.Duration) {
+	source := string(i.source)
+	effect := string(resp.Effect)
+	if err != nil {
+		effect = "error"
+		i.metrics.IncCounter(MetricDecisionErrors, Labels{"source": source, "class": errorClass(err)})
+	} else {
+		labels := Labels{"source": source, "effect": effect, "decider": ""}
+		if resp.Decider != nil {
+			labels["decider"] = deciderKind(*resp.Decider)
+		}
+		if i.actionLabel {
+			labels["action"] = string(req.Action)
+		}
+		i.metrics.IncCounter(MetricDecisions, labels)
+	}
+	i.metrics.ObserveHistogram(MetricDecisionDuration, Labels{"source": source, "effect": effect}, latency.Seconds())
+}
+
+// deciderKind bounds the decider label: deciders such as
+// "principal_expansion:users/alice" are reduced to the part before the
+// colon, leaving statement IDs as they are.
+func deciderKind(decider string) string {
+	kind, _, _ := strings.Cut(decider, ":")
+	return kind
+}
+
+var (
+	_ StatementStore   = (*instrumentedStorage)(nil)
+	_ StatementHistory = (*instrumentedStorage)(nil)
+	_ StatementWatcher = (*instrumentedStorage)(nil)
+)
+
+type instrumentedStorage struct {
+	storage Storage
+	metrics Metrics
+}
+
+// NewInstrumentedStorage records the latency and errors of calls to storage.
+// The returned Storage implements StatementStore, StatementHistory and
+// StatementWatcher, so it can replace storage everywhere, including for
+// point-in-time evaluation. Methods of an interface storage does not
+// implement fail with ErrNotSupported, and Revision returns 0.
+func NewInstrumentedStorage(storage Storage, metrics Metrics) Storage {
+	return &instrumentedStorage{storage: storage, metrics: metrics}
+}
+
+func (s *instrumentedStorage) ListStatementsByPrincipal(principal Principal) ([]Statement, error) {
+	start := time.Now()
+	statements, err := s.storage.ListStatementsByPrincipal(principal)
+	s.record("list_statements_by_principal", start, err)
+	return statements, err
+}
+
+func (s *instrumentedStorage) record(operation string, start time.Time, err error) {
+	s.metrics.ObserveHistogram(MetricStorageDuration, Labels{"operation": operation}, time.Since(start).Seconds())
+	if err != nil {
+		s.metrics.IncCounter(MetricStorageErrors, Labels{"operation": operation, "class": errorClass(err)})
+	}
+}
+
+// store returns the StatementStore of the wrapped storage.
+func (s *instrumentedStorage) store() (StatementStore, error) {
+	store, ok := s.storage.(StatementStore)
+	if !ok {
+		return nil, fmt.Errorf("storage %T does not implement StatementStore: %w", s.storage, ErrNotSupported)
+	}
+	return store, nil
+}
+
+// history returns the StatementHistory of the wrapped storage.
+func (s *instrumentedStorage) history() (StatementHistory, error) {
+	history, ok := s.storage.(StatementHistory)
+	if !ok {
+		return nil, fmt.Errorf("storage %T does not implement StatementHistory: %w", s.storage, ErrNotSupported)
+	}
+	return history, nil
+}
+
+// watcher returns the StatementWatcher of the wrapped storage.
+func (s *instrumentedStorage) watcher() (StatementWatcher, error) {
+	watcher, ok := s.storage.(StatementWatcher)
+	if !ok {
+		return nil, fmt.Errorf("storage %T does not implement StatementWatcher: %w", s.storage, ErrNotSupported)
+	}
+	return watcher, nil
+}
+
+func (s *instrumentedStorage) GetStatement(id string) (*Statement, error) {
+	store, err := s.store()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	stmt, err := store.GetStatement(id)
+	s.record("get_statement", start, err)
+	return stmt, err
+}
+
+func (s *instrumentedStorage) SaveStatement(statement Statement) error {
+	store, err := s.store()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = store.SaveStatement(statement)
+	s.record("save_statement", start, err)
+	return err
+}
+
+func (s *instrumentedStorage) DeleteStatement(id string) error {
+	store, err := s.store()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = store.DeleteStatement(id)
+	s.record("delete_statement", start, err)
+	return err
+}
+
+func (s *instrumentedStorage) List(filter StatementFilter) (StatementPage, error) {
+	store, err := s.store()
+	if err != nil {
+		return StatementPage{}, err
+	}
+	start := time.Now()
+	page, err := store.List(filter)
+	s.record("list", start, err)
+	return page, err
+}
+
+func (s *instrumentedStorage) SaveStatementWithOptions(statement Statement, opts WriteOptions) (Statement, error) {
+	store, err := s.store()
+	if err != nil {
+		return Statement{}, err
+	}
+	start := time.Now()
+	saved, err := store.SaveStatementWithOptions(statement, opts)
+	s.record("save_statement", start, err)
+	return saved, err
+}
+
+func (s *instrumentedStorage) DeleteStatementWithOptions(id string, opts WriteOptions) error {
+	store, err := s.store()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = store.DeleteStatementWithOptions(id, opts)
+	s.record("delete_statement", start, err)
+	return err
+}
+
+func (s *instrumentedStorage) ApplyBatch(ops []BatchOperation) error {
+	store, err := s.store()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = store.ApplyBatch(ops)
+	s.record("apply_batch", start, err)
+	return err
+}
+
+func (s *instrumentedStorage) ListStatementVersions(id string) ([]ChangeEvent, error) {
+	history, err := s.history()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	versions, err := history.ListStatementVersions(id)
+	s.record("list_statement_versions", start, err)
+	return versions, err
+}
+
+func (s *instrumentedStorage) RestoreStatementVersion(id string, revision uint64, opts WriteOptions) (Statement, error) {
+	history, err := s.history()
+	if err != nil {
+		return Statement{}, err
+	}
+	start := time.Now()
+	restored, err := history.RestoreStatementVersion(id, revision, opts)
+	s.record("restore_statement_version", start, err)
+	return restored, err
+}
+
+func (s *instrumentedStorage) ListStatementsByPrincipalAt(principal Principal, at time.Time) ([]Statement, error) {
+	history, err := s.history()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	statements, err := history.ListStatementsByPrincipalAt(principal, at)
+	s.record("list_statements_by_principal_at", start, err)
+	return statements, err
+}
+
+func (s *instrumentedStorage) Revision() uint64 {
+	watcher, err := s.watcher()
+	if err != nil {
+		return 0
+	}
+	return watcher.Revision()
+}
+
+func (s *instrumentedStorage) Watch(ctx context.Context, fromRevision uint64) (<-chan ChangeEvent, error) {
+	watcher, err := s.watcher()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	events, err := watcher.Watch(ctx, fromRevision)
+	s.record("watch", start, err)
+	return events, err
+}
+
+type instrumentedPrincipalResolver struct {
+	resolver PrincipalResolver
+	metrics  Metrics
+}
+
+// NewInstrumentedPrincipalResolver records the latency and errors of principal
+// expansion, for use with NewExpandingEvaluator.
+func NewInstrumentedPrincipalResolver(resolver PrincipalResolver, metrics Metrics) PrincipalResolver {
+	return &instrumentedPrincipalResolver{resolver: resolver, metrics: metrics}
+}
+
+func (r *instrumentedPrincipalResolver) ResolvePrincipals(principal Principal) ([]Principal, error) {
+	start := time.Now()
+	principals, err := r.resolver.ResolvePrincipals(principal)
+	r.metrics.ObserveHistogram(MetricResolvePrincipalsDuration, Labels{}, time.Since(start).Seconds())
+	if err != nil {
+		r.metrics.IncCounter(MetricResolvePrincipalsErrors, Labels{"class": errorClass(err)})
+	}
+	return principals, err
+}
+
+// errorClass maps an error to a small, fixed set of metric label values.
+func errorClass(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, ErrStatementNotFound):
+		return "not_found"
+	case errors.Is(err, ErrConflict):
+		return "conflict"
+	case errors.Is(err, ErrUnauthorized):
+		return "unauthorized"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrInvalidRequest):
+		return "invalid_request"
+	case errors.Is(err, ErrInvalidResponseSignature):
+		return "invalid_signature"
+	case errors.Is(err, ErrUpstreamUnavailable):
+		return "unavailable"
+	case errors.As(err, &netErr):
+		return "network"
+	default:
+		return "internal"
+	}
+}
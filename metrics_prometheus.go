@@ -0,0 +1,170 @@
+package authorization
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLatencyBuckets are the histogram buckets, in seconds, used by
+// NewPrometheusMetrics when none are given.
+var DefaultLatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var metricHelp = map[string]string{
+	MetricDecisions:                 "Authorization decisions by source, effect and decider.",
+	MetricDecisionErrors:            "Authorization decisions that failed with an error, by source and error class.",
+	MetricDecisionDuration:          "Latency of authorization decisions in seconds.",
+	MetricConditionErrors:           "Conditions that failed to evaluate, by statement.",
+	MetricStorageDuration:           "Latency of storage calls in seconds.",
+	MetricStorageErrors:             "Storage calls that failed, by operation and error class.",
+	MetricResolvePrincipalsDuration: "Latency of principal expansion in seconds.",
+	MetricResolvePrincipalsErrors:   "Principal expansions that failed, by error class.",
+}
+
+type prometheusHistogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// prometheusMetrics keeps metrics in memory and serves them in the Prometheus
+// text exposition format.
+type prometheusMetrics struct {
+	mu         sync.Mutex
+	buckets    []float64
+	counters   map[string]map[string]float64
+	histograms map[string]map[string]*prometheusHistogram
+}
+
+// NewPrometheusMetrics creates a Metrics implementation that is also an
+// http.Handler serving the recorded metrics for Prometheus to scrape.
+func NewPrometheusMetrics(buckets ...float64) *prometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &prometheusMetrics{
+		buckets:    buckets,
+		counters:   make(map[string]map[string]float64),
+		histograms: make(map[string]map[string]*prometheusHistogram),
+	}
+}
+
+func (m *prometheusMetrics) IncCounter(name string, labels Labels) {
+	key := formatLabels(labels)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series, ok := m.counters[name]
+	if !ok {
+		series = make(map[string]float64)
+		m.counters[name] = series
+	}
+	series[key]++
+}
+
+func (m *prometheusMetrics) ObserveHistogram(name string, labels Labels, value float64) {
+	key := formatLabels(labels)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series, ok := m.histograms[name]
+	if !ok {
+		series = make(map[string]*prometheusHistogram)
+		m.histograms[name] = series
+	}
+	h, ok := series[key]
+	if !ok {
+		h = &prometheusHistogram{counts: make([]uint64, len(m.buckets))}
+		series[key] = h
+	}
+	for i, bound := range m.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+func (m *prometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format.
+func (m *prometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	for _, name := range sortedKeys(m.counters) {
+		writeMetricHeader(&b, name, "counter")
+		for _, labels := range sortedKeys(m.counters[name]) {
+			fmt.Fprintf(&b, "%s%s %s\n", name, labels, formatFloat(m.counters[name][labels]))
+		}
+	}
+	for _, name := range sortedKeys(m.histograms) {
+		writeMetricHeader(&b, name, "histogram")
+		for _, labels := range sortedKeys(m.histograms[name]) {
+			h := m.histograms[name][labels]
+			for i, bound := range m.buckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLabel(labels, "le", formatFloat(bound)), h.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLabel(labels, "le", "+Inf"), h.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", name, labels, formatFloat(h.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, labels, h.count)
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func writeMetricHeader(b *strings.Builder, name, metricType string) {
+	if help, ok := metricHelp[name]; ok {
+		fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	}
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, metricType)
+}
+
+// formatLabels renders labels sorted by name, e.g. `{action="read",effect="allow"}`,
+// which also serves as the key of the series.
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels))
+	for _, name := range sortedKeys(labels) {
+		pairs = append(pairs, name+`="`+escapeLabelValue(labels[name])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel appends a label to already formatted labels.
+func withLabel(labels, name, value string) string {
+	pair := name + `="` + escapeLabelValue(value) + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return strings.TrimSuffix(labels, "}") + "," + pair + "}"
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
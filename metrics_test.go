@@ -0,0 +1,242 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrapeMetrics(t *testing.T, metrics http.Handler) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	return rec.Body.String()
+}
+
+func TestInstrumentedEvaluator(t *testing.T) {
+	storage := NewInMemoryStorage()
+	require.NoError(t, storage.SaveStatement(Statement{
+		ID: "allow-read", Effect: EffectAllow,
+		Principals: []Principal{"users/mark"}, Actions: []ActionID{"read"}, Resources: []Resource{"*"},
+	}))
+	require.NoError(t, storage.SaveStatement(Statement{
+		ID: "broken", Effect: EffectAllow,
+		Principals: []Principal{"users/mark"}, Actions: []ActionID{"write"}, Resources: []Resource{"*"},
+		Conditions: []Condition{{Name: "broken", Expression: "unknown.field > 1"}},
+	}))
+	metrics := NewPrometheusMetrics(0.1, 1)
+	evaluator := NewInstrumentedEvaluator(NewEvaluator(NewInstrumentedStorage(storage, metrics)), metrics, WithActionLabel())
+
+	for _, action := range []ActionID{"read", "read", "write"} {
+		_, err := evaluator.Evaluate(Request{Principal: "users/mark", Action: action, Resource: "doc"})
+		require.NoError(t, err)
+	}
+
+	body := scrapeMetrics(t, metrics)
+	assert.Contains(t, body, "# TYPE authz_decisions_total counter\n")
+	assert.Contains(t, body, `authz_decisions_total{action="read",decider="allow-read",effect="allow",source="evaluator"} 2`)
+	assert.Contains(t, body, `authz_decisions_total{action="write",decider="",effect="deny",source="evaluator"} 1`)
+	assert.Contains(t, body, `authz_condition_errors_total{statement="broken"} 1`)
+	assert.Contains(t, body, "# TYPE authz_decision_duration_seconds histogram\n")
+	assert.Contains(t, body, `authz_decision_duration_seconds_bucket{effect="allow",source="evaluator",le="+Inf"} 2`)
+	assert.Contains(t, body, `authz_decision_duration_seconds_count{effect="allow",source="evaluator"} 2`)
+	assert.Contains(t, body, `authz_storage_duration_seconds_count{operation="list_statements_by_principal"} 3`)
+}
+
+func TestInstrumentedEvaluator_Errors(t *testing.T) {
+	metrics := NewPrometheusMetrics()
+	storage := NewInstrumentedStorage(&mockStorage{listStatementsErr: context.DeadlineExceeded}, metrics)
+	evaluator := NewInstrumentedEvaluator(NewEvaluator(storage), metrics)
+
+	_, err := evaluator.Evaluate(Request{Principal: "users/mark"})
+	require.Error(t, err)
+
+	body := scrapeMetrics(t, metrics)
+	assert.Contains(t, body, `authz_decision_errors_total{class="timeout",source="evaluator"} 1`)
+	assert.Contains(t, body, `authz_storage_errors_total{class="timeout",operation="list_statements_by_principal"} 1`)
+	assert.NotContains(t, body, "authz_decisions_total")
+}
+
+func TestInstrumentedExpandingEvaluator(t *testing.T) {
+	storage := NewInMemoryStorage()
+	require.NoError(t, storage.SaveStatement(Statement{
+		ID: "allow-read", Effect: EffectAllow,
+		Principals: []Principal{"users/*"}, Actions: []ActionID{"read"}, Resources: []Resource{"*"},
+	}))
+	metrics := NewPrometheusMetrics()
+	resolver := NewInstrumentedPrincipalResolver(NewInMemoryPrincipalResolver(), metrics)
+	evaluator := NewInstrumentedEvaluator(NewExpandingEvaluator(NewEvaluator(storage), resolver), metrics)
+
+	for _, principal := range []Principal{"users/mark", "users/alice"} {
+		resp, err := evaluator.Evaluate(Request{Principal: principal, Action: "read", Resource: "doc"})
+		require.NoError(t, err)
+		assert.Equal(t, EffectAllow, resp.Effect)
+	}
+	resp, err := evaluator.Evaluate(Request{Principal: "users/mark", Action: "write", Resource: "doc"})
+	require.NoError(t, err)
+	assert.Equal(t, EffectDeny, resp.Effect)
+
+	body := scrapeMetrics(t, metrics)
+	assert.Contains(t, body, `authz_decisions_total{decider="principal_expansion",effect="allow",source="expanding_evaluator"} 2`,
+		"deciders naming the principal are reduced to their kind")
+	assert.Contains(t, body, `authz_decisions_total{decider="",effect="deny",source="expanding_evaluator"} 1`)
+	assert.NotContains(t, body, "users/", "principals and actions are not labels by default")
+	assert.NotContains(t, body, `action=`)
+	assert.Contains(t, body, "authz_resolve_principals_duration_seconds_count 3")
+}
+
+func TestInstrumentedStorage_OptionalInterfaces(t *testing.T) {
+	metrics := NewPrometheusMetrics()
+	inner := NewInMemoryStorage()
+	monday := time.Date(2025, 6, 30, 9, 0, 0, 0, time.UTC)
+	inner.now = func() time.Time { return monday }
+	storage := NewInstrumentedStorage(inner, metrics)
+
+	store, ok := storage.(StatementStore)
+	require.True(t, ok, "StatementStore is forwarded")
+	require.NoError(t, store.SaveStatement(Statement{
+		ID: "allow-read", Effect: EffectAllow,
+		Principals: []Principal{"users/mark"}, Actions: []ActionID{"read"}, Resources: []Resource{"*"},
+	}))
+	_, err := store.GetStatement("missing")
+	require.ErrorIs(t, err, ErrStatementNotFound)
+	_, ok = storage.(StatementWatcher)
+	assert.True(t, ok, "StatementWatcher is forwarded")
+	_, ok = storage.(StatementHistory)
+	require.True(t, ok, "StatementHistory is forwarded")
+
+	inner.now = func() time.Time { return monday.AddDate(0, 0, 2) }
+	require.NoError(t, store.DeleteStatement("allow-read"))
+	resp, err := NewEvaluator(storage, WithPointInTime(monday.AddDate(0, 0, 1))).Evaluate(Request{Principal: "users/mark", Action: "read", Resource: "doc"})
+	require.NoError(t, err)
+	assert.Equal(t, EffectAllow, resp.Effect, "point-in-time evaluation works through the instrumented storage")
+
+	body := scrapeMetrics(t, metrics)
+	assert.Contains(t, body, `authz_storage_duration_seconds_count{operation="save_statement"} 1`)
+	assert.Contains(t, body, `authz_storage_errors_total{class="not_found",operation="get_statement"} 1`)
+	assert.Contains(t, body, `authz_storage_duration_seconds_count{operation="list_statements_by_principal_at"} 1`)
+}
+
+func TestInstrumentedStorage_InterfaceCombinations(t *testing.T) {
+	inner := NewInMemoryStorage()
+	require.NoError(t, inner.SaveStatement(Statement{ID: "a", Effect: EffectAllow, Principals: []Principal{"users/mark"}}))
+	for _, tc := range []struct {
+		name                    string
+		storage                 Storage
+		store, history, watcher bool
+	}{
+		{name: "storage", storage: struct{ Storage }{inner}},
+		{name: "store", storage: struct{ StatementStore }{inner}, store: true},
+		{name: "history", storage: struct {
+			Storage
+			StatementHistory
+		}{inner, inner}, history: true},
+		{name: "watcher", storage: struct {
+			Storage
+			StatementWatcher
+		}{inner, inner}, watcher: true},
+		{name: "store and history", storage: struct {
+			StatementStore
+			StatementHistory
+		}{inner, inner}, store: true, history: true},
+		{name: "store and watcher", storage: struct {
+			StatementStore
+			StatementWatcher
+		}{inner, inner}, store: true, watcher: true},
+		{name: "history and watcher", storage: struct {
+			Storage
+			StatementHistory
+			StatementWatcher
+		}{inner, inner, inner}, history: true, watcher: true},
+		{name: "all", storage: inner, store: true, history: true, watcher: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := NewInstrumentedStorage(tc.storage, NewPrometheusMetrics())
+			statements, err := storage.ListStatementsByPrincipal("users/mark")
+			require.NoError(t, err)
+			assert.Len(t, statements, 1)
+
+			supported := func(want bool, err error) {
+				t.Helper()
+				if want {
+					assert.NoError(t, err)
+				} else {
+					assert.ErrorIs(t, err, ErrNotSupported)
+				}
+			}
+			_, err = storage.(StatementStore).GetStatement("a")
+			supported(tc.store, err)
+			_, err = storage.(StatementHistory).ListStatementVersions("a")
+			supported(tc.history, err)
+			_, err = storage.(StatementWatcher).Watch(t.Context(), inner.Revision())
+			supported(tc.watcher, err)
+			if tc.watcher {
+				assert.Equal(t, inner.Revision(), storage.(StatementWatcher).Revision())
+			} else {
+				assert.Zero(t, storage.(StatementWatcher).Revision())
+			}
+		})
+	}
+}
+
+func TestInstrumentedRemoteAuthorizer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"effect":"allow","decider":"remote-stmt"}`))
+	}))
+	defer server.Close()
+
+	metrics := NewPrometheusMetrics()
+	authorizer := NewInstrumentedRemoteAuthorizer(NewBetandbeatRemoteAuthorizer(server.URL, func() (string, error) { return "token", nil }), metrics)
+	_, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark", Action: "read", Resource: "doc"})
+	require.NoError(t, err)
+
+	failing := NewInstrumentedRemoteAuthorizer(NewBetandbeatRemoteAuthorizer(server.URL, func() (string, error) { return "", errors.New("no token") }), metrics)
+	_, err = failing.Authorize(t.Context(), Request{Principal: "users/mark"})
+	require.Error(t, err)
+
+	body := scrapeMetrics(t, metrics)
+	assert.Contains(t, body, `authz_decisions_total{decider="remote-stmt",effect="allow",source="remote"} 1`)
+	assert.Contains(t, body, `authz_decision_errors_total{class="internal",source="remote"} 1`)
+}
+
+func TestPrometheusMetrics_Format(t *testing.T) {
+	metrics := NewPrometheusMetrics(1, 0.5)
+	metrics.IncCounter("custom_total", Labels{"path": "a\"b\\c\nd"})
+	metrics.ObserveHistogram("custom_seconds", nil, 0.7)
+	metrics.ObserveHistogram("custom_seconds", nil, 2)
+
+	var b strings.Builder
+	_, err := metrics.WriteTo(&b)
+	require.NoError(t, err)
+	assert.Equal(t, `# TYPE custom_total counter
+custom_total{path="a\"b\\c\nd"} 1
+# TYPE custom_seconds histogram
+custom_seconds_bucket{le="0.5"} 0
+custom_seconds_bucket{le="1"} 1
+custom_seconds_bucket{le="+Inf"} 2
+custom_seconds_sum 2.7
+custom_seconds_count 2
+`, b.String())
+}
+
+func TestErrorClass(t *testing.T) {
+	assert.Equal(t, "timeout", errorClass(context.DeadlineExceeded))
+	assert.Equal(t, "canceled", errorClass(context.Canceled))
+	assert.Equal(t, "not_found", errorClass(ErrStatementNotFound))
+	assert.Equal(t, "conflict", errorClass(&ConflictError{StatementID: "s"}))
+	assert.Equal(t, "unauthorized", errorClass(&RemoteError{StatusCode: 403}))
+	assert.Equal(t, "rate_limited", errorClass(&RemoteError{StatusCode: 429}))
+	assert.Equal(t, "invalid_request", errorClass(&RemoteError{StatusCode: 400}))
+	assert.Equal(t, "unavailable", errorClass(&RemoteError{StatusCode: 503}))
+	assert.Equal(t, "invalid_signature", errorClass(ErrInvalidResponseSignature))
+	assert.Equal(t, "internal", errorClass(errors.New("boom")))
+}
@@ -0,0 +1,132 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// MiddlewareConfig configures AuthorizationMiddleware and EvaluatorMiddleware.
+type MiddlewareConfig struct {
+	// Routes map requests to actions and resources, e.g. with the action IDs
+	// of the iam_actions catalog.
+	Routes []Route
+	// Principal identifies the principal of a request. Returning
+	// ErrNoPrincipal, or any other error, responds 401 Unauthorized.
+	Principal PrincipalExtractor
+	// TrustedProxies are the proxies whose forwarding header tells the client
+	// IP, see ContextFromHTTPRequest.
+	TrustedProxies TrustedProxies
+	// AllowUnrouted passes requests matching no route through unchecked.
+	// By default they are forbidden.
+	AllowUnrouted bool
+	// Unauthorized writes the response to requests without a principal.
+	// Defaults to a 401 problem details response that does not reveal err.
+	Unauthorized func(w http.ResponseWriter, r *http.Request, err error)
+	// Forbidden writes the response to denied requests; resp is the zero
+	// Response for requests matching no route. Defaults to a 403 problem
+	// details response.
+	Forbidden func(w http.ResponseWriter, r *http.Request, resp Response)
+	// Error writes the response when authorization fails. Defaults to a 500
+	// problem details response.
+	Error func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+type decisionKey struct{}
+
+// DecisionFromContext returns the decision allowing a request passed by
+// AuthorizationMiddleware or EvaluatorMiddleware.
+func DecisionFromContext(ctx context.Context) (Decision, bool) {
+	decision, ok := ctx.Value(decisionKey{}).(Decision)
+	return decision, ok
+}
+
+// EvaluatorMiddleware enforces authorization decided by evaluator, see
+// AuthorizationMiddleware.
+func EvaluatorMiddleware(evaluator Evaluator, config MiddlewareConfig) func(http.Handler) http.Handler {
+	authorize := func(ctx context.Context, req Request) (Response, error) {
+		return evaluateWithContext(ctx, evaluator, req)
+	}
+	return newAuthorizationMiddleware(authorize, DecisionSourceEvaluator, config)
+}
+
+// AuthorizationMiddleware enforces authorization decided by authorizer. It
+// maps each request to a Request with the route it matches, the principal
+// extracted from it and its context, and passes allowed requests on with the
+// decision, available from DecisionFromContext. It panics if a route pattern
+// is invalid.
+func AuthorizationMiddleware(authorizer RemoteAuthorizer, config MiddlewareConfig) func(http.Handler) http.Handler {
+	return newAuthorizationMiddleware(authorizer.Authorize, DecisionSourceRemote, config)
+}
+
+func newAuthorizationMiddleware(authorize func(ctx context.Context, req Request) (Response, error), source DecisionSource, config MiddlewareConfig) func(http.Handler) http.Handler {
+	if config.Principal == nil {
+		panic("authorization middleware requires a principal extractor")
+	}
+	if config.Unauthorized == nil {
+		config.Unauthorized = func(w http.ResponseWriter, r *http.Request, err error) {
+			writeProblem(w, http.StatusUnauthorized, "missing or invalid principal")
+		}
+	}
+	if config.Forbidden == nil {
+		config.Forbidden = func(w http.ResponseWriter, r *http.Request, resp Response) {
+			writeProblem(w, http.StatusForbidden, "access denied")
+		}
+	}
+	if config.Error == nil {
+		config.Error = func(w http.ResponseWriter, r *http.Request, err error) {
+			writeProblem(w, http.StatusInternalServerError, "authorization failed")
+		}
+	}
+	routes := newRouteMatcher(config.Routes)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			action, resource, ok := routes.match(r)
+			if !ok {
+				if config.AllowUnrouted {
+					next.ServeHTTP(w, r)
+				} else {
+					config.Forbidden(w, r, Response{})
+				}
+				return
+			}
+			principal, err := config.Principal(r)
+			if err != nil {
+				config.Unauthorized(w, r, err)
+				return
+			}
+
+			req := Request{
+				Principal: principal,
+				Action:    action,
+				Resource:  resource,
+				Context:   ContextFromHTTPRequest(r, config.TrustedProxies),
+			}
+			start := req.Context.Request.At
+			resp, err := authorize(r.Context(), req)
+			if err != nil {
+				config.Error(w, r, fmt.Errorf("failed to authorize %s on %s: %w", action, resource, err))
+				return
+			}
+			if !resp.Allowed() {
+				config.Forbidden(w, r, resp)
+				return
+			}
+
+			decision := Decision{
+				ID:       resp.DecisionID,
+				Source:   source,
+				Time:     start,
+				Request:  req,
+				Response: resp,
+				Latency:  time.Since(start),
+			}
+			if resp.Decider != nil {
+				decision.StatementID = *resp.Decider
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), decisionKey{}, decision)))
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMiddlewareTestConfig() MiddlewareConfig {
+	return MiddlewareConfig{
+		Routes: []Route{
+			{Pattern: "GET /users/{id}", Action: "iam:GetUser", Resource: "users/{id}"},
+			{Pattern: "DELETE /users/{id}", Action: "iam:DeleteUser", Resource: "users/{id}"},
+		},
+		Principal: PrincipalFromHeader("X-Principal"),
+	}
+}
+
+func serveMiddleware(middleware func(http.Handler) http.Handler, method, path, principal string) (*httptest.ResponseRecorder, *Decision) {
+	var decision *Decision
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d, ok := DecisionFromContext(r.Context()); ok {
+			decision = &d
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "192.0.2.10:4321"
+	req.Header.Set("User-Agent", "admin-console")
+	if principal != "" {
+		req.Header.Set("X-Principal", principal)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec, decision
+}
+
+func TestEvaluatorMiddleware(t *testing.T) {
+	storage := NewInMemoryStorage()
+	require.NoError(t, storage.SaveStatement(Statement{
+		ID:         "support",
+		Active:     true,
+		Effect:     EffectAllow,
+		Principals: []Principal{"users/support"},
+		Actions:    []ActionID{"iam:GetUser"},
+		Resources:  []Resource{"users/*"},
+		Conditions: []Condition{{Name: "internal", Expression: `context.Request.IP startsWith "192.0.2."`}},
+	}))
+	middleware := EvaluatorMiddleware(NewEvaluator(storage), newMiddlewareTestConfig())
+
+	rec, decision := serveMiddleware(middleware, http.MethodGet, "/users/42", "users/support")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.NotNil(t, decision)
+	assert.Equal(t, DecisionSourceEvaluator, decision.Source)
+	assert.Equal(t, "support", decision.StatementID)
+	assert.Equal(t, Resource("users/42"), decision.Request.Resource)
+	assert.Equal(t, "192.0.2.10", decision.Request.Context.Request.IP)
+	assert.Equal(t, "admin-console", decision.Request.Context.Request.UserAgent)
+	assert.False(t, decision.Request.Context.Request.At.IsZero())
+
+	rec, decision = serveMiddleware(middleware, http.MethodDelete, "/users/42", "users/support")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+	assert.Nil(t, decision)
+
+	rec, _ = serveMiddleware(middleware, http.MethodGet, "/users/42", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec, _ = serveMiddleware(middleware, http.MethodGet, "/health", "users/support")
+	assert.Equal(t, http.StatusForbidden, rec.Code, "unrouted requests are forbidden by default")
+}
+
+func TestAuthorizationMiddleware_UnauthorizedHidesError(t *testing.T) {
+	config := newMiddlewareTestConfig()
+	config.Principal = func(r *http.Request) (Principal, error) {
+		return "", errors.New("token signed by unknown key k-internal-7")
+	}
+	authorizer := remoteAuthorizerFunc(func(ctx context.Context, req Request) (Response, error) {
+		return Response{Effect: EffectAllow}, nil
+	})
+
+	rec, _ := serveMiddleware(AuthorizationMiddleware(authorizer, config), http.MethodGet, "/users/42", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), "missing or invalid principal")
+	assert.NotContains(t, rec.Body.String(), "k-internal-7")
+
+	var got error
+	config.Unauthorized = func(w http.ResponseWriter, r *http.Request, err error) {
+		got = err
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	rec, _ = serveMiddleware(AuthorizationMiddleware(authorizer, config), http.MethodGet, "/users/42", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.ErrorContains(t, got, "k-internal-7", "the hook receives the error")
+}
+
+func TestAuthorizationMiddleware_Config(t *testing.T) {
+	var got Request
+	authorizer := remoteAuthorizerFunc(func(ctx context.Context, req Request) (Response, error) {
+		got = req
+		if req.Principal == "users/broken" {
+			return Response{Effect: EffectDeny}, errors.New("service down")
+		}
+		return Response{Effect: EffectDeny, Message: "nope"}, nil
+	})
+	config := newMiddlewareTestConfig()
+	config.AllowUnrouted = true
+	config.Forbidden = func(w http.ResponseWriter, r *http.Request, resp Response) {
+		http.Error(w, resp.Message, http.StatusNotFound)
+	}
+	config.Error = func(w http.ResponseWriter, r *http.Request, err error) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	}
+	middleware := AuthorizationMiddleware(authorizer, config)
+
+	rec, _ := serveMiddleware(middleware, http.MethodGet, "/users/7", "users/bob")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "nope\n", rec.Body.String())
+	assert.Equal(t, ActionID("iam:GetUser"), got.Action)
+
+	rec, _ = serveMiddleware(middleware, http.MethodGet, "/users/7", "users/broken")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "failed to authorize iam:GetUser on users/7: service down")
+
+	rec, decision := serveMiddleware(middleware, http.MethodGet, "/health", "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Nil(t, decision, "unrouted requests are not authorized")
+}
@@ -0,0 +1,45 @@
+CREATE TABLE authz_statements (
+    id VARCHAR(255) PRIMARY KEY,
+    active BOOLEAN NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL,
+    effect VARCHAR(16) NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    updated_at DATETIME(6) NOT NULL,
+    created_by VARCHAR(255) NOT NULL,
+    updated_by VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE authz_statement_principals (
+    statement_id VARCHAR(255) NOT NULL REFERENCES authz_statements (id) ON DELETE CASCADE,
+    ordinal INTEGER NOT NULL,
+    principal VARCHAR(512) NOT NULL,
+    literal_prefix VARCHAR(512),
+    PRIMARY KEY (statement_id, ordinal)
+);
+
+CREATE INDEX authz_statement_principals_principal_idx ON authz_statement_principals (principal);
+
+CREATE INDEX authz_statement_principals_literal_prefix_idx ON authz_statement_principals (literal_prefix);
+
+CREATE TABLE authz_statement_actions (
+    statement_id VARCHAR(255) NOT NULL REFERENCES authz_statements (id) ON DELETE CASCADE,
+    ordinal INTEGER NOT NULL,
+    action VARCHAR(512) NOT NULL,
+    PRIMARY KEY (statement_id, ordinal)
+);
+
+CREATE TABLE authz_statement_resources (
+    statement_id VARCHAR(255) NOT NULL REFERENCES authz_statements (id) ON DELETE CASCADE,
+    ordinal INTEGER NOT NULL,
+    resource VARCHAR(1024) NOT NULL,
+    PRIMARY KEY (statement_id, ordinal)
+);
+
+CREATE TABLE authz_statement_conditions (
+    statement_id VARCHAR(255) NOT NULL REFERENCES authz_statements (id) ON DELETE CASCADE,
+    ordinal INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    expression TEXT NOT NULL,
+    PRIMARY KEY (statement_id, ordinal)
+);
@@ -0,0 +1,5 @@
+CREATE TABLE authz_revision (
+    revision BIGINT NOT NULL
+);
+
+INSERT INTO authz_revision (revision) SELECT COALESCE(MAX(revision), 0) FROM authz_statements;
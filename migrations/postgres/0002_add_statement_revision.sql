@@ -0,0 +1 @@
+ALTER TABLE authz_statements ADD COLUMN revision BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,71 @@
+// Package otelauthz adapts an OpenTelemetry tracer to authorization.Tracer.
+package otelauthz
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/betandbeat/authorization"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer creates an authorization.Tracer starting spans with t, for use
+// with authorization.WithTracer.
+func NewTracer(t trace.Tracer) authorization.Tracer {
+	return &tracer{tracer: t}
+}
+
+func (t *tracer) Start(ctx context.Context, name string) (context.Context, authorization.Span) {
+	ctx, s := t.tracer.Start(ctx, name)
+	return ctx, span{s}
+}
+
+type span struct {
+	span trace.Span
+}
+
+func (s span) SetAttribute(key string, value any) {
+	s.span.SetAttributes(keyValue(key, value))
+}
+
+func (s span) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s span) End() {
+	s.span.End()
+}
+
+func (s span) TraceParent() string {
+	sc := s.span.SpanContext()
+	if !sc.IsValid() {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID(), sc.SpanID(), sc.TraceFlags())
+}
+
+func keyValue(key string, value any) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case []string:
+		return attribute.StringSlice(key, v)
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
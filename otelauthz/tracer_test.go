@@ -0,0 +1,28 @@
+package otelauthz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracer_TraceParent(t *testing.T) {
+	tracer := NewTracer(trace.NewNoopTracerProvider().Tracer("authz"))
+
+	_, span := tracer.Start(context.Background(), "authz.evaluate")
+	assert.Empty(t, span.TraceParent(), "spans outside a valid trace have no traceparent")
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	_, span = tracer.Start(ctx, "authz.evaluate")
+	span.SetAttribute("authz.statement_count", 3)
+	span.End()
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", span.TraceParent())
+}
@@ -0,0 +1,191 @@
+package authorization
+
+import (
+	"fmt"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+)
+
+// ResidualFilter is what remains of the decisions for a principal and an
+// action when the resource is unknown, see PartialEvaluate. A resource is
+// allowed when an allow rule matches it and no deny rule does.
+type ResidualFilter struct {
+	Principal Principal      `json:"principal"`
+	Action    ActionID       `json:"action"`
+	Context   Context        `json:"context"`
+	Allow     []ResidualRule `json:"allow"`
+	Deny      []ResidualRule `json:"deny"`
+}
+
+// ResidualRule matches the resources matching one of its patterns for which
+// all its conditions hold.
+type ResidualRule struct {
+	StatementID string `json:"statementId"`
+	// Principal is the resolved principal the statement applies to, which
+	// the conditions see.
+	Principal Principal  `json:"principal"`
+	Resources []Resource `json:"resources"`
+	// Conditions are the conditions that depend on the resource; those that
+	// do not were decided by PartialEvaluate.
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// PartialEvaluate evaluates the statements of principal, expanded with
+// resolver if not nil, for action in context c, leaving the resource
+// unknown. Conditions not referring to the resource are decided right away,
+// as Evaluate would: an allow statement whose condition fails is dropped,
+// and a deny statement whose condition fails to evaluate no longer depends
+// on the conditions after it. Render the filter with ResidualFilter.SQL to
+// list the resources the principal may access, or check single resources
+// with ResidualFilter.Matches.
+func PartialEvaluate(storage Storage, resolver PrincipalResolver, principal Principal, action ActionID, c Context) (*ResidualFilter, error) {
+	principals := []Principal{principal}
+	if resolver != nil {
+		resolved, err := resolver.ResolvePrincipals(principal)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve principals: %w", err)
+		}
+		principals = resolved
+	}
+
+	filter := &ResidualFilter{Principal: principal, Action: action, Context: c}
+	// A statement reached through several principals is evaluated for each,
+	// as its conditions may depend on the principal.
+	seen := make(map[statementPrincipal]bool)
+	for _, p := range principals {
+		statements, err := storage.ListStatementsByPrincipal(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list statements: %w", err)
+		}
+		req := Request{Principal: p, Action: action, Context: c}
+		for _, stmt := range statements {
+			key := statementPrincipal{stmt.ID, p}
+			if seen[key] || !principalMatches(stmt.Principals, p) || !actionMatches(stmt.Actions, action) {
+				continue
+			}
+			seen[key] = true
+			rule, ok := partialRule(stmt, req)
+			if !ok {
+				continue
+			}
+			if stmt.Effect == EffectDeny {
+				filter.Deny = append(filter.Deny, rule)
+			} else {
+				filter.Allow = append(filter.Allow, rule)
+			}
+		}
+	}
+	return filter, nil
+}
+
+// partialRule decides the conditions of stmt not referring to the resource
+// and returns the rule that remains, if any.
+func partialRule(stmt Statement, req Request) (ResidualRule, bool) {
+	rule := ResidualRule{StatementID: stmt.ID, Principal: req.Principal, Resources: stmt.Resources}
+	for _, c := range stmt.Conditions {
+		tree, err := parser.Parse(c.Expression)
+		if err == nil && referencesResource(tree.Node) {
+			rule.Conditions = append(rule.Conditions, c)
+			continue
+		}
+		met, err := c.Evaluate(req)
+		if err != nil {
+			// Evaluate denies when a deny condition fails, once the
+			// conditions before it hold, and skips an allow statement whose
+			// condition fails.
+			if stmt.Effect == EffectDeny {
+				return rule, true
+			}
+			return ResidualRule{}, false
+		}
+		if !met {
+			return ResidualRule{}, false
+		}
+	}
+	return rule, true
+}
+
+// Matches reports whether the filter allows resource.
+func (f *ResidualFilter) Matches(resource Resource) (bool, error) {
+	for _, rule := range f.Deny {
+		matched, err := rule.matches(f.request(rule, resource))
+		if err != nil || matched {
+			// Deny when a deny condition fails, as Evaluate does.
+			return false, err
+		}
+	}
+	for _, rule := range f.Allow {
+		if matched, err := rule.matches(f.request(rule, resource)); err == nil && matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// request returns the request the conditions of rule see for resource.
+func (f *ResidualFilter) request(rule ResidualRule, resource Resource) Request {
+	return Request{Principal: rule.Principal, Action: f.Action, Resource: resource, Context: f.Context}
+}
+
+func (r ResidualRule) matches(req Request) (bool, error) {
+	if !resourceMatches(r.Resources, req.Resource) {
+		return false, nil
+	}
+	for _, c := range r.Conditions {
+		met, err := c.Evaluate(req)
+		if err != nil || !met {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// referencesResource reports whether an expression refers to the resource,
+// by name or through $env. Any use of $env other than reading another
+// variable by a constant name, such as get($env, "resource"), counts as a
+// reference.
+func referencesResource(node ast.Node) bool {
+	others := make(map[ast.Node]bool)
+	ast.Find(node, func(node ast.Node) bool {
+		if member, ok := node.(*ast.MemberNode); ok && isEnv(member.Node) {
+			if property, ok := member.Property.(*ast.StringNode); ok && property.Value != "resource" {
+				others[member.Node] = true
+			}
+		}
+		return false
+	})
+	return ast.Find(node, func(node ast.Node) bool {
+		identifier, ok := node.(*ast.IdentifierNode)
+		return ok && (identifier.Value == "resource" || isEnv(node) && !others[node])
+	}) != nil
+}
+
+// isResource reports whether node is the resource variable, read as resource,
+// $env.resource or $env["resource"].
+func isResource(node ast.Node) bool {
+	if identifier, ok := node.(*ast.IdentifierNode); ok {
+		return identifier.Value == "resource"
+	}
+	member, ok := node.(*ast.MemberNode)
+	if !ok || member.Optional || !isEnv(member.Node) {
+		return false
+	}
+	property, ok := member.Property.(*ast.StringNode)
+	return ok && property.Value == "resource"
+}
+
+func isEnv(node ast.Node) bool {
+	identifier, ok := node.(*ast.IdentifierNode)
+	return ok && identifier.Value == "$env"
+}
+
+// evaluateConstant evaluates an expression not referring to the resource.
+func evaluateConstant(node ast.Node, req Request) (any, error) {
+	program, err := expr.Compile(node.String())
+	if err != nil {
+		return nil, err
+	}
+	return expr.Run(program, req)
+}
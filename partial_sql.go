@@ -0,0 +1,456 @@
+package authorization
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+)
+
+// ErrUntranslatableFilter is returned by ResidualFilter.SQL when a resource
+// pattern or a condition cannot be expressed in SQL. Fall back to fetching
+// the rows and checking them with ResidualFilter.Matches.
+var ErrUntranslatableFilter = errors.New("filter cannot be translated to SQL")
+
+// SQLFilterConfig configures ResidualFilter.SQL.
+type SQLFilterConfig struct {
+	// ResourceColumn is the column holding the resource of a row, or an SQL
+	// expression building it, such as "'documents/' || id". Comparisons
+	// assume a case-sensitive collation, as resource patterns are; with
+	// MySQL's case-insensitive defaults use "BINARY resource" or a column
+	// with a binary collation such as utf8mb4_bin.
+	ResourceColumn string
+	// Placeholder returns the placeholder of the nth parameter, counting from
+	// 1. Defaults to "?"; use DollarPlaceholder for PostgreSQL.
+	Placeholder func(n int) string
+	// RegexOperator matches a value against a POSIX regular expression, such
+	// as "~" for PostgreSQL or "REGEXP" for MySQL. Resource patterns LIKE
+	// cannot express, and "matches" conditions, need it. The patterns of
+	// "matches" conditions are passed on only when they keep their meaning
+	// as POSIX extended regular expressions: flags, groups starting with
+	// "(?", escapes of letters and digits such as \d, escapes in brackets
+	// and non-greedy quantifiers make them untranslatable.
+	RegexOperator string
+}
+
+// DollarPlaceholder numbers placeholders as PostgreSQL does: $1, $2 and so on.
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// SQL renders the filter as the condition of a WHERE clause selecting the
+// allowed resources, with its parameters. Conditions may compare
+// string(resource) with ==, !=, in, startsWith, endsWith, contains and
+// matches, and combine comparisons with &&, || and !; the other side of a
+// comparison, and anything not referring to the resource, is evaluated right
+// away.
+func (f *ResidualFilter) SQL(config SQLFilterConfig) (string, []any, error) {
+	if config.ResourceColumn == "" {
+		return "", nil, errors.New("SQLFilterConfig.ResourceColumn is required")
+	}
+	if config.Placeholder == nil {
+		config.Placeholder = func(int) string { return "?" }
+	}
+	w := &sqlFilterWriter{config: config}
+
+	var allows []string
+	for _, rule := range f.Allow {
+		clause, err := w.rule(f, rule)
+		if err != nil {
+			return "", nil, err
+		}
+		allows = append(allows, clause)
+	}
+	if len(allows) == 0 {
+		return sqlFalse, nil, nil
+	}
+	where := "(" + strings.Join(allows, " OR ") + ")"
+	for _, rule := range f.Deny {
+		clause, err := w.rule(f, rule)
+		if err != nil {
+			return "", nil, err
+		}
+		where += " AND NOT " + clause
+	}
+	return where, w.args, nil
+}
+
+const (
+	sqlTrue  = "1 = 1"
+	sqlFalse = "1 = 0"
+	// sqlLikeEscape escapes LIKE wildcards; a backslash would need escaping
+	// itself in some dialects' string literals.
+	sqlLikeEscape = "!"
+)
+
+type sqlFilterWriter struct {
+	config SQLFilterConfig
+	args   []any
+}
+
+func (w *sqlFilterWriter) param(value any) string {
+	w.args = append(w.args, value)
+	return w.config.Placeholder(len(w.args))
+}
+
+// rule renders a rule: one of its patterns matches and all its conditions
+// hold.
+func (w *sqlFilterWriter) rule(f *ResidualFilter, rule ResidualRule) (string, error) {
+	var patterns []string
+	for _, resource := range rule.Resources {
+		clause, err := w.pattern(enhancePattern(string(resource)))
+		if err != nil {
+			return "", err
+		}
+		patterns = append(patterns, clause)
+	}
+	if len(patterns) == 0 {
+		return "(" + sqlFalse + ")", nil
+	}
+	clauses := []string{"(" + strings.Join(patterns, " OR ") + ")"}
+
+	req := Request{Principal: rule.Principal, Action: f.Action, Context: f.Context}
+	for _, c := range rule.Conditions {
+		tree, err := parser.Parse(c.Expression)
+		if err != nil {
+			return "", fmt.Errorf("%w: condition %q of statement %q: %v", ErrUntranslatableFilter, c.Name, rule.StatementID, err)
+		}
+		clause, err := w.condition(tree.Node, req)
+		if err != nil {
+			return "", fmt.Errorf("condition %q of statement %q: %w", c.Name, rule.StatementID, err)
+		}
+		clauses = append(clauses, clause)
+	}
+	return "(" + strings.Join(clauses, " AND ") + ")", nil
+}
+
+// pattern renders a resource pattern, with LIKE where it can.
+func (w *sqlFilterWriter) pattern(pattern string) (string, error) {
+	column := w.config.ResourceColumn
+	if pattern == "**" {
+		return sqlTrue, nil
+	}
+	if !isGlob(pattern) {
+		return column + " = " + w.param(unescapeGlob(pattern)), nil
+	}
+	// "prefix/**" matches the prefix and everything below it.
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok && !isGlob(prefix) {
+		prefix = unescapeGlob(prefix)
+		return fmt.Sprintf("(%s = %s OR %s LIKE %s ESCAPE '%s')",
+			column, w.param(prefix), column, w.param(escapeLike(prefix)+"/%"), sqlLikeEscape), nil
+	}
+	if w.config.RegexOperator == "" {
+		return "", fmt.Errorf("%w: resource pattern %q needs SQLFilterConfig.RegexOperator", ErrUntranslatableFilter, pattern)
+	}
+	regex, err := globToRegex(pattern)
+	if err != nil {
+		return "", err
+	}
+	return column + " " + w.config.RegexOperator + " " + w.param(regex), nil
+}
+
+// condition renders a condition referring to the resource.
+func (w *sqlFilterWriter) condition(node ast.Node, req Request) (string, error) {
+	if !referencesResource(node) {
+		value, err := evaluateConstant(node, req)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s: %v", ErrUntranslatableFilter, node, err)
+		}
+		met, ok := value.(bool)
+		if !ok {
+			return "", fmt.Errorf("%w: %s is not a boolean", ErrUntranslatableFilter, node)
+		}
+		if met {
+			return sqlTrue, nil
+		}
+		return sqlFalse, nil
+	}
+
+	column := w.config.ResourceColumn
+	switch n := node.(type) {
+	case *ast.UnaryNode:
+		if n.Operator == "!" || n.Operator == "not" {
+			clause, err := w.condition(n.Node, req)
+			if err != nil {
+				return "", err
+			}
+			return "NOT (" + clause + ")", nil
+		}
+	case *ast.BinaryNode:
+		switch n.Operator {
+		case "&&", "and", "||", "or":
+			left, err := w.condition(n.Left, req)
+			if err != nil {
+				return "", err
+			}
+			right, err := w.condition(n.Right, req)
+			if err != nil {
+				return "", err
+			}
+			operator := " AND "
+			if n.Operator == "||" || n.Operator == "or" {
+				operator = " OR "
+			}
+			return "(" + left + operator + right + ")", nil
+		case "==", "!=":
+			other := n.Right
+			if !isResourceString(n.Left) {
+				other = n.Left
+				if !isResourceString(n.Right) {
+					break
+				}
+			}
+			value, err := w.constantString(other, req)
+			if err != nil {
+				return "", err
+			}
+			operator := " = "
+			if n.Operator == "!=" {
+				operator = " <> "
+			}
+			return column + operator + w.param(value), nil
+		case "startsWith", "endsWith", "contains":
+			if !isResourceString(n.Left) {
+				break
+			}
+			value, err := w.constantString(n.Right, req)
+			if err != nil {
+				return "", err
+			}
+			pattern := escapeLike(value)
+			switch n.Operator {
+			case "startsWith":
+				pattern += "%"
+			case "endsWith":
+				pattern = "%" + pattern
+			default:
+				pattern = "%" + pattern + "%"
+			}
+			return fmt.Sprintf("%s LIKE %s ESCAPE '%s'", column, w.param(pattern), sqlLikeEscape), nil
+		case "in":
+			if !isResourceString(n.Left) || referencesResource(n.Right) {
+				break
+			}
+			value, err := evaluateConstant(n.Right, req)
+			if err != nil {
+				return "", fmt.Errorf("%w: %s: %v", ErrUntranslatableFilter, n.Right, err)
+			}
+			items, ok := value.([]any)
+			if !ok {
+				return "", fmt.Errorf("%w: %s is not an array", ErrUntranslatableFilter, n.Right)
+			}
+			if len(items) == 0 {
+				return sqlFalse, nil
+			}
+			placeholders := make([]string, len(items))
+			for i, item := range items {
+				s, ok := item.(string)
+				if !ok {
+					return "", fmt.Errorf("%w: %s holds a non-string", ErrUntranslatableFilter, n.Right)
+				}
+				placeholders[i] = w.param(s)
+			}
+			return column + " IN (" + strings.Join(placeholders, ", ") + ")", nil
+		case "matches":
+			if !isResourceString(n.Left) {
+				break
+			}
+			if w.config.RegexOperator == "" {
+				return "", fmt.Errorf("%w: %s needs SQLFilterConfig.RegexOperator", ErrUntranslatableFilter, node)
+			}
+			value, err := w.constantString(n.Right, req)
+			if err != nil {
+				return "", err
+			}
+			if err := portableRegex(value); err != nil {
+				return "", fmt.Errorf("%w: %s: %v", ErrUntranslatableFilter, node, err)
+			}
+			return column + " " + w.config.RegexOperator + " " + w.param(value), nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUntranslatableFilter, node)
+}
+
+// constantString evaluates an expression not referring to the resource to a
+// string.
+func (w *sqlFilterWriter) constantString(node ast.Node, req Request) (string, error) {
+	if referencesResource(node) {
+		return "", fmt.Errorf("%w: %s", ErrUntranslatableFilter, node)
+	}
+	value, err := evaluateConstant(node, req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrUntranslatableFilter, node, err)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: %s is not a string", ErrUntranslatableFilter, node)
+	}
+	return s, nil
+}
+
+// isResourceString reports whether node is string(resource). Conditions
+// must convert the resource to compare it with strings, as its type is
+// Resource.
+func isResourceString(node ast.Node) bool {
+	builtin, ok := node.(*ast.BuiltinNode)
+	return ok && builtin.Name == "string" && len(builtin.Arguments) == 1 && isResource(builtin.Arguments[0])
+}
+
+// portableRegex checks that an RE2 pattern means the same as a POSIX
+// extended regular expression, which the regular expression operators of
+// databases understand. The check is conservative: it may reject a bracket
+// expression holding "(?" that would have been portable.
+func portableRegex(pattern string) error {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\' && i+1 < len(pattern):
+			next := pattern[i+1]
+			if 'a' <= next && next <= 'z' || 'A' <= next && next <= 'Z' || '0' <= next && next <= '9' {
+				return fmt.Errorf("escape \\%c is not portable", next)
+			}
+			i++
+		case c == '(' && strings.HasPrefix(pattern[i+1:], "?"):
+			return errors.New("flags and special groups are not portable")
+		case c == '[':
+			// Backslashes are literal in POSIX bracket expressions.
+			end := bracketEnd(pattern, i)
+			if strings.Contains(pattern[i:end], `\`) {
+				return errors.New("escapes in bracket expressions are not portable")
+			}
+			i = end - 1
+		}
+	}
+	if hasNonGreedy(re) {
+		return errors.New("non-greedy quantifiers are not portable")
+	}
+	return nil
+}
+
+// bracketEnd returns the index after the bracket expression starting at
+// start, which syntax.Parse has found to be terminated.
+func bracketEnd(pattern string, start int) int {
+	i := start + 1
+	if i < len(pattern) && pattern[i] == '^' {
+		i++
+	}
+	if i < len(pattern) && pattern[i] == ']' {
+		i++
+	}
+	for i < len(pattern) {
+		switch {
+		case strings.HasPrefix(pattern[i:], "[:"):
+			if end := strings.Index(pattern[i+2:], ":]"); end >= 0 {
+				i += end + 4
+				continue
+			}
+		case pattern[i] == '\\':
+			i++
+		case pattern[i] == ']':
+			return i + 1
+		}
+		i++
+	}
+	return len(pattern)
+}
+
+func hasNonGreedy(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		if re.Flags&syntax.NonGreedy != 0 {
+			return true
+		}
+	}
+	for _, sub := range re.Sub {
+		if hasNonGreedy(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[{\`)
+}
+
+func unescapeGlob(s string) string {
+	return strings.ReplaceAll(s, `\`, "")
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(sqlLikeEscape, sqlLikeEscape+sqlLikeEscape, "%", sqlLikeEscape+"%", "_", sqlLikeEscape+"_").Replace(s)
+}
+
+// globToRegex translates a doublestar pattern to an anchored POSIX regular
+// expression matching the same strings.
+func globToRegex(pattern string) (string, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		atSegmentStart := i == 0 || pattern[i-1] == '/'
+		switch {
+		case c == '*' && strings.HasPrefix(pattern[i:], "**") && atSegmentStart && (i+2 == len(pattern) || pattern[i+2] == '/'):
+			// "**" as a whole segment matches any number of segments.
+			switch {
+			case i+2 == len(pattern) && i == 0:
+				b.WriteString(".*")
+			case i+2 == len(pattern):
+				// "a/**" also matches "a": make the preceding slash optional.
+				s := strings.TrimSuffix(b.String(), "/")
+				b.Reset()
+				b.WriteString(s + "(/.*)?")
+			default:
+				b.WriteString("(.*/)?")
+				i += 2
+				continue
+			}
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("%w: unterminated class in pattern %q", ErrUntranslatableFilter, pattern)
+			}
+			// Classes may match a separator: doublestar.Match, which the
+			// evaluator uses, matches "a/c" against "a[!b]c". Excluding "/"
+			// here would make deny rules exclude fewer rows than Evaluate.
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") || strings.HasPrefix(class, "^") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, "") + "]")
+			i += end + 1
+		case c == '{':
+			depth++
+			b.WriteString("(")
+		case c == ',' && depth > 0:
+			b.WriteString("|")
+		case c == '}' && depth > 0:
+			depth--
+			b.WriteString(")")
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	if depth > 0 {
+		return "", fmt.Errorf("%w: unterminated alternatives in pattern %q", ErrUntranslatableFilter, pattern)
+	}
+	b.WriteString("$")
+	return b.String(), nil
+}
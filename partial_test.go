@@ -0,0 +1,415 @@
+package authorization
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var partialTestStatements = []Statement{
+	{ID: "own", Effect: EffectAllow, Principals: []Principal{"users/alice"}, Actions: []ActionID{"docs:Read"}, Resources: []Resource{"documents/alice/**"}},
+	{ID: "editors", Effect: EffectAllow, Principals: []Principal{"roles/editor"}, Actions: []ActionID{"docs:*"}, Resources: []Resource{"documents/shared/*"},
+		Conditions: []Condition{
+			{Name: "office", Expression: `context.Request.IP startsWith "10."`},
+			{Name: "public", Expression: `not (string(resource) endsWith ".draft")`},
+		}},
+	{ID: "night", Effect: EffectAllow, Principals: []Principal{"roles/editor"}, Actions: []ActionID{"docs:Read"}, Resources: []Resource{"documents/archive"},
+		Conditions: []Condition{{Name: "night", Expression: `context.Request.At.Hour() < 6`}}},
+	{ID: "secrets", Effect: EffectDeny, Principals: []Principal{"roles/editor"}, Actions: []ActionID{"docs:Read"}, Resources: []Resource{"**"},
+		Conditions: []Condition{{Name: "secret", Expression: `string(resource) in ["documents/shared/keys", "documents/alice/keys"]`}}},
+	{ID: "other", Effect: EffectAllow, Principals: []Principal{"users/bob"}, Actions: []ActionID{"docs:Read"}, Resources: []Resource{"**"}},
+	{ID: "contractors", Effect: EffectDeny, Principals: []Principal{"**"}, Actions: []ActionID{"docs:Read"}, Resources: []Resource{"documents/shared/**"},
+		Conditions: []Condition{{Name: "contractor", Expression: `string(principal) == "roles/contractor"`}}},
+}
+
+func newPartialTestResolver() PrincipalResolver {
+	resolver := NewInMemoryPrincipalResolver()
+	resolver.AddRoleMapping("users/alice", []Principal{"roles/editor"})
+	resolver.AddRoleMapping("users/mark", []Principal{"roles/editor", "roles/contractor"})
+	return resolver
+}
+
+func TestPartialEvaluate(t *testing.T) {
+	var c Context
+	c.Request.IP = "10.0.0.1"
+	c.Request.At = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	filter, err := PartialEvaluate(newTestStorage(t, partialTestStatements...), newPartialTestResolver(), "users/alice", "docs:Read", c)
+	require.NoError(t, err)
+
+	assert.Equal(t, Principal("users/alice"), filter.Principal)
+	require.Len(t, filter.Allow, 2, "the night statement is dropped")
+	assert.Equal(t, "own", filter.Allow[0].StatementID)
+	assert.Empty(t, filter.Allow[0].Conditions)
+	assert.Equal(t, "editors", filter.Allow[1].StatementID)
+	assert.Equal(t, Principal("roles/editor"), filter.Allow[1].Principal)
+	require.Len(t, filter.Allow[1].Conditions, 1, "the office condition is decided")
+	assert.Equal(t, "public", filter.Allow[1].Conditions[0].Name)
+	require.Len(t, filter.Deny, 1)
+	assert.Equal(t, "secrets", filter.Deny[0].StatementID)
+
+	filter, err = PartialEvaluate(newTestStorage(t, partialTestStatements...), newPartialTestResolver(), "users/alice", "docs:Read", Context{Request: c.Request})
+	require.NoError(t, err)
+	require.Len(t, filter.Allow, 2)
+	assert.Equal(t, "own", filter.Allow[0].StatementID)
+	assert.Equal(t, "editors", filter.Allow[1].StatementID)
+
+	c.Request.IP = ""
+	filter, err = PartialEvaluate(newTestStorage(t, partialTestStatements...), newPartialTestResolver(), "users/alice", "docs:Read", c)
+	require.NoError(t, err)
+	require.Len(t, filter.Allow, 1, "the editors statement needs the office")
+	assert.Equal(t, "own", filter.Allow[0].StatementID)
+}
+
+func TestPartialEvaluate_WithoutResolver(t *testing.T) {
+	filter, err := PartialEvaluate(newTestStorage(t, partialTestStatements...), nil, "users/alice", "docs:Read", Context{})
+	require.NoError(t, err)
+	require.Len(t, filter.Allow, 1)
+	assert.Empty(t, filter.Deny, "role statements are not expanded")
+}
+
+func TestPartialEvaluate_DenyConditionError(t *testing.T) {
+	storage := NewInMemoryStorage()
+	require.NoError(t, storage.SaveStatement(Statement{ID: "all", Effect: EffectAllow, Principals: []Principal{"users/alice"}, Actions: []ActionID{"docs:Read"}, Resources: []Resource{"**"}}))
+	require.NoError(t, storage.SaveStatement(Statement{ID: "broken", Effect: EffectDeny, Principals: []Principal{"users/alice"}, Actions: []ActionID{"docs:Read"}, Resources: []Resource{"documents/*"},
+		Conditions: []Condition{
+			{Name: "drafts", Expression: `string(resource) endsWith ".draft"`},
+			{Name: "broken", Expression: `context.Request.At.Hour() > "x"`},
+			{Name: "never", Expression: `string(resource) == "none"`},
+		}}))
+
+	filter, err := PartialEvaluate(storage, nil, "users/alice", "docs:Read", Context{})
+	require.NoError(t, err)
+	require.Len(t, filter.Deny, 1)
+	require.Len(t, filter.Deny[0].Conditions, 1, "conditions after the failing one no longer apply")
+	assert.Equal(t, "drafts", filter.Deny[0].Conditions[0].Name)
+
+	evaluator := NewEvaluator(storage)
+	for _, resource := range []Resource{"documents/a.draft", "documents/none", "documents/a", "other/a.draft"} {
+		resp, err := evaluator.Evaluate(Request{Principal: "users/alice", Action: "docs:Read", Resource: resource})
+		require.NoError(t, err)
+		allowed, _ := filter.Matches(resource)
+		assert.Equal(t, resp.Allowed(), allowed, resource)
+	}
+}
+
+func TestPartialEvaluate_EnvResource(t *testing.T) {
+	storage := newTestStorage(t,
+		Statement{ID: "all", Effect: EffectAllow, Principals: []Principal{"users/alice"}, Actions: []ActionID{"docs:Read"}, Resources: []Resource{"**"}},
+		Statement{ID: "drafts", Effect: EffectDeny, Principals: []Principal{"users/alice"}, Actions: []ActionID{"docs:Read"}, Resources: []Resource{"**"},
+			Conditions: []Condition{{Name: "drafts", Expression: `string($env.resource) endsWith ".draft"`}}},
+		Statement{ID: "keys", Effect: EffectDeny, Principals: []Principal{"users/alice"}, Actions: []ActionID{"docs:Read"}, Resources: []Resource{"**"},
+			Conditions: []Condition{{Name: "keys", Expression: `string($env["resource"]) == "documents/keys"`}}},
+		Statement{ID: "secrets", Effect: EffectDeny, Principals: []Principal{"users/alice"}, Actions: []ActionID{"docs:Read"}, Resources: []Resource{"**"},
+			Conditions: []Condition{{Name: "secrets", Expression: `string(get($env, "resource")) == "documents/secret"`}}},
+		Statement{ID: "office", Effect: EffectDeny, Principals: []Principal{"users/alice"}, Actions: []ActionID{"docs:Read"}, Resources: []Resource{"**"},
+			Conditions: []Condition{{Name: "office", Expression: `$env.context.Request.IP == "10.6.6.6"`}}},
+	)
+	filter, err := PartialEvaluate(storage, nil, "users/alice", "docs:Read", Context{})
+	require.NoError(t, err)
+	var residual []string
+	for _, rule := range filter.Deny {
+		residual = append(residual, rule.StatementID)
+	}
+	assert.Equal(t, []string{"drafts", "keys", "secrets"}, residual, "the office condition is decided")
+
+	evaluator := NewEvaluator(storage)
+	for _, resource := range []Resource{"documents/a", "documents/a.draft", "documents/keys", "documents/secret"} {
+		resp, err := evaluator.Evaluate(Request{Principal: "users/alice", Action: "docs:Read", Resource: resource})
+		require.NoError(t, err)
+		allowed, err := filter.Matches(resource)
+		require.NoError(t, err)
+		assert.Equal(t, resp.Allowed(), allowed, resource)
+	}
+
+	_, _, err = filter.SQL(SQLFilterConfig{ResourceColumn: "resource"})
+	assert.ErrorIs(t, err, ErrUntranslatableFilter, "get($env, ...) is not translated")
+}
+
+func TestResidualFilter_AgreesWithEvaluator(t *testing.T) {
+	storage := newTestStorage(t, partialTestStatements...)
+	evaluator := NewExpandingEvaluator(NewEvaluator(storage), newPartialTestResolver())
+	var c Context
+	c.Request.IP = "10.0.0.1"
+	c.Request.At = time.Date(2025, 1, 1, 3, 0, 0, 0, time.UTC)
+
+	for _, principal := range []Principal{"users/alice", "users/bob", "users/carol", "users/mark"} {
+		filter, err := PartialEvaluate(storage, newPartialTestResolver(), principal, "docs:Read", c)
+		require.NoError(t, err)
+		where, args, err := filter.SQL(SQLFilterConfig{ResourceColumn: "resource", RegexOperator: "~"})
+		require.NoError(t, err)
+		for _, resource := range []Resource{
+			"documents/alice", "documents/alice/a", "documents/alice/keys", "documents/shared/a",
+			"documents/shared/a.draft", "documents/shared/keys", "documents/shared/a/b", "documents/archive",
+			"documents/shared_a", "documents/alice_x",
+		} {
+			resp, err := evaluator.Evaluate(Request{Principal: principal, Action: "docs:Read", Resource: resource, Context: c})
+			require.NoError(t, err)
+			allowed, err := filter.Matches(resource)
+			require.NoError(t, err)
+			assert.Equal(t, resp.Allowed(), allowed, "Matches for %s on %s", principal, resource)
+			assert.Equal(t, resp.Allowed(), evalSQLFilter(t, where, args, string(resource)), "SQL for %s on %s: %s", principal, resource, where)
+		}
+	}
+}
+
+func TestPartialEvaluate_PrincipalConditions(t *testing.T) {
+	filter, err := PartialEvaluate(newTestStorage(t, partialTestStatements...), newPartialTestResolver(), "users/mark", "docs:Read", Context{})
+	require.NoError(t, err)
+	var denies []string
+	for _, rule := range filter.Deny {
+		denies = append(denies, rule.StatementID+" "+string(rule.Principal))
+	}
+	assert.Contains(t, denies, "contractors roles/contractor", "the statement is evaluated for every principal")
+}
+
+func TestResidualFilter_SQL(t *testing.T) {
+	var c Context
+	c.Request.IP = "10.0.0.1"
+	c.Request.At = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	filter, err := PartialEvaluate(newTestStorage(t, partialTestStatements...), newPartialTestResolver(), "users/alice", "docs:Read", c)
+	require.NoError(t, err)
+
+	where, args, err := filter.SQL(SQLFilterConfig{ResourceColumn: "resource", Placeholder: DollarPlaceholder, RegexOperator: "~"})
+	require.NoError(t, err)
+	assert.Equal(t, `((((resource = $1 OR resource LIKE $2 ESCAPE '!'))) OR ((resource ~ $3) AND NOT (resource LIKE $4 ESCAPE '!'))) AND NOT ((1 = 1) AND resource IN ($5, $6))`, where)
+	assert.Equal(t, []any{"documents/alice", "documents/alice/%", "^documents/shared/[^/]*$", "%.draft", "documents/shared/keys", "documents/alice/keys"}, args)
+
+	_, _, err = filter.SQL(SQLFilterConfig{ResourceColumn: "resource"})
+	assert.ErrorIs(t, err, ErrUntranslatableFilter, "documents/shared/* needs a regular expression")
+}
+
+func TestResidualFilter_SQLNothingAllowed(t *testing.T) {
+	filter, err := PartialEvaluate(newTestStorage(t, partialTestStatements...), nil, "users/carol", "docs:Read", Context{})
+	require.NoError(t, err)
+	where, args, err := filter.SQL(SQLFilterConfig{ResourceColumn: "resource"})
+	require.NoError(t, err)
+	assert.Equal(t, "1 = 0", where)
+	assert.Empty(t, args)
+}
+
+func TestResidualFilter_SQLConditions(t *testing.T) {
+	var c Context
+	c.Request.IP = "10.0.0.1"
+	for _, tt := range []struct {
+		expression string
+		where      string
+		args       []any
+	}{
+		{`string(resource) == "a_b"`, `resource = ?`, []any{"a_b"}},
+		{`"a" != string(resource)`, `resource <> ?`, []any{"a"}},
+		{`string(resource) startsWith "a%"`, `resource LIKE ? ESCAPE '!'`, []any{"a!%%"}},
+		{`string(resource) contains "!"`, `resource LIKE ? ESCAPE '!'`, []any{"%!!%"}},
+		{`string(resource) not in ["a", "b"]`, `NOT (resource IN (?, ?))`, []any{"a", "b"}},
+		{`string(resource) in []`, `1 = 0`, nil},
+		{`string(resource) matches "^a+$"`, `resource REGEXP ?`, []any{"^a+$"}},
+		{`string(resource) matches "^a\\.b[]0-9[:alpha:]-]{2,}(x|y)?$"`, `resource REGEXP ?`, []any{`^a\.b[]0-9[:alpha:]-]{2,}(x|y)?$`}},
+		{`string($env.resource) == "a"`, `resource = ?`, []any{"a"}},
+		{`string($env["resource"]) startsWith $env.context.Request.IP`, `resource LIKE ? ESCAPE '!'`, []any{"10.0.0.1%"}},
+		{`string(resource) == "a" || context.Request.IP == "10.0.0.1"`, `(resource = ? OR 1 = 1)`, []any{"a"}},
+		{`!(string(resource) endsWith "x") and string(resource) == context.Request.IP + "/doc"`, `(NOT (resource LIKE ? ESCAPE '!') AND resource = ?)`, []any{"%x", "10.0.0.1/doc"}},
+	} {
+		filter := &ResidualFilter{
+			Principal: "users/alice",
+			Context:   c,
+			Allow:     []ResidualRule{{Principal: "users/alice", Resources: []Resource{"*"}, Conditions: []Condition{{Expression: tt.expression}}}},
+		}
+		where, args, err := filter.SQL(SQLFilterConfig{ResourceColumn: "resource", RegexOperator: "REGEXP"})
+		require.NoError(t, err, tt.expression)
+		assert.Equal(t, "(((1 = 1) AND "+tt.where+"))", where, tt.expression)
+		assert.Equal(t, tt.args, args, tt.expression)
+	}
+}
+
+func TestResidualFilter_SQLUntranslatable(t *testing.T) {
+	for _, expression := range []string{
+		`len(resource) > 3`,
+		`resource == "a"`,
+		`string(resource) == principal`,
+		`string(resource) startsWith context.Request.At.Hour()`,
+		`string(resource) == string(resource)`,
+		`string(resource) in [1, 2]`,
+		`string(resource) matches "a"`,
+		`string(get($env, "resource")) == "a"`,
+		`string($env?.resource) == "a"`,
+	} {
+		filter := &ResidualFilter{
+			Principal: "users/alice",
+			Allow:     []ResidualRule{{Principal: "users/alice", Resources: []Resource{"*"}, Conditions: []Condition{{Expression: expression}}}},
+		}
+		_, _, err := filter.SQL(SQLFilterConfig{ResourceColumn: "resource"})
+		assert.True(t, errors.Is(err, ErrUntranslatableFilter), "%s: %v", expression, err)
+	}
+}
+
+func TestResidualFilter_SQLNonPortableRegex(t *testing.T) {
+	for _, pattern := range []string{
+		`(?i)^documents/`,
+		`^(?:a|b)$`,
+		`^(?P<id>a)$`,
+		`^documents/\d+$`,
+		`\bdoc`,
+		`^a+?$`,
+		`^a{2,3}?$`,
+		`^[\w.]+$`,
+		`^[a\]]$`,
+		`\Qa.b\E`,
+	} {
+		filter := &ResidualFilter{
+			Principal: "users/alice",
+			Allow: []ResidualRule{{Principal: "users/alice", Resources: []Resource{"*"}, Conditions: []Condition{{
+				Expression: "string(resource) matches " + strconv.Quote(pattern),
+			}}}},
+		}
+		_, _, err := filter.SQL(SQLFilterConfig{ResourceColumn: "resource", RegexOperator: "~"})
+		assert.ErrorIs(t, err, ErrUntranslatableFilter, pattern)
+	}
+}
+
+func TestResidualFilter_SQLResourceColumnRequired(t *testing.T) {
+	_, _, err := (&ResidualFilter{}).SQL(SQLFilterConfig{})
+	assert.Error(t, err)
+}
+
+func TestGlobToRegex(t *testing.T) {
+	patterns := []string{
+		"**", "a/**", "a/**/b", "**/b", "a/*", "a/*/c", "a/?", "a/[bc]", "a/[!b]", "a/[^b]", "a[!b]c", "a[a-c/]c", "a/{b,c/d}", "a/b*", `a/\*`, "a.b/*", "a/**/*.go",
+	}
+	names := []string{
+		"", "a", "a/", "a/b", "a/c", "a/d", "a/b/c", "a/x/b", "a/x/y/b", "b", "x/b", "a/bc", "a/c/d", "a/*", "a.b/c", "axb/c", "a/x.go", "a/x/y.go", "a//b",
+		"a//", "abc", "a/C", // classes match separators as doublestar does
+	}
+	for _, pattern := range patterns {
+		regex, err := globToRegex(pattern)
+		require.NoError(t, err, pattern)
+		re := regexp.MustCompile(regex)
+		for _, name := range names {
+			want, err := doublestar.Match(pattern, name)
+			require.NoError(t, err)
+			assert.Equal(t, want, re.MatchString(name), "%s (%s) on %s", pattern, regex, strconv.Quote(name))
+		}
+	}
+
+	_, err := globToRegex("a/{b")
+	assert.ErrorIs(t, err, ErrUntranslatableFilter)
+}
+
+// evalSQLFilter interprets the SQL rendered by ResidualFilter.SQL, with "?"
+// placeholders and "~" as the regex operator, for a row holding resource.
+func evalSQLFilter(t *testing.T, where string, args []any, resource string) bool {
+	t.Helper()
+	p := &sqlFilterInterpreter{
+		tokens:   regexp.MustCompile(`<>|'!'|[()=~,?]|\w+`).FindAllString(where, -1),
+		args:     args,
+		resource: resource,
+	}
+	result := p.or()
+	require.Equal(t, len(p.tokens), p.pos, "unparsed SQL: %s", where)
+	require.Empty(t, p.args, "unused arguments: %s", where)
+	return result
+}
+
+type sqlFilterInterpreter struct {
+	tokens   []string
+	pos      int
+	args     []any
+	resource string
+}
+
+func (p *sqlFilterInterpreter) next() string {
+	token := p.tokens[p.pos]
+	p.pos++
+	return token
+}
+
+func (p *sqlFilterInterpreter) peek(token string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos] == token
+}
+
+func (p *sqlFilterInterpreter) arg() string {
+	if p.next() != "?" {
+		panic("placeholder expected")
+	}
+	arg := p.args[0].(string)
+	p.args = p.args[1:]
+	return arg
+}
+
+func (p *sqlFilterInterpreter) or() bool {
+	result := p.and()
+	for p.peek("OR") {
+		p.next()
+		// Evaluate both sides to consume their tokens and arguments.
+		right := p.and()
+		result = result || right
+	}
+	return result
+}
+
+func (p *sqlFilterInterpreter) and() bool {
+	result := p.factor()
+	for p.peek("AND") {
+		p.next()
+		right := p.factor()
+		result = result && right
+	}
+	return result
+}
+
+func (p *sqlFilterInterpreter) factor() bool {
+	switch token := p.next(); token {
+	case "NOT":
+		return !p.factor()
+	case "(":
+		result := p.or()
+		if p.next() != ")" {
+			panic("closing parenthesis expected")
+		}
+		return result
+	case "1":
+		p.next()
+		return p.next() == "1"
+	case "resource":
+		switch operator := p.next(); operator {
+		case "=":
+			return p.resource == p.arg()
+		case "<>":
+			return p.resource != p.arg()
+		case "~":
+			return regexp.MustCompile(p.arg()).MatchString(p.resource)
+		case "LIKE":
+			pattern := p.arg()
+			p.next() // ESCAPE
+			p.next() // '!'
+			var re strings.Builder
+			for i := 0; i < len(pattern); i++ {
+				switch c := pattern[i]; c {
+				case '!':
+					i++
+					re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+				case '%':
+					re.WriteString(".*")
+				case '_':
+					re.WriteString(".")
+				default:
+					re.WriteString(regexp.QuoteMeta(string(c)))
+				}
+			}
+			return regexp.MustCompile("^" + re.String() + "$").MatchString(p.resource)
+		case "IN":
+			p.next() // (
+			found := p.resource == p.arg()
+			for p.next() == "," {
+				found = p.arg() == p.resource || found
+			}
+			return found
+		}
+	}
+	panic("unexpected SQL token at " + strconv.Itoa(p.pos))
+}
@@ -1,5 +1,10 @@
 package authorization
 
+import (
+	"context"
+	"time"
+)
+
 // PrincipalResolver handles the expansion of a user principal to include
 // associated roles and group memberships.
 type PrincipalResolver interface {
@@ -16,58 +21,118 @@ type RoleMapping struct {
 
 // ExpandingEvaluator wraps the base evaluator to handle principal expansion
 type ExpandingEvaluator struct {
-	baseEvaluator Evaluator
-	resolver      PrincipalResolver
+	baseEvaluator  Evaluator
+	resolver       PrincipalResolver
+	decisionLogger DecisionLogger
+	tracer         Tracer
+}
+
+// ExpandingEvaluatorOption configures an evaluator created by NewExpandingEvaluator
+type ExpandingEvaluatorOption interface {
+	applyExpandingEvaluator(e *ExpandingEvaluator)
 }
 
 // NewExpandingEvaluator creates a new evaluator that handles principal expansion
-func NewExpandingEvaluator(baseEvaluator Evaluator, resolver PrincipalResolver) *ExpandingEvaluator {
-	return &ExpandingEvaluator{
+func NewExpandingEvaluator(baseEvaluator Evaluator, resolver PrincipalResolver, opts ...ExpandingEvaluatorOption) *ExpandingEvaluator {
+	e := &ExpandingEvaluator{
 		baseEvaluator: baseEvaluator,
 		resolver:      resolver,
 	}
+	for _, opt := range opts {
+		opt.applyExpandingEvaluator(e)
+	}
+	return e
 }
 
 // Evaluate evaluates a request by expanding the principal and checking all associated principals
 func (e *ExpandingEvaluator) Evaluate(req Request) (Response, error) {
+	return e.evaluateContext(context.Background(), req)
+}
+
+func (e *ExpandingEvaluator) evaluateContext(ctx context.Context, req Request) (Response, error) {
+	ctx, span := startSpan(ctx, e.tracer, SpanExpandingEvaluate)
+	defer span.End()
+	setRequestAttributes(span, req)
+
+	start := time.Now()
+	resp, principals, statementID := e.evaluate(ctx, req)
+	setResponseAttributes(span, resp, nil)
+	if e.decisionLogger == nil {
+		return resp, nil
+	}
+
+	resp.DecisionID = newDecisionID()
+	e.decisionLogger.LogDecision(Decision{
+		ID:          resp.DecisionID,
+		Source:      DecisionSourceExpandingEvaluator,
+		Time:        start,
+		Request:     req,
+		Response:    resp,
+		StatementID: statementID,
+		Principals:  principals,
+		Latency:     time.Since(start),
+	})
+	return resp, nil
+}
+
+// evaluate decides the request and returns the expanded principals and the
+// decider reported by the base evaluator for the deciding principal.
+func (e *ExpandingEvaluator) evaluate(ctx context.Context, req Request) (Response, []Principal, string) {
 	// Resolve all principals for the request
-	principals, err := e.resolver.ResolvePrincipals(req.Principal)
+	principals, err := e.resolvePrincipals(ctx, req.Principal)
 	if err != nil {
 		return Response{
 			Effect:  EffectDeny,
 			Message: "failed to resolve principals: " + err.Error(),
-		}, nil
+		}, nil, ""
 	}
 
-	// Keep track of all responses for audit purposes
-	var responses []Response
-	var allowingPrincipal *Principal
-	var denyingPrincipal *Principal
-
-	// Evaluate for each principal
+	responses := make([]Response, 0, len(principals))
 	for _, principal := range principals {
 		// Create a new request with the expanded principal
 		expandedReq := req
 		expandedReq.Principal = principal
 
-		response, err := e.baseEvaluator.Evaluate(expandedReq)
+		response, err := evaluateWithContext(ctx, e.baseEvaluator, expandedReq)
 		if err != nil {
-			return Response{
-				Effect:  EffectDeny,
-				Message: "evaluation error for principal " + string(principal) + ": " + err.Error(),
-			}, nil
+			return principalEvaluationFailed(principal, err), principals, ""
 		}
-
 		responses = append(responses, response)
+	}
+	resp, decider := combineExpandedResponses(principals, responses)
+	return resp, principals, decider
+}
+
+// principalEvaluationFailed is the response when evaluating for one of the
+// expanded principals fails.
+func principalEvaluationFailed(principal Principal, err error) Response {
+	return Response{
+		Effect:  EffectDeny,
+		Message: "evaluation error for principal " + string(principal) + ": " + err.Error(),
+	}
+}
+
+// combineExpandedResponses combines the responses of the expanded principals
+// into the decision and returns it with the decider reported by the base
+// evaluator for the deciding principal.
+func combineExpandedResponses(principals []Principal, responses []Response) (Response, string) {
+	var allowingPrincipal *Principal
+	var denyingPrincipal *Principal
+	var allowingDecider, denyingDecider string
+
+	for i, response := range responses {
+		principal := principals[i]
 
 		// Track first explicit deny (highest precedence)
 		if response.Effect == EffectDeny && denyingPrincipal == nil && response.Decider != nil {
 			denyingPrincipal = &principal
+			denyingDecider = *response.Decider
 		}
 
 		// Track first explicit allow
 		if response.Effect == EffectAllow && allowingPrincipal == nil && response.Decider != nil {
 			allowingPrincipal = &principal
+			allowingDecider = *response.Decider
 		}
 	}
 
@@ -77,7 +142,7 @@ func (e *ExpandingEvaluator) Evaluate(req Request) (Response, error) {
 			Effect:  EffectDeny,
 			Message: "access denied for principal " + string(*denyingPrincipal),
 			Decider: stringPtr("principal_expansion:" + string(*denyingPrincipal)),
-		}, nil
+		}, denyingDecider
 	}
 
 	if allowingPrincipal != nil {
@@ -85,14 +150,27 @@ func (e *ExpandingEvaluator) Evaluate(req Request) (Response, error) {
 			Effect:  EffectAllow,
 			Message: "access allowed for principal " + string(*allowingPrincipal),
 			Decider: stringPtr("principal_expansion:" + string(*allowingPrincipal)),
-		}, nil
+		}, allowingDecider
 	}
 
 	// Default deny if no explicit decisions found
 	return Response{
 		Effect:  EffectDeny,
 		Message: "no matching statements found for any expanded principal, access denied by default",
-	}, nil
+	}, ""
+}
+
+func (e *ExpandingEvaluator) resolvePrincipals(ctx context.Context, principal Principal) ([]Principal, error) {
+	_, span := startSpan(ctx, e.tracer, SpanResolvePrincipals)
+	defer span.End()
+	span.SetAttribute("authz.principal", string(principal))
+
+	principals, err := e.resolver.ResolvePrincipals(principal)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.SetAttribute("authz.principal_count", len(principals))
+	return principals, err
 }
 
 // Helper function to create string pointer
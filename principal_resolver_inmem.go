@@ -1,6 +1,9 @@
 package authorization
 
-import "strings"
+import (
+	"slices"
+	"strings"
+)
 
 // inMemoryPrincipalResolver is an in-memory implementation of PrincipalResolver
 // In a real system, this would likely query a user management system or directory service
@@ -34,3 +37,16 @@ func (r *inMemoryPrincipalResolver) ResolvePrincipals(principal Principal) ([]Pr
 
 	return principals, nil
 }
+
+// ResolveMembers returns the users mapped to a role, in order.
+func (r *inMemoryPrincipalResolver) ResolveMembers(principal Principal) ([]Principal, error) {
+	var members []Principal
+	for user, roles := range r.roleMappings {
+		// Only users are expanded by ResolvePrincipals.
+		if strings.HasPrefix(string(user), "users/") && slices.Contains(roles, principal) {
+			members = append(members, user)
+		}
+	}
+	slices.Sort(members)
+	return members, nil
+}
@@ -3,8 +3,11 @@ package authorization
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"net/http"
 	"time"
 )
@@ -14,81 +17,288 @@ type RemoteAuthorizer interface {
 }
 
 type remoteAuthorizer struct {
-	client       http.Client
-	endpoint   string
-	bearerTokenFn func() (string, error)
+	client         *http.Client
+	endpoint       string
+	bearerTokenFn  func() (string, error)
+	decisionLogger DecisionLogger
+	tracer         Tracer
+	retry          RetryPolicy
+	breaker        *circuitBreaker
+	random         func() float64
+	sleep          func(ctx context.Context, d time.Duration) error
+	transport      remoteTransport
+	headers        http.Header
+	requestTimeout time.Duration
+	tokenSource    TokenSource
+	signer         *hmacSigner
+	responseKeys   map[string]ed25519.PublicKey
+	protocol       remoteProtocol
 }
 
-func NewBetandbeatRemoteAuthorizer(endpoint string, bearerTokenFn func() (string, error)) RemoteAuthorizer {
-	client := http.Client{
-		Timeout: 10 * time.Second, // Set a reasonable timeout for remote requests
-	}
-	return &remoteAuthorizer{
-		client:       client,
+// remoteProtocol encodes the requests and decodes the responses of a remote
+// authorization service.
+type remoteProtocol interface {
+	encodeRequest(req Request) ([]byte, error)
+	decodeResponse(body io.Reader) (Response, error)
+}
+
+// betandbeatProtocol posts a Request and receives a Response as JSON.
+type betandbeatProtocol struct{}
+
+func (betandbeatProtocol) encodeRequest(req Request) ([]byte, error) {
+	return json.Marshal(req)
+}
+
+func (betandbeatProtocol) decodeResponse(body io.Reader) (Response, error) {
+	var response Response
+	err := json.NewDecoder(body).Decode(&response)
+	return response, err
+}
+
+// RemoteAuthorizerOption configures an authorizer created by
+// NewBetandbeatRemoteAuthorizer or NewAuthZENAuthorizer.
+type RemoteAuthorizerOption interface {
+	applyRemoteAuthorizer(r *remoteAuthorizer)
+}
+
+type remoteAuthorizerOptionFunc func(r *remoteAuthorizer)
+
+func (f remoteAuthorizerOptionFunc) applyRemoteAuthorizer(r *remoteAuthorizer) {
+	f(r)
+}
+
+// NewBetandbeatRemoteAuthorizer creates a RemoteAuthorizer posting requests to
+// endpoint. Without options it uses an HTTP client with a 10 second timeout.
+func NewBetandbeatRemoteAuthorizer(endpoint string, bearerTokenFn func() (string, error), opts ...RemoteAuthorizerOption) RemoteAuthorizer {
+	return newRemoteAuthorizer(endpoint, bearerTokenFn, betandbeatProtocol{}, opts)
+}
+
+func newRemoteAuthorizer(endpoint string, bearerTokenFn func() (string, error), protocol remoteProtocol, opts []RemoteAuthorizerOption) *remoteAuthorizer {
+	r := &remoteAuthorizer{
 		endpoint:      endpoint,
 		bearerTokenFn: bearerTokenFn,
+		protocol:      protocol,
+		random:        rand.Float64,
+		sleep:         sleepContext,
+		headers:       make(http.Header),
+	}
+	for _, opt := range opts {
+		opt.applyRemoteAuthorizer(r)
 	}
+	r.client = r.transport.client()
+	r.endpoint = joinBasePath(r.endpoint, r.transport.basePath)
+	return r
 }
 
 func (r *remoteAuthorizer) Authorize(ctx context.Context, req Request) (Response, error) {
-	token, err := r.bearerTokenFn()
-	if err != nil {
-		return Response{}, err
+	ctx, span := startSpan(ctx, r.tracer, SpanRemoteAuthorize)
+	defer span.End()
+	setRequestAttributes(span, req)
+
+	start := time.Now()
+	resp, err := r.authorize(withTraceParent(ctx, span.TraceParent()), req)
+	setResponseAttributes(span, resp, err)
+	if r.decisionLogger == nil {
+		return resp, err
+	}
+
+	// Keep the decision ID assigned by the server so both logs correlate.
+	if resp.DecisionID == "" {
+		resp.DecisionID = newDecisionID()
+	}
+	decision := Decision{
+		ID:       resp.DecisionID,
+		Source:   DecisionSourceRemote,
+		Time:     start,
+		Request:  req,
+		Response: resp,
+		Latency:  time.Since(start),
+		Err:      err,
+	}
+	if resp.Decider != nil {
+		decision.StatementID = *resp.Decider
+	}
+	r.decisionLogger.LogDecision(decision)
+	return resp, err
+}
+
+func (r *remoteAuthorizer) authorize(ctx context.Context, req Request) (Response, error) {
+	var token string
+	var err error
+	if r.signer == nil {
+		if token, err = r.token(ctx); err != nil {
+			return Response{}, err
+		}
 	}
 
 	// Prepare the request body
-	body, err := json.Marshal(req)
+	body, err := r.protocol.encodeRequest(req)
 	if err != nil {
 		return Response{
-			Effect: EffectDeny,
+			Effect:  EffectDeny,
 			Message: "failed to marshal authorization request: " + err.Error(),
 		}, err
 	}
-	bodyRead := bytes.NewReader(body)
+
+	refreshed := false
+	for attempt := 1; ; attempt++ {
+		if r.breaker != nil && !r.breaker.allow() {
+			return Response{
+				Effect:  EffectDeny,
+				Message: "authorization service unavailable, circuit breaker is open",
+			}, fmt.Errorf("%w: %w", ErrUpstreamUnavailable, ErrCircuitOpen)
+		}
+		response, outcome, err := r.attempt(ctx, token, body)
+		if r.breaker != nil {
+			if ctx.Err() != nil || outcome.health == healthUnknown {
+				// A cancelled caller or a client error says nothing about
+				// the service's health.
+				r.breaker.abandon()
+			} else {
+				r.breaker.record(outcome.health == healthDown)
+			}
+		}
+		if outcome.status == http.StatusUnauthorized && !refreshed {
+			// The token may have been revoked or expired early; retry once
+			// with a fresh one, without counting it as a retry.
+			if invalidator, ok := r.tokenSource.(tokenInvalidator); ok {
+				refreshed = true
+				invalidator.Invalidate(token)
+				if token, err = r.token(ctx); err != nil {
+					return Response{}, err
+				}
+				attempt--
+				continue
+			}
+		}
+		if !outcome.retryable || attempt >= r.retry.MaxAttempts {
+			return response, err
+		}
+		if outcome.retryAfter > r.retry.maxRetryAfter() {
+			return response, err
+		}
+		delay := max(r.retry.backoff(attempt, r.random), outcome.retryAfter)
+		if r.sleep(ctx, delay) != nil {
+			return response, err
+		}
+	}
+}
+
+// token returns the bearer token from the token source, if any, or from
+// bearerTokenFn.
+func (r *remoteAuthorizer) token(ctx context.Context) (string, error) {
+	if r.tokenSource == nil {
+		return r.bearerTokenFn()
+	}
+	token, err := r.tokenSource.Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get bearer token: %w", err)
+	}
+	return token.AccessToken, nil
+}
+
+// serviceHealth is what an attempt tells about the authorization service,
+// for the circuit breaker.
+type serviceHealth int
+
+const (
+	healthUnknown serviceHealth = iota
+	healthUp
+	// healthDown is a transport or server failure.
+	healthDown
+)
+
+// attemptOutcome tells whether a failed attempt may be retried.
+type attemptOutcome struct {
+	// status is the HTTP status of the response, zero if there was none.
+	status    int
+	retryable bool
+	health    serviceHealth
+	// retryAfter is the delay requested by the server with Retry-After.
+	retryAfter time.Duration
+}
+
+// attempt makes a single authorization request.
+func (r *remoteAuthorizer) attempt(ctx context.Context, token string, body []byte) (Response, attemptOutcome, error) {
+	callerCtx := ctx
+	if r.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.requestTimeout)
+		defer cancel()
+	}
 
 	// Prepare the HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bodyRead)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
 	if err != nil {
 		return Response{
-			Effect: EffectDeny,
+			Effect:  EffectDeny,
 			Message: "failed to create authorization request: " + err.Error(),
-		}, err
+		}, attemptOutcome{}, err
 	}
 
-	httpReq.Header.Set("Authorization", "Bearer "+token)
+	for key, values := range r.headers {
+		httpReq.Header[key] = values
+	}
+	if r.signer != nil {
+		r.signer.sign(httpReq, body, time.Now())
+	} else {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	if traceParent := traceParentFromContext(ctx); traceParent != "" {
+		httpReq.Header.Set("traceparent", traceParent)
+	}
+	var nonce string
+	if r.responseKeys != nil {
+		nonce = randomHex(16)
+		httpReq.Header.Set(responseNonceHeader, nonce)
+	}
 
 	resp, err := r.client.Do(httpReq)
 	if err != nil {
+		if callerCtx.Err() == nil {
+			err = fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+		}
 		return Response{
-			Effect: EffectDeny,
+			Effect:  EffectDeny,
 			Message: "failed to make authorization request: " + err.Error(),
-		}, err
+		}, attemptOutcome{retryable: callerCtx.Err() == nil, health: healthDown}, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		var body json.RawMessage
-		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
-			return Response{
-				Effect: EffectDeny,
-				Message: "failed to decode error response: " + err.Error(),
-			}, fmt.Errorf("authorization failed: %s", resp.Status)
-		} else {
-			fmt.Println("Error response body:", string(body))
+		outcome := attemptOutcome{
+			status:     resp.StatusCode,
+			retryable:  retryableStatus(resp.StatusCode),
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			outcome.health = healthDown
+		}
+		return Response{
+			Effect:  EffectDeny,
+			Message: fmt.Sprintf("authorization failed with status %s", resp.Status),
+		}, outcome, newRemoteError(resp)
+	}
+
+	if r.responseKeys != nil {
+		// Trust the signed decision only, never the unsigned body.
+		response, err := verifyResponse(resp.Header.Get(responseSignatureHeader), r.responseKeys, body, nonce)
+		if err != nil {
 			return Response{
-				Effect: EffectDeny,
-				Message: fmt.Sprintf("authorization failed with status %s", resp.Status),
-			}, fmt.Errorf("authorization failed with status %s", resp.Status)
+				Effect:  EffectDeny,
+				Message: err.Error(),
+			}, attemptOutcome{}, err
 		}
+		return response, attemptOutcome{health: healthUp}, nil
 	}
 
-	var response Response
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	response, err := r.protocol.decodeResponse(resp.Body)
+	if err != nil {
 		return Response{
-			Effect: EffectDeny,
+			Effect:  EffectDeny,
 			Message: "failed to decode authorization response: " + err.Error(),
-		}, err
+		}, attemptOutcome{health: healthDown}, err
 	}
 
-	return response, nil
-}
\ No newline at end of file
+	return response, attemptOutcome{health: healthUp}, nil
+}
@@ -0,0 +1,101 @@
+package authorization
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Errors returned by remote authorizers, wrapped in a *RemoteError when the
+// service responded. Use errors.Is to check for them.
+var (
+	// ErrUnauthorized means the service rejected the credentials (401, 403).
+	ErrUnauthorized = errors.New("unauthorized by authorization service")
+	// ErrRateLimited means the service throttled the client (429).
+	ErrRateLimited = errors.New("rate limited by authorization service")
+	// ErrUpstreamUnavailable means the service could not be reached or
+	// failed (5xx, connection errors, open circuit breaker).
+	ErrUpstreamUnavailable = errors.New("authorization service unavailable")
+	// ErrInvalidRequest means the service rejected the request (other 4xx).
+	ErrInvalidRequest = errors.New("invalid authorization request")
+)
+
+// maxErrorBodyBytes bounds how much of an error response is read.
+const maxErrorBodyBytes = 64 << 10
+
+// ProblemDetails is an RFC 9457 problem details body.
+type ProblemDetails struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// RemoteError is returned when the authorization service responds with an
+// error status. It matches one of ErrUnauthorized, ErrRateLimited,
+// ErrUpstreamUnavailable and ErrInvalidRequest with errors.Is.
+type RemoteError struct {
+	StatusCode int
+	// RequestID is the X-Request-Id of the response, if any, for correlating
+	// with the service's logs.
+	RequestID string
+	// Problem is the parsed problem details body, nil if the body was not
+	// problem details.
+	Problem *ProblemDetails
+	// Body is the start of the raw body if it was not problem details.
+	Body string
+}
+
+func (e *RemoteError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: status %d", e.kind(), e.StatusCode)
+	if e.Problem != nil {
+		for _, s := range []string{e.Problem.Title, e.Problem.Detail} {
+			if s != "" {
+				b.WriteString(": " + s)
+			}
+		}
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, " (request ID %s)", e.RequestID)
+	}
+	return b.String()
+}
+
+func (e *RemoteError) Is(target error) bool {
+	return target == e.kind()
+}
+
+func (e *RemoteError) kind() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode >= 500:
+		return ErrUpstreamUnavailable
+	default:
+		return ErrInvalidRequest
+	}
+}
+
+// newRemoteError reads an error response into a *RemoteError. Bodies that
+// are not JSON are kept as text.
+func newRemoteError(resp *http.Response) *RemoteError {
+	remoteErr := &RemoteError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("X-Request-Id"),
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	var problem ProblemDetails
+	if err := json.Unmarshal(body, &problem); err == nil && (problem.Title != "" || problem.Detail != "" || problem.Type != "") {
+		remoteErr.Problem = &problem
+	} else {
+		remoteErr.Body = strings.TrimSpace(string(body[:min(len(body), 1024)]))
+	}
+	return remoteErr
+}
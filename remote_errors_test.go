@@ -0,0 +1,112 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteAuthorizer_TypedErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{status: http.StatusBadRequest, want: ErrInvalidRequest},
+		{status: http.StatusUnprocessableEntity, want: ErrInvalidRequest},
+		{status: http.StatusUnauthorized, want: ErrUnauthorized},
+		{status: http.StatusForbidden, want: ErrUnauthorized},
+		{status: http.StatusTooManyRequests, want: ErrRateLimited},
+		{status: http.StatusInternalServerError, want: ErrUpstreamUnavailable},
+		{status: http.StatusServiceUnavailable, want: ErrUpstreamUnavailable},
+	}
+	all := []error{ErrInvalidRequest, ErrUnauthorized, ErrRateLimited, ErrUpstreamUnavailable}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/problem+json")
+				w.Header().Set("X-Request-Id", "req-123")
+				w.WriteHeader(tt.status)
+				fmt.Fprintf(w, `{"type":"https://errors.example.com/x","title":"Something failed","status":%d,"detail":"principal is required"}`, tt.status)
+			}))
+			defer server.Close()
+
+			authorizer := NewBetandbeatRemoteAuthorizer(server.URL, func() (string, error) { return "token", nil })
+			resp, err := authorizer.Authorize(t.Context(), Request{})
+			require.Error(t, err)
+			assert.Equal(t, EffectDeny, resp.Effect)
+			for _, target := range all {
+				assert.Equal(t, target == tt.want, errors.Is(err, target), "errors.Is(%v)", target)
+			}
+
+			var remoteErr *RemoteError
+			require.ErrorAs(t, err, &remoteErr)
+			assert.Equal(t, tt.status, remoteErr.StatusCode)
+			assert.Equal(t, "req-123", remoteErr.RequestID)
+			require.NotNil(t, remoteErr.Problem)
+			assert.Equal(t, "Something failed", remoteErr.Problem.Title)
+			assert.Equal(t, "principal is required", remoteErr.Problem.Detail)
+			assert.Contains(t, err.Error(), "principal is required (request ID req-123)")
+		})
+	}
+}
+
+func TestRemoteAuthorizer_NonJSONErrorBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream connect error or disconnect/reset before headers", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	authorizer := NewBetandbeatRemoteAuthorizer(server.URL, func() (string, error) { return "token", nil })
+	_, err := authorizer.Authorize(t.Context(), Request{})
+	assert.ErrorIs(t, err, ErrUpstreamUnavailable)
+	var remoteErr *RemoteError
+	require.ErrorAs(t, err, &remoteErr)
+	assert.Nil(t, remoteErr.Problem)
+	assert.Equal(t, "upstream connect error or disconnect/reset before headers", remoteErr.Body)
+}
+
+func TestRemoteAuthorizer_ConnectionErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	endpoint := server.URL
+	server.Close()
+
+	authorizer := NewBetandbeatRemoteAuthorizer(endpoint, func() (string, error) { return "token", nil })
+	_, err := authorizer.Authorize(t.Context(), Request{})
+	assert.ErrorIs(t, err, ErrUpstreamUnavailable)
+	assert.Equal(t, "unavailable", errorClass(err))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_, err = authorizer.Authorize(ctx, Request{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, ErrUpstreamUnavailable, "a cancelled caller is not an outage")
+}
+
+func TestRemoteAuthorizer_CircuitOpenIsUnavailable(t *testing.T) {
+	server, _ := flakyServer(t, http.StatusServiceUnavailable)
+	authorizer, _ := newTestRemoteAuthorizer(server.URL, WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1}))
+
+	_, err := authorizer.Authorize(t.Context(), Request{})
+	require.Error(t, err)
+	_, err = authorizer.Authorize(t.Context(), Request{})
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.ErrorIs(t, err, ErrUpstreamUnavailable)
+}
+
+func TestHybridAuthorizer_DoesNotDegradeRejections(t *testing.T) {
+	for _, remoteErr := range []error{ErrInvalidResponseSignature, &RemoteError{StatusCode: http.StatusBadRequest}, &RemoteError{StatusCode: http.StatusForbidden}} {
+		remote := remoteAuthorizerFunc(func(ctx context.Context, req Request) (Response, error) {
+			return Response{Effect: EffectDeny}, remoteErr
+		})
+		resp, err := NewHybridAuthorizer(remote, nil, HybridAuthorizerConfig{DefaultPolicy: DegradeFailOpen}).Authorize(t.Context(), Request{})
+		assert.ErrorIs(t, err, remoteErr)
+		assert.Equal(t, EffectDeny, resp.Effect)
+		assert.Nil(t, resp.Degraded)
+	}
+}
@@ -0,0 +1,197 @@
+package authorization
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const defaultRemoteTimeout = 10 * time.Second
+
+// remoteTransport collects the HTTP options of a remote authorizer until the
+// client is built.
+type remoteTransport struct {
+	httpClient   *http.Client
+	roundTripper http.RoundTripper
+	timeout      time.Duration
+	tlsConfig    *tls.Config
+	// clientCertificates and rootCAs are applied on top of tlsConfig.
+	clientCertificates []tls.Certificate
+	rootCAs            *x509.CertPool
+	proxy              func(*http.Request) (*url.URL, error)
+	basePath           string
+}
+
+// WithHTTPClient sends requests with a copy of client. Other transport
+// options are applied on top of it.
+func WithHTTPClient(client *http.Client) RemoteAuthorizerOption {
+	return remoteAuthorizerOptionFunc(func(r *remoteAuthorizer) {
+		r.transport.httpClient = client
+	})
+}
+
+// WithTransport sends requests through rt, e.g. a mesh sidecar's transport or
+// a fake in tests. WithTLSConfig, WithClientCertificate, WithRootCAs and
+// WithProxy only apply if rt is an *http.Transport.
+func WithTransport(rt http.RoundTripper) RemoteAuthorizerOption {
+	return remoteAuthorizerOptionFunc(func(r *remoteAuthorizer) {
+		r.transport.roundTripper = rt
+	})
+}
+
+// WithTimeout sets the overall timeout of the HTTP client, including retries
+// made by the client itself. Defaults to 10s.
+func WithTimeout(timeout time.Duration) RemoteAuthorizerOption {
+	return remoteAuthorizerOptionFunc(func(r *remoteAuthorizer) {
+		r.transport.timeout = timeout
+	})
+}
+
+// WithRequestTimeout bounds every single attempt, so a slow attempt can be
+// retried within the overall timeout.
+func WithRequestTimeout(timeout time.Duration) RemoteAuthorizerOption {
+	return remoteAuthorizerOptionFunc(func(r *remoteAuthorizer) {
+		r.requestTimeout = timeout
+	})
+}
+
+// WithTLSConfig uses a copy of config for TLS connections. WithClientCertificate
+// and WithRootCAs are applied on top of it, whatever the order of the options.
+func WithTLSConfig(config *tls.Config) RemoteAuthorizerOption {
+	return remoteAuthorizerOptionFunc(func(r *remoteAuthorizer) {
+		r.transport.tlsConfig = config.Clone()
+	})
+}
+
+// WithClientCertificate presents cert to the server for mutual TLS.
+func WithClientCertificate(cert tls.Certificate) RemoteAuthorizerOption {
+	return remoteAuthorizerOptionFunc(func(r *remoteAuthorizer) {
+		r.transport.clientCertificates = append(r.transport.clientCertificates, cert)
+	})
+}
+
+// WithRootCAs verifies the server's certificate against pool instead of the
+// system roots.
+func WithRootCAs(pool *x509.CertPool) RemoteAuthorizerOption {
+	return remoteAuthorizerOptionFunc(func(r *remoteAuthorizer) {
+		r.transport.rootCAs = pool
+	})
+}
+
+// WithProxy routes requests through the proxy returned by proxy, see
+// http.Transport.Proxy.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) RemoteAuthorizerOption {
+	return remoteAuthorizerOptionFunc(func(r *remoteAuthorizer) {
+		r.transport.proxy = proxy
+	})
+}
+
+// WithTokenSource takes bearer tokens from source instead of the bearerTokenFn
+// passed to NewBetandbeatRemoteAuthorizer, which may then be nil. If source
+// caches tokens, like NewCachingTokenSource and
+// NewClientCredentialsTokenSource, a request rejected with 401 is retried
+// once with a freshly fetched token.
+func WithTokenSource(source TokenSource) RemoteAuthorizerOption {
+	return remoteAuthorizerOptionFunc(func(r *remoteAuthorizer) {
+		r.tokenSource = source
+	})
+}
+
+// WithHeader adds a static header to every request. Authorization and
+// traceparent are always set by the authorizer.
+func WithHeader(key, value string) RemoteAuthorizerOption {
+	return remoteAuthorizerOptionFunc(func(r *remoteAuthorizer) {
+		r.headers.Add(key, value)
+	})
+}
+
+// WithUserAgent sets the User-Agent header of every request.
+func WithUserAgent(userAgent string) RemoteAuthorizerOption {
+	return remoteAuthorizerOptionFunc(func(r *remoteAuthorizer) {
+		r.headers.Set("User-Agent", userAgent)
+	})
+}
+
+// WithBasePath prefixes the endpoint's path with basePath, for services
+// mounted below a path by a gateway: with the endpoint
+// "https://gateway/v1/authorize" and the base path "/authz", requests go to
+// "https://gateway/authz/v1/authorize".
+func WithBasePath(basePath string) RemoteAuthorizerOption {
+	return remoteAuthorizerOptionFunc(func(r *remoteAuthorizer) {
+		r.transport.basePath = basePath
+	})
+}
+
+// tlsClientConfig merges the TLS options, nil if there are none.
+func (t *remoteTransport) tlsClientConfig() *tls.Config {
+	if t.tlsConfig == nil && len(t.clientCertificates) == 0 && t.rootCAs == nil {
+		return nil
+	}
+	config := &tls.Config{}
+	if t.tlsConfig != nil {
+		config = t.tlsConfig.Clone()
+	}
+	config.Certificates = append(config.Certificates, t.clientCertificates...)
+	if t.rootCAs != nil {
+		config.RootCAs = t.rootCAs
+	}
+	return config
+}
+
+// client builds the HTTP client from the collected options.
+func (t *remoteTransport) client() *http.Client {
+	client := &http.Client{Timeout: defaultRemoteTimeout}
+	if t.httpClient != nil {
+		copied := *t.httpClient
+		client = &copied
+	}
+	if t.timeout > 0 {
+		client.Timeout = t.timeout
+	}
+	if t.roundTripper != nil {
+		client.Transport = t.roundTripper
+	}
+	tlsConfig := t.tlsClientConfig()
+	if tlsConfig == nil && t.proxy == nil {
+		return client
+	}
+
+	var transport *http.Transport
+	switch rt := client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = rt.Clone()
+	default:
+		return client
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	if t.proxy != nil {
+		transport.Proxy = t.proxy
+	}
+	client.Transport = transport
+	return client
+}
+
+// joinBasePath inserts basePath in front of the path of endpoint.
+func joinBasePath(endpoint, basePath string) string {
+	if basePath == "" {
+		return endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		// Leave it to the request to report the invalid endpoint.
+		return endpoint
+	}
+	joined, err := url.JoinPath("/", basePath, u.Path)
+	if err != nil {
+		return endpoint
+	}
+	u.Path = joined
+	u.RawPath = ""
+	return u.String()
+}
@@ -0,0 +1,159 @@
+package authorization
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTripperFunc adapts a function to http.RoundTripper.
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRemoteAuthorizer_FakeTransport(t *testing.T) {
+	var received *http.Request
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		received = req
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"effect":"allow"}`)),
+			Header:     make(http.Header),
+		}, nil
+	})
+
+	authorizer := NewBetandbeatRemoteAuthorizer("https://gateway.internal/v1/authorize", func() (string, error) { return "token", nil },
+		WithTransport(transport),
+		WithBasePath("/authz"),
+		WithHeader("X-Tenant", "acme"),
+		WithHeader("Authorization", "ignored"),
+		WithUserAgent("billing-service/1.2"),
+	)
+	resp, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+	require.NoError(t, err)
+	assert.Equal(t, EffectAllow, resp.Effect)
+
+	require.NotNil(t, received)
+	assert.Equal(t, "https://gateway.internal/authz/v1/authorize", received.URL.String())
+	assert.Equal(t, "acme", received.Header.Get("X-Tenant"))
+	assert.Equal(t, "billing-service/1.2", received.Header.Get("User-Agent"))
+	assert.Equal(t, "Bearer token", received.Header.Get("Authorization"))
+}
+
+func TestRemoteAuthorizer_HTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"effect":"allow"}`))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Timeout: time.Minute}
+	authorizer := NewBetandbeatRemoteAuthorizer(server.URL, func() (string, error) { return "token", nil },
+		WithHTTPClient(client), WithTimeout(5*time.Second)).(*remoteAuthorizer)
+	assert.Equal(t, 5*time.Second, authorizer.client.Timeout)
+	assert.Equal(t, time.Minute, client.Timeout, "the caller's client is not modified")
+
+	resp, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+	require.NoError(t, err)
+	assert.Equal(t, EffectAllow, resp.Effect)
+
+	defaults := NewBetandbeatRemoteAuthorizer(server.URL, nil).(*remoteAuthorizer)
+	assert.Equal(t, 10*time.Second, defaults.client.Timeout)
+}
+
+func TestRemoteAuthorizer_RequestTimeout(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			<-release
+			return
+		}
+		w.Write([]byte(`{"effect":"allow"}`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	authorizer, _ := newTestRemoteAuthorizer(server.URL,
+		WithRequestTimeout(50*time.Millisecond),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2}),
+	)
+	resp, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+	require.NoError(t, err, "the slow attempt times out and is retried")
+	assert.Equal(t, EffectAllow, resp.Effect)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestRemoteAuthorizer_MutualTLS(t *testing.T) {
+	clientCert := newTestClientCertificate(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert.Leaf)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"effect":"allow"}`))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+
+	authorizer := NewBetandbeatRemoteAuthorizer(server.URL, func() (string, error) { return "token", nil },
+		WithRootCAs(rootCAs), WithClientCertificate(clientCert))
+	resp, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+	require.NoError(t, err)
+	assert.Equal(t, EffectAllow, resp.Effect)
+
+	withoutCert := NewBetandbeatRemoteAuthorizer(server.URL, func() (string, error) { return "token", nil }, WithRootCAs(rootCAs))
+	_, err = withoutCert.Authorize(t.Context(), Request{Principal: "users/mark"})
+	assert.Error(t, err)
+
+	// A TLS config given later keeps the certificate and roots.
+	withTLSConfig := NewBetandbeatRemoteAuthorizer(server.URL, func() (string, error) { return "token", nil },
+		WithRootCAs(rootCAs), WithClientCertificate(clientCert), WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}))
+	resp, err = withTLSConfig.Authorize(t.Context(), Request{Principal: "users/mark"})
+	require.NoError(t, err)
+	assert.Equal(t, EffectAllow, resp.Effect)
+}
+
+func newTestClientCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "billing-service"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestJoinBasePath(t *testing.T) {
+	assert.Equal(t, "https://gw/authz/v1/authorize", joinBasePath("https://gw/v1/authorize", "authz/"))
+	assert.Equal(t, "https://gw/authz", joinBasePath("https://gw", "/authz"))
+	assert.Equal(t, "https://gw/v1", joinBasePath("https://gw/v1", ""))
+}
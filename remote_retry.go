@@ -0,0 +1,205 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned, along with ErrUpstreamUnavailable, by a remote
+// authorizer whose circuit breaker is open after sustained failures of the
+// authorization service.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+const (
+	defaultInitialBackoff   = 100 * time.Millisecond
+	defaultMaxBackoff       = 2 * time.Second
+	defaultMaxRetryAfter    = 10 * time.Second
+	defaultFailureThreshold = 5
+	defaultOpenDuration     = 30 * time.Second
+)
+
+// RetryPolicy configures how a remote authorizer retries failed requests.
+// Connection errors and 429, 500, 502, 503 and 504 responses are retried;
+// authorization requests have no side effects, so retrying them is safe.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first. One
+	// or less disables retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, doubled for every
+	// further retry and jittered. Defaults to 100ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts. Defaults to 2s.
+	MaxBackoff time.Duration
+	// MaxRetryAfter is the longest Retry-After delay honoured; if the server
+	// asks for more, the request fails immediately. Defaults to 10s.
+	MaxRetryAfter time.Duration
+}
+
+// WithRetryPolicy retries failed requests according to policy.
+func WithRetryPolicy(policy RetryPolicy) RemoteAuthorizerOption {
+	return remoteAuthorizerOptionFunc(func(r *remoteAuthorizer) {
+		r.retry = policy
+	})
+}
+
+// backoff returns the jittered delay before the given retry, counting from
+// one: half of the exponential delay plus a random share of the other half.
+func (p RetryPolicy) backoff(retry int, random func() float64) time.Duration {
+	initial, limit := p.InitialBackoff, p.MaxBackoff
+	if initial <= 0 {
+		initial = defaultInitialBackoff
+	}
+	if limit <= 0 {
+		limit = defaultMaxBackoff
+	}
+	delay := initial
+	for i := 1; i < retry && delay < limit; i++ {
+		delay *= 2
+	}
+	delay = min(delay, limit)
+	return delay/2 + time.Duration(random()*float64(delay/2))
+}
+
+func (p RetryPolicy) maxRetryAfter() time.Duration {
+	if p.MaxRetryAfter <= 0 {
+		return defaultMaxRetryAfter
+	}
+	return p.MaxRetryAfter
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP
+// date, returning zero if it is absent or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CircuitBreakerConfig configures the circuit breaker of a remote authorizer.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed attempts that open
+	// the circuit. Defaults to 5.
+	FailureThreshold int
+	// OpenDuration is how long the circuit stays open before a single probe
+	// request is let through. Defaults to 30s.
+	OpenDuration time.Duration
+}
+
+// WithCircuitBreaker stops calling the authorization service after sustained
+// failures, returning ErrCircuitOpen until a probe request succeeds again.
+// Failures are counted per attempt: connection errors, timeouts, 5xx
+// responses and malformed responses count, while 4xx responses, including
+// 429, neither count nor reset the count.
+func WithCircuitBreaker(config CircuitBreakerConfig) RemoteAuthorizerOption {
+	return remoteAuthorizerOptionFunc(func(r *remoteAuthorizer) {
+		r.breaker = newCircuitBreaker(config)
+	})
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+type circuitBreaker struct {
+	mu        sync.Mutex
+	config    CircuitBreakerConfig
+	now       func() time.Time
+	state     circuitState
+	failures  int
+	openUntil time.Time
+	// probing is set while the single half-open probe is in flight.
+	probing bool
+}
+
+func newCircuitBreaker(config CircuitBreakerConfig) *circuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = defaultFailureThreshold
+	}
+	if config.OpenDuration <= 0 {
+		config.OpenDuration = defaultOpenDuration
+	}
+	return &circuitBreaker{config: config, now: time.Now}
+}
+
+// allow reports whether a request may be made.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if b.now().Before(b.openUntil) {
+			return false
+		}
+		b.state = circuitHalfOpen
+	case circuitHalfOpen:
+		if b.probing {
+			return false
+		}
+	default:
+		return true
+	}
+	b.probing = true
+	return true
+}
+
+// record reports the result of an allowed request.
+func (b *circuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if !failed {
+		b.state = circuitClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.config.FailureThreshold {
+		b.state = circuitOpen
+		b.openUntil = b.now().Add(b.config.OpenDuration)
+		b.failures = 0
+	}
+}
+
+// abandon releases an allowed request whose result says nothing about the
+// service, such as one cancelled by the caller.
+func (b *circuitBreaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
@@ -0,0 +1,225 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyServer answers with the given statuses in turn, then allows.
+func flakyServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(calls.Add(1))
+		if call <= len(statuses) {
+			if statuses[call-1] == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "3")
+			}
+			w.WriteHeader(statuses[call-1])
+			w.Write([]byte(`{"title":"unavailable"}`))
+			return
+		}
+		w.Write([]byte(`{"effect":"allow"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+// newTestRemoteAuthorizer returns an authorizer that records its backoff
+// delays instead of sleeping.
+func newTestRemoteAuthorizer(endpoint string, opts ...RemoteAuthorizerOption) (*remoteAuthorizer, *[]time.Duration) {
+	r := NewBetandbeatRemoteAuthorizer(endpoint, func() (string, error) { return "token", nil }, opts...).(*remoteAuthorizer)
+	var delays []time.Duration
+	r.random = func() float64 { return 1 }
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return ctx.Err()
+	}
+	return r, &delays
+}
+
+func TestRemoteAuthorizer_Retries(t *testing.T) {
+	server, calls := flakyServer(t, http.StatusServiceUnavailable, http.StatusBadGateway)
+	authorizer, delays := newTestRemoteAuthorizer(server.URL, WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+	}))
+
+	resp, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+	require.NoError(t, err)
+	assert.Equal(t, EffectAllow, resp.Effect)
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, *delays)
+}
+
+func TestRemoteAuthorizer_RetriesExhausted(t *testing.T) {
+	server, calls := flakyServer(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	authorizer, _ := newTestRemoteAuthorizer(server.URL, WithRetryPolicy(RetryPolicy{MaxAttempts: 2}))
+
+	resp, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+	require.Error(t, err)
+	assert.Equal(t, EffectDeny, resp.Effect)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestRemoteAuthorizer_NoRetryOnClientError(t *testing.T) {
+	server, calls := flakyServer(t, http.StatusBadRequest)
+	authorizer, delays := newTestRemoteAuthorizer(server.URL, WithRetryPolicy(RetryPolicy{MaxAttempts: 3}))
+
+	_, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+	require.Error(t, err)
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Empty(t, *delays)
+}
+
+func TestRemoteAuthorizer_RetryAfter(t *testing.T) {
+	server, calls := flakyServer(t, http.StatusTooManyRequests)
+	authorizer, delays := newTestRemoteAuthorizer(server.URL, WithRetryPolicy(RetryPolicy{MaxAttempts: 2}))
+
+	_, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, []time.Duration{3 * time.Second}, *delays)
+
+	server, calls = flakyServer(t, http.StatusTooManyRequests)
+	authorizer, delays = newTestRemoteAuthorizer(server.URL, WithRetryPolicy(RetryPolicy{MaxAttempts: 2, MaxRetryAfter: time.Second}))
+	_, err = authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+	require.Error(t, err, "a Retry-After beyond MaxRetryAfter fails immediately")
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Empty(t, *delays)
+}
+
+func TestRemoteAuthorizer_RetriesConnectionErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	endpoint := server.URL
+	server.Close()
+
+	authorizer, delays := newTestRemoteAuthorizer(endpoint, WithRetryPolicy(RetryPolicy{MaxAttempts: 3}))
+	_, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+	require.Error(t, err)
+	assert.Len(t, *delays, 2)
+}
+
+func TestRemoteAuthorizer_CircuitBreaker(t *testing.T) {
+	var healthy atomic.Bool
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.Write([]byte(`{"effect":"allow"}`))
+	}))
+	defer server.Close()
+
+	authorizer, _ := newTestRemoteAuthorizer(server.URL, WithCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold: 2,
+		OpenDuration:     time.Minute,
+	}))
+	now := time.Now()
+	authorizer.breaker.now = func() time.Time { return now }
+	req := Request{Principal: "users/mark"}
+
+	for range 2 {
+		_, err := authorizer.Authorize(t.Context(), req)
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrCircuitOpen)
+	}
+	resp, err := authorizer.Authorize(t.Context(), req)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, EffectDeny, resp.Effect)
+	assert.Equal(t, int32(2), calls.Load(), "an open circuit makes no requests")
+
+	// After OpenDuration a failing probe opens the circuit again.
+	now = now.Add(time.Minute)
+	_, err = authorizer.Authorize(t.Context(), req)
+	assert.NotErrorIs(t, err, ErrCircuitOpen)
+	_, err = authorizer.Authorize(t.Context(), req)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	// A successful probe closes it.
+	now = now.Add(time.Minute)
+	healthy.Store(true)
+	for range 2 {
+		resp, err = authorizer.Authorize(t.Context(), req)
+		require.NoError(t, err)
+		assert.Equal(t, EffectAllow, resp.Effect)
+	}
+	assert.Equal(t, int32(5), calls.Load())
+}
+
+func TestRemoteAuthorizer_CircuitBreakerOutcomes(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		opens  bool
+	}{
+		{name: "not implemented", status: http.StatusNotImplemented, body: `{}`, opens: true},
+		{name: "malformed response", status: http.StatusOK, body: `not json`, opens: true},
+		{name: "bad request", status: http.StatusBadRequest, body: `{}`},
+		{name: "rate limited", status: http.StatusTooManyRequests, body: `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+			authorizer, _ := newTestRemoteAuthorizer(server.URL, WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2}))
+
+			for range 2 {
+				_, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+				require.Error(t, err)
+			}
+			_, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+			assert.Equal(t, tt.opens, errors.Is(err, ErrCircuitOpen))
+		})
+	}
+
+	// Client errors between failures do not reset the count.
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusServiceUnavailable
+		if calls.Add(1) == 2 {
+			status = http.StatusBadRequest
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	authorizer, _ := newTestRemoteAuthorizer(server.URL, WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2}))
+	for range 3 {
+		authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+	}
+	_, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	zero := func() float64 { return 0 }
+	assert.Equal(t, 50*time.Millisecond, policy.backoff(1, zero))
+	assert.Equal(t, 100*time.Millisecond, policy.backoff(2, zero))
+	assert.Equal(t, 150*time.Millisecond, policy.backoff(3, zero), "capped at MaxBackoff")
+	assert.Equal(t, 300*time.Millisecond, policy.backoff(10, func() float64 { return 1 }))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 5*time.Second, parseRetryAfter("5", now))
+	assert.Equal(t, 90*time.Second, parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now))
+	assert.Zero(t, parseRetryAfter("", now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+}
@@ -4,6 +4,12 @@ type Response struct {
 	Effect  Effect  `json:"effect"`
 	Message string  `json:"message"`
 	Decider *string `json:"decider,omitempty"`
+	// DecisionID identifies the decision in the decision log, when logging is
+	// enabled.
+	DecisionID string `json:"decisionId,omitempty"`
+	// Degraded is set when the decision was made without the remote
+	// authorization service, see NewHybridAuthorizer.
+	Degraded *Degradation `json:"degraded,omitempty"`
 }
 
 func (r Response) Allowed() bool {
@@ -0,0 +1,234 @@
+package authorization
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// responseNonceHeader carries the client's nonce the signed response is
+	// bound to.
+	responseNonceHeader = "X-Authz-Nonce"
+	// responseSignatureHeader carries the compact JWS of a signed response.
+	responseSignatureHeader = "X-Authz-Response-Signature"
+	responseJWSType         = "authz-response+jws"
+	// defaultResponseSigningMaxBodyBytes limits the request bodies buffered
+	// by ResponseSigningMiddleware unless WithMaxRequestBodyBytes is given.
+	defaultResponseSigningMaxBodyBytes = 1 << 20
+)
+
+// ErrInvalidResponseSignature is returned by a remote authorizer verifying
+// responses when a response is unsigned or its signature does not verify.
+var ErrInvalidResponseSignature = errors.New("invalid authorization response signature")
+
+type jwsHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Type      string `json:"typ"`
+}
+
+// signedResponse is the JWS payload of a signed response. It binds the
+// decision to the request it answers and to the client's nonce, so it can
+// neither be altered nor replayed for another request.
+type signedResponse struct {
+	Response    Response `json:"response"`
+	RequestHash string   `json:"requestHash"`
+	Nonce       string   `json:"nonce"`
+	IssuedAt    int64    `json:"iat"`
+}
+
+// WithResponseVerification requires every response to be signed by
+// ResponseSigningMiddleware with one of keys, indexed by key ID. The decision
+// is taken from the verified signature, and responses without a valid
+// signature fail with ErrInvalidResponseSignature.
+func WithResponseVerification(keys map[string]ed25519.PublicKey) RemoteAuthorizerOption {
+	return remoteAuthorizerOptionFunc(func(r *remoteAuthorizer) {
+		r.responseKeys = keys
+	})
+}
+
+// ResponseSigningOption configures ResponseSigningMiddleware.
+type ResponseSigningOption interface {
+	applyResponseSigning(c *responseSigningConfig)
+}
+
+type responseSigningConfig struct {
+	maxBodyBytes int64
+}
+
+type responseSigningOptionFunc func(c *responseSigningConfig)
+
+func (f responseSigningOptionFunc) applyResponseSigning(c *responseSigningConfig) {
+	f(c)
+}
+
+// WithMaxRequestBodyBytes limits the size of the request bodies buffered for
+// hashing, 1 MiB by default. Larger requests are rejected with 413.
+func WithMaxRequestBodyBytes(n int64) ResponseSigningOption {
+	return responseSigningOptionFunc(func(c *responseSigningConfig) {
+		c.maxBodyBytes = n
+	})
+}
+
+// ResponseSigningMiddleware signs the Response written by the wrapped handler
+// with key as a JWS (EdDSA) in the X-Authz-Response-Signature header, binding
+// it to the SHA-256 of the request body and the client's X-Authz-Nonce.
+// Single AuthZEN evaluation results are signed as the Response they map to.
+// Responses other than 200 OK, and bodies without a single allow or deny
+// decision, are passed through unsigned.
+func ResponseSigningMiddleware(keyID string, key ed25519.PrivateKey, opts ...ResponseSigningOption) func(http.Handler) http.Handler {
+	config := responseSigningConfig{maxBodyBytes: defaultResponseSigningMaxBodyBytes}
+	for _, opt := range opts {
+		opt.applyResponseSigning(&config)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, config.maxBodyBytes))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, "failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			buffered := &bufferedResponseWriter{header: w.Header(), status: http.StatusOK}
+			next.ServeHTTP(buffered, r)
+
+			if buffered.status == http.StatusOK {
+				if resp, ok := decisionFromBody(buffered.body.Bytes()); ok {
+					signature, err := signResponse(keyID, key, resp, body, r.Header.Get(responseNonceHeader), time.Now())
+					if err == nil {
+						w.Header().Set(responseSignatureHeader, signature)
+					}
+				}
+			}
+			w.WriteHeader(buffered.status)
+			w.Write(buffered.body.Bytes())
+		})
+	}
+}
+
+// decisionFromBody returns the decision of a Response or of a single AuthZEN
+// evaluation result. Other bodies, such as AuthZEN batch results, carry no
+// single decision and are not signed.
+func decisionFromBody(body []byte) (Response, bool) {
+	var resp Response
+	if err := json.Unmarshal(body, &resp); err == nil && (resp.Effect == EffectAllow || resp.Effect == EffectDeny) {
+		return resp, true
+	}
+	var evaluation struct {
+		AuthZENEvaluationResponse
+		Decision *bool `json:"decision"`
+	}
+	if err := json.Unmarshal(body, &evaluation); err == nil && evaluation.Decision != nil {
+		evaluation.AuthZENEvaluationResponse.Decision = *evaluation.Decision
+		return evaluation.AuthZENEvaluationResponse.Response(), true
+	}
+	return Response{}, false
+}
+
+// bufferedResponseWriter holds back the body so it can be signed.
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func signResponse(keyID string, key ed25519.PrivateKey, resp Response, requestBody []byte, nonce string, now time.Time) (string, error) {
+	header, err := json.Marshal(jwsHeader{Algorithm: "EdDSA", KeyID: keyID, Type: responseJWSType})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(signedResponse{
+		Response:    resp,
+		RequestHash: requestHash(requestBody),
+		Nonce:       nonce,
+		IssuedAt:    now.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature := ed25519.Sign(key, []byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// verifyResponse verifies a compact JWS produced by signResponse for the
+// given request body and nonce and returns the signed Response.
+func verifyResponse(jws string, keys map[string]ed25519.PublicKey, requestBody []byte, nonce string) (Response, error) {
+	if jws == "" {
+		return Response{}, fmt.Errorf("%w: response is not signed", ErrInvalidResponseSignature)
+	}
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 {
+		return Response{}, fmt.Errorf("%w: malformed JWS", ErrInvalidResponseSignature)
+	}
+	var header jwsHeader
+	if err := decodeJWSPart(parts[0], &header); err != nil {
+		return Response{}, err
+	}
+	if header.Algorithm != "EdDSA" {
+		return Response{}, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidResponseSignature, header.Algorithm)
+	}
+	key, ok := keys[header.KeyID]
+	if !ok {
+		return Response{}, fmt.Errorf("%w: unknown key ID %q", ErrInvalidResponseSignature, header.KeyID)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !ed25519.Verify(key, []byte(parts[0]+"."+parts[1]), signature) {
+		return Response{}, fmt.Errorf("%w: signature does not verify", ErrInvalidResponseSignature)
+	}
+
+	var payload signedResponse
+	if err := decodeJWSPart(parts[1], &payload); err != nil {
+		return Response{}, err
+	}
+	if payload.Nonce != nonce {
+		return Response{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidResponseSignature)
+	}
+	if payload.RequestHash != requestHash(requestBody) {
+		return Response{}, fmt.Errorf("%w: response was issued for another request", ErrInvalidResponseSignature)
+	}
+	return payload.Response, nil
+}
+
+func decodeJWSPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("%w: malformed JWS", ErrInvalidResponseSignature)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: malformed JWS", ErrInvalidResponseSignature)
+	}
+	return nil
+}
+
+func requestHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,183 @@
+package authorization
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSignedDecisionServer(t *testing.T, key ed25519.PrivateKey) *httptest.Server {
+	t.Helper()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		effect := EffectDeny
+		if req.Action == "read" {
+			effect = EffectAllow
+		}
+		json.NewEncoder(w).Encode(Response{Effect: effect, Message: "decided remotely"})
+	})
+	server := httptest.NewServer(ResponseSigningMiddleware("k1", key)(handler))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// tamperingTransport lets a test act as a proxy rewriting responses.
+func tamperingTransport(tamper func(resp *http.Response)) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err == nil {
+			tamper(resp)
+		}
+		return resp, err
+	})
+}
+
+func TestResponseSigning(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	server := newSignedDecisionServer(t, priv)
+	keys := map[string]ed25519.PublicKey{"k1": pub}
+	tokenFn := func() (string, error) { return "token", nil }
+
+	authorizer := NewBetandbeatRemoteAuthorizer(server.URL, tokenFn, WithResponseVerification(keys))
+	resp, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark", Action: "read"})
+	require.NoError(t, err)
+	assert.Equal(t, EffectAllow, resp.Effect)
+	resp, err = authorizer.Authorize(t.Context(), Request{Principal: "users/mark", Action: "delete"})
+	require.NoError(t, err)
+	assert.Equal(t, EffectDeny, resp.Effect)
+
+	t.Run("flipped body", func(t *testing.T) {
+		authorizer := NewBetandbeatRemoteAuthorizer(server.URL, tokenFn, WithResponseVerification(keys),
+			WithTransport(tamperingTransport(func(resp *http.Response) {
+				body, _ := io.ReadAll(resp.Body)
+				body = bytes.ReplaceAll(body, []byte(`"deny"`), []byte(`"allow"`))
+				resp.Body = io.NopCloser(bytes.NewReader(body))
+			})))
+		resp, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark", Action: "delete"})
+		require.NoError(t, err)
+		assert.Equal(t, EffectDeny, resp.Effect, "the signed decision wins over the body")
+	})
+
+	var captured string
+	capture := NewBetandbeatRemoteAuthorizer(server.URL, tokenFn, WithResponseVerification(keys),
+		WithTransport(tamperingTransport(func(resp *http.Response) {
+			captured = resp.Header.Get(responseSignatureHeader)
+		})))
+	_, err = capture.Authorize(t.Context(), Request{Principal: "users/mark", Action: "read"})
+	require.NoError(t, err)
+
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	tests := []struct {
+		name   string
+		keys   map[string]ed25519.PublicKey
+		tamper func(resp *http.Response)
+		err    string
+	}{
+		{
+			name:   "stripped signature",
+			keys:   keys,
+			tamper: func(resp *http.Response) { resp.Header.Del(responseSignatureHeader) },
+			err:    "not signed",
+		},
+		{
+			name:   "replayed signature",
+			keys:   keys,
+			tamper: func(resp *http.Response) { resp.Header.Set(responseSignatureHeader, captured) },
+			err:    "nonce mismatch",
+		},
+		{
+			name: "forged payload",
+			keys: keys,
+			tamper: func(resp *http.Response) {
+				parts := strings.Split(resp.Header.Get(responseSignatureHeader), ".")
+				parts[1] = parts[1][:len(parts[1])-2] + "AA"
+				resp.Header.Set(responseSignatureHeader, strings.Join(parts, "."))
+			},
+			err: "does not verify",
+		},
+		{
+			name:   "unknown signer",
+			keys:   map[string]ed25519.PublicKey{"k1": otherPub},
+			tamper: func(resp *http.Response) {},
+			err:    "does not verify",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authorizer := NewBetandbeatRemoteAuthorizer(server.URL, tokenFn, WithResponseVerification(tt.keys),
+				WithTransport(tamperingTransport(tt.tamper)))
+			resp, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark", Action: "read"})
+			assert.ErrorIs(t, err, ErrInvalidResponseSignature)
+			assert.ErrorContains(t, err, tt.err)
+			assert.Equal(t, EffectDeny, resp.Effect)
+		})
+	}
+}
+
+func TestVerifyResponse_RequestBinding(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	keys := map[string]ed25519.PublicKey{"k1": pub}
+
+	jws, err := signResponse("k1", priv, Response{Effect: EffectAllow}, []byte(`{"action":"read"}`), "n1", time.Now())
+	require.NoError(t, err)
+
+	resp, err := verifyResponse(jws, keys, []byte(`{"action":"read"}`), "n1")
+	require.NoError(t, err)
+	assert.Equal(t, EffectAllow, resp.Effect)
+
+	_, err = verifyResponse(jws, keys, []byte(`{"action":"delete"}`), "n1")
+	assert.ErrorContains(t, err, "another request")
+}
+
+func TestResponseSigningMiddleware_MaxBodyBytes(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	called := false
+	handler := ResponseSigningMiddleware("k1", priv, WithMaxRequestBodyBytes(16))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		json.NewEncoder(w).Encode(Response{Effect: EffectAllow})
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"action":"read"}`)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.False(t, called)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"action":"x"}`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get(responseSignatureHeader))
+}
+
+func TestResponseSigningMiddleware_SignsOnlyDecisions(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	for body, signed := range map[string]bool{
+		`{"effect":"allow"}`:                  true,
+		`{"decision":false}`:                  true,
+		`{"effect":""}`:                       false,
+		`{"evaluations":[{"decision":true}]}`: false,
+		`not json`:                            false,
+	} {
+		handler := ResponseSigningMiddleware("k1", priv)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`)))
+		assert.Equal(t, signed, rec.Header().Get(responseSignatureHeader) != "", body)
+		assert.Equal(t, body, rec.Body.String())
+	}
+}
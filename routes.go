@@ -0,0 +1,93 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// ErrNoPrincipal is returned by a PrincipalExtractor when the request does not
+// identify a principal.
+var ErrNoPrincipal = errors.New("request has no principal")
+
+// PrincipalExtractor identifies the principal making an HTTP request.
+type PrincipalExtractor func(r *http.Request) (Principal, error)
+
+// PrincipalFromHeader extracts the principal from the named header, as set by
+// an authenticating proxy.
+func PrincipalFromHeader(name string) PrincipalExtractor {
+	return func(r *http.Request) (Principal, error) {
+		principal := strings.TrimSpace(r.Header.Get(name))
+		if principal == "" {
+			return "", ErrNoPrincipal
+		}
+		return Principal(principal), nil
+	}
+}
+
+// Route maps the HTTP requests matching Pattern to an action on a resource.
+type Route struct {
+	// Pattern is an http.ServeMux pattern, such as "GET /bets/{id}".
+	Pattern string
+	Action  ActionID
+	// Resource is expanded with the wildcards of Pattern, so "bets/{id}"
+	// becomes "bets/42" for GET /bets/42.
+	Resource string
+}
+
+var routeWildcard = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// routeMatcher finds the route of a request. It relies on http.ServeMux for
+// matching, so routes follow the same precedence rules.
+type routeMatcher struct {
+	mux *http.ServeMux
+}
+
+type routeMatchKey struct{}
+
+type routeMatch struct {
+	action   ActionID
+	resource Resource
+	matched  bool
+}
+
+// newRouteMatcher panics if a pattern is invalid or conflicts with another,
+// like http.ServeMux.Handle.
+func newRouteMatcher(routes []Route) *routeMatcher {
+	mux := http.NewServeMux()
+	for _, route := range routes {
+		mux.HandleFunc(route.Pattern, func(w http.ResponseWriter, r *http.Request) {
+			match := r.Context().Value(routeMatchKey{}).(*routeMatch)
+			match.action = route.Action
+			match.resource = Resource(routeWildcard.ReplaceAllStringFunc(route.Resource, func(wildcard string) string {
+				name := strings.TrimSuffix(wildcard[1:len(wildcard)-1], "...")
+				return r.PathValue(name)
+			}))
+			match.matched = true
+		})
+	}
+	return &routeMatcher{mux: mux}
+}
+
+// match returns the action and resource of the route r matches.
+func (m *routeMatcher) match(r *http.Request) (ActionID, Resource, bool) {
+	match := &routeMatch{}
+	m.mux.ServeHTTP(discardResponseWriter{}, r.WithContext(context.WithValue(r.Context(), routeMatchKey{}, match)))
+	return match.action, match.resource, match.matched
+}
+
+// discardResponseWriter swallows the responses of a routeMatcher's mux, such
+// as its 404s.
+type discardResponseWriter struct{}
+
+func (discardResponseWriter) Header() http.Header {
+	return make(http.Header)
+}
+
+func (discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (discardResponseWriter) WriteHeader(int) {}
@@ -0,0 +1,235 @@
+package authorization
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// ErrStatementNotFound is returned by a StatementStore when no statement exists
+// with the requested ID.
+var ErrStatementNotFound = errors.New("statement not found")
+
+// ErrNotSupported is returned when an operation needs an optional interface,
+// such as StatementHistory, that the storage does not implement.
+var ErrNotSupported = errors.New("operation not supported by the storage")
+
+const (
+	defaultStatementListLimit = 100
+	maxStatementListLimit     = 1000
+)
+
+// StatementLister pages through stored statements. It is the part of
+// StatementStore needed by read-only tooling such as WhoCan.
+type StatementLister interface {
+	// List returns a page of statements ordered by ID that match the filter.
+	List(filter StatementFilter) (StatementPage, error)
+}
+
+// StatementStore is the administrative interface to statement storage. It
+// extends the read path used by evaluators with CRUD and listing.
+type StatementStore interface {
+	Storage
+	StatementLister
+	// GetStatement returns ErrStatementNotFound if the statement does not exist.
+	GetStatement(id string) (*Statement, error)
+	// SaveStatement creates the statement or replaces the one with the same
+	// ID. Like every put, it is checked with Statement.Validate first.
+	SaveStatement(statement Statement) error
+	// DeleteStatement returns ErrStatementNotFound if the statement does not exist.
+	DeleteStatement(id string) error
+	// SaveStatementWithOptions saves the statement subject to the preconditions
+	// in opts and returns it as stored, with revision and bookkeeping fields set.
+	SaveStatementWithOptions(statement Statement, opts WriteOptions) (Statement, error)
+	// DeleteStatementWithOptions deletes the statement subject to the
+	// preconditions in opts.
+	DeleteStatementWithOptions(id string, opts WriteOptions) error
+	// ApplyBatch applies the operations in order and atomically: readers see
+	// either none or all of them. Puts are checked with Statement.Validate,
+	// and if any operation fails nothing is applied and a *BatchError is
+	// returned.
+	ApplyBatch(ops []BatchOperation) error
+}
+
+// ErrConflict matches every *ConflictError with errors.Is.
+var ErrConflict = errors.New("statement revision conflict")
+
+// ConflictError is returned when a conditional write finds the statement in a
+// different state than the caller expected.
+type ConflictError struct {
+	StatementID string
+	// Expected is the IfMatch revision, 0 for IfNotExists writes.
+	Expected uint64
+	// Actual is the stored revision, 0 if the statement does not exist or
+	// was created by a concurrent write.
+	Actual uint64
+}
+
+func (e *ConflictError) Error() string {
+	if e.Expected == 0 && e.Actual == 0 {
+		return fmt.Sprintf("statement %q was created concurrently", e.StatementID)
+	}
+	if e.Expected == 0 {
+		return fmt.Sprintf("statement %q already exists at revision %d", e.StatementID, e.Actual)
+	}
+	if e.Actual == 0 {
+		return fmt.Sprintf("statement %q expected at revision %d does not exist", e.StatementID, e.Expected)
+	}
+	return fmt.Sprintf("statement %q expected at revision %d is at revision %d", e.StatementID, e.Expected, e.Actual)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// WriteOptions control conditional writes and the bookkeeping of who changed a
+// statement.
+type WriteOptions struct {
+	// Actor is recorded as UpdatedBy, and as CreatedBy when the statement is
+	// created. When empty the values supplied in the statement are kept.
+	Actor string
+	// IfMatch, when non-zero, requires the stored statement to be at this
+	// revision, typically the Revision of the statement the caller read.
+	IfMatch uint64
+	// IfNotExists requires that no statement with the ID exists yet. It is
+	// ignored by deletes.
+	IfNotExists bool
+}
+
+// checkWritePrecondition validates opts against the currently stored
+// statement, nil if it does not exist.
+func checkWritePrecondition(id string, current *Statement, opts WriteOptions) error {
+	if opts.IfNotExists && current != nil {
+		return &ConflictError{StatementID: id, Actual: current.Revision}
+	}
+	if opts.IfMatch != 0 {
+		if current == nil {
+			return &ConflictError{StatementID: id, Expected: opts.IfMatch}
+		}
+		if current.Revision != opts.IfMatch {
+			return &ConflictError{StatementID: id, Expected: opts.IfMatch, Actual: current.Revision}
+		}
+	}
+	return nil
+}
+
+// stampStatement fills in the creation and update bookkeeping of a statement
+// about to replace current, nil if it is being created. The revision is left
+// to the storage.
+func stampStatement(stmt Statement, current *Statement, actor string, now time.Time) Statement {
+	if current != nil {
+		stmt.CreatedAt = current.CreatedAt
+		stmt.CreatedBy = current.CreatedBy
+	} else {
+		if stmt.CreatedAt.IsZero() {
+			stmt.CreatedAt = now
+		}
+		if actor != "" {
+			stmt.CreatedBy = actor
+		}
+	}
+	stmt.UpdatedAt = now
+	if actor != "" {
+		stmt.UpdatedBy = actor
+	}
+	return stmt
+}
+
+// StatementFilter selects and pages statements for StatementStore.List. Zero
+// valued fields do not filter.
+type StatementFilter struct {
+	Effect Effect
+	// ActionPattern matches statements with at least one action that matches
+	// the glob pattern, or that equals it.
+	ActionPattern string
+	// ResourcePrefix matches statements with at least one resource starting
+	// with the prefix.
+	ResourcePrefix string
+	CreatedBy      string
+	Active         *bool
+
+	// Cursor is the NextCursor of the previous page, empty for the first page.
+	Cursor string
+	// Limit is the maximum page size, defaulting to 100 and capped at 1000.
+	Limit int
+}
+
+// StatementPage is a page of statements. NextCursor is empty on the last page.
+type StatementPage struct {
+	Statements []Statement `json:"statements"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+// Matches reports whether the statement passes all filter criteria. Paging
+// fields are ignored.
+func (f StatementFilter) Matches(stmt Statement) bool {
+	if f.Effect != "" && stmt.Effect != f.Effect {
+		return false
+	}
+	if f.CreatedBy != "" && stmt.CreatedBy != f.CreatedBy {
+		return false
+	}
+	if f.Active != nil && stmt.Active != *f.Active {
+		return false
+	}
+	if f.ActionPattern != "" && !actionPatternMatches(stmt.Actions, f.ActionPattern) {
+		return false
+	}
+	if f.ResourcePrefix != "" && !resourcePrefixMatches(stmt.Resources, f.ResourcePrefix) {
+		return false
+	}
+	return true
+}
+
+func (f StatementFilter) limit() int {
+	switch {
+	case f.Limit <= 0:
+		return defaultStatementListLimit
+	case f.Limit > maxStatementListLimit:
+		return maxStatementListLimit
+	default:
+		return f.Limit
+	}
+}
+
+func actionPatternMatches(actions []ActionID, pattern string) bool {
+	for _, a := range actions {
+		if string(a) == pattern {
+			return true
+		}
+		if matched, _ := doublestar.Match(enhancePattern(pattern), string(a)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func resourcePrefixMatches(resources []Resource, prefix string) bool {
+	for _, r := range resources {
+		if strings.HasPrefix(string(r), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeStatementCursor and decodeStatementCursor keep cursors opaque to
+// callers; a cursor is the ID of the last statement on the previous page.
+func encodeStatementCursor(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+func decodeStatementCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+	id, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", fmt.Errorf("invalid cursor %q", cursor)
+	}
+	return string(id), nil
+}
@@ -0,0 +1,316 @@
+package authorization
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryStorage_NotFound(t *testing.T) {
+	storage := NewInMemoryStorage()
+
+	_, err := storage.GetStatement("missing")
+	assert.ErrorIs(t, err, ErrStatementNotFound)
+	assert.ErrorIs(t, storage.DeleteStatement("missing"), ErrStatementNotFound)
+}
+
+func TestStatementStore_ListPagination(t *testing.T) {
+	forEachStatementStore(t, func(t *testing.T, storage StatementStore) {
+		for i := range 25 {
+			require.NoError(t, storage.SaveStatement(Statement{ID: fmt.Sprintf("stmt-%02d", i), Effect: EffectAllow}))
+		}
+
+		var ids []string
+		filter := StatementFilter{Limit: 10}
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 3, "pagination did not terminate")
+			page, err := storage.List(filter)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(page.Statements), 10)
+			ids = append(ids, statementIDs(page.Statements)...)
+			if page.NextCursor == "" {
+				break
+			}
+			filter.Cursor = page.NextCursor
+		}
+
+		require.Len(t, ids, 25)
+		assert.Equal(t, "stmt-00", ids[0])
+		assert.Equal(t, "stmt-24", ids[24])
+		assert.IsIncreasing(t, ids)
+	})
+}
+
+func TestStatementStore_ListFilteredPagination(t *testing.T) {
+	forEachStatementStore(t, func(t *testing.T, storage StatementStore) {
+		for i := range 25 {
+			effect := EffectAllow
+			if i%3 == 0 {
+				effect = EffectDeny
+			}
+			require.NoError(t, storage.SaveStatement(Statement{ID: fmt.Sprintf("stmt-%02d", i), Effect: effect}))
+		}
+
+		var ids []string
+		filter := StatementFilter{Effect: EffectDeny, Limit: 4}
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 3, "pagination did not terminate")
+			page, err := storage.List(filter)
+			require.NoError(t, err)
+			ids = append(ids, statementIDs(page.Statements)...)
+			if page.NextCursor == "" {
+				break
+			}
+			filter.Cursor = page.NextCursor
+		}
+
+		assert.Equal(t, []string{"stmt-00", "stmt-03", "stmt-06", "stmt-09", "stmt-12", "stmt-15", "stmt-18", "stmt-21", "stmt-24"}, ids)
+	})
+}
+
+func TestStatementStore_ListExactPage(t *testing.T) {
+	forEachStatementStore(t, func(t *testing.T, storage StatementStore) {
+		for i := range 2 {
+			require.NoError(t, storage.SaveStatement(Statement{ID: fmt.Sprintf("stmt-%d", i), Effect: EffectAllow}))
+		}
+
+		page, err := storage.List(StatementFilter{Limit: 2})
+		require.NoError(t, err)
+		assert.Len(t, page.Statements, 2)
+		assert.Empty(t, page.NextCursor, "a full last page should not have a cursor")
+	})
+}
+
+func TestStatementStore_ListFilters(t *testing.T) {
+	forEachStatementStore(t, func(t *testing.T, storage StatementStore) {
+		for _, stmt := range []Statement{
+			{ID: "a", Active: true, Effect: EffectAllow, Actions: []ActionID{"iam:GetUser"}, Resources: []Resource{"users/*"}, CreatedBy: "users/alice"},
+			{ID: "b", Active: false, Effect: EffectAllow, Actions: []ActionID{"iam:*"}, Resources: []Resource{"users/bob"}, CreatedBy: "users/bob"},
+			{ID: "c", Active: true, Effect: EffectDeny, Actions: []ActionID{"ledger:Create"}, Resources: []Resource{"transactions/*"}, CreatedBy: "users/alice"},
+		} {
+			require.NoError(t, storage.SaveStatement(stmt))
+		}
+		active, inactive := true, false
+
+		testCases := []struct {
+			name     string
+			filter   StatementFilter
+			expected []string
+		}{
+			{name: "no filter", filter: StatementFilter{}, expected: []string{"a", "b", "c"}},
+			{name: "effect", filter: StatementFilter{Effect: EffectDeny}, expected: []string{"c"}},
+			{name: "action pattern", filter: StatementFilter{ActionPattern: "iam:*"}, expected: []string{"a", "b"}},
+			{name: "action exact", filter: StatementFilter{ActionPattern: "ledger:Create"}, expected: []string{"c"}},
+			{name: "resource prefix", filter: StatementFilter{ResourcePrefix: "users/"}, expected: []string{"a", "b"}},
+			{name: "created by", filter: StatementFilter{CreatedBy: "users/alice"}, expected: []string{"a", "c"}},
+			{name: "active", filter: StatementFilter{Active: &active}, expected: []string{"a", "c"}},
+			{name: "inactive", filter: StatementFilter{Active: &inactive}, expected: []string{"b"}},
+			{name: "combined", filter: StatementFilter{Active: &active, ResourcePrefix: "users/"}, expected: []string{"a"}},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				page, err := storage.List(tc.filter)
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, statementIDs(page.Statements))
+				assert.Empty(t, page.NextCursor)
+			})
+		}
+	})
+}
+
+func TestStatementStore_ListInvalidCursor(t *testing.T) {
+	forEachStatementStore(t, func(t *testing.T, storage StatementStore) {
+		_, err := storage.List(StatementFilter{Cursor: "not base64!"})
+		assert.Error(t, err)
+	})
+}
+
+func TestStatementStore_SaveRejectsInvalidStatement(t *testing.T) {
+	forEachStatementStore(t, func(t *testing.T, storage StatementStore) {
+		_, err := storage.SaveStatementWithOptions(Statement{ID: "a", Effect: "maybe"}, WriteOptions{})
+		assert.ErrorContains(t, err, `invalid effect "maybe"`)
+		err = storage.SaveStatement(Statement{ID: "b", Effect: EffectAllow, Resources: []Resource{"documents/["}})
+		assert.ErrorContains(t, err, "invalid resource pattern")
+
+		_, err = storage.GetStatement("a")
+		assert.ErrorIs(t, err, ErrStatementNotFound)
+		_, err = storage.GetStatement("b")
+		assert.ErrorIs(t, err, ErrStatementNotFound)
+	})
+}
+
+func TestStatementStore_Revisions(t *testing.T) {
+	forEachStatementStore(t, func(t *testing.T, storage StatementStore) {
+		a, err := storage.SaveStatementWithOptions(Statement{ID: "a", Effect: EffectAllow}, WriteOptions{})
+		require.NoError(t, err)
+		b, err := storage.SaveStatementWithOptions(Statement{ID: "b", Effect: EffectAllow}, WriteOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{1, 2}, []uint64{a.Revision, b.Revision}, "revisions are store-wide")
+
+		require.NoError(t, storage.DeleteStatementWithOptions("b", WriteOptions{IfMatch: b.Revision}))
+		a, err = storage.SaveStatementWithOptions(a, WriteOptions{IfMatch: a.Revision})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(4), a.Revision, "deletes take a revision too")
+
+		require.NoError(t, storage.ApplyBatch([]BatchOperation{
+			BatchPut(Statement{ID: "c", Effect: EffectAllow}, WriteOptions{}),
+			BatchPut(Statement{ID: "d", Effect: EffectAllow}, WriteOptions{}),
+		}))
+		page, err := storage.List(StatementFilter{})
+		require.NoError(t, err)
+		var revisions []uint64
+		for _, stmt := range page.Statements {
+			revisions = append(revisions, stmt.Revision)
+		}
+		assert.Equal(t, []uint64{4, 5, 6}, revisions, "every batch operation takes its own revision")
+
+		_, err = storage.SaveStatementWithOptions(a, WriteOptions{IfMatch: 1})
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+}
+
+func TestStatementStore_ConcurrentCreate(t *testing.T) {
+	forEachStatementStore(t, func(t *testing.T, storage StatementStore) {
+		const writers = 8
+		errs := make(chan error, writers)
+		var wg sync.WaitGroup
+		for i := range writers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := storage.SaveStatementWithOptions(
+					Statement{ID: "a", Effect: EffectAllow, Description: fmt.Sprint(i)},
+					WriteOptions{IfNotExists: true},
+				)
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		created := 0
+		for err := range errs {
+			if err == nil {
+				created++
+				continue
+			}
+			assert.ErrorIs(t, err, ErrConflict)
+		}
+		assert.Equal(t, 1, created, "exactly one create must win")
+	})
+}
+
+func TestStatementStore_ListStatementsByPrincipal(t *testing.T) {
+	forEachStatementStore(t, func(t *testing.T, storage StatementStore) {
+		for _, stmt := range []Statement{
+			{ID: "exact", Effect: EffectAllow, Principals: []Principal{"users/mark"}, Actions: []ActionID{"read"}, Resources: []Resource{"*"}},
+			{ID: "users-wildcard", Effect: EffectAllow, Principals: []Principal{"users/*"}, Actions: []ActionID{"read"}, Resources: []Resource{"*"}},
+			{ID: "admins-only", Effect: EffectAllow, Principals: []Principal{"users/admin*"}, Actions: []ActionID{"read"}, Resources: []Resource{"*"}},
+			{ID: "everyone", Effect: EffectDeny, Principals: []Principal{"*"}, Actions: []ActionID{"delete"}, Resources: []Resource{"*"}},
+			{ID: "other-user", Effect: EffectAllow, Principals: []Principal{"users/alice"}, Actions: []ActionID{"read"}, Resources: []Resource{"*"}},
+			{ID: "roles", Effect: EffectAllow, Principals: []Principal{"roles/[a-z]*"}, Actions: []ActionID{"read"}, Resources: []Resource{"*"}},
+		} {
+			require.NoError(t, storage.SaveStatement(stmt))
+		}
+
+		statements, err := storage.ListStatementsByPrincipal("users/mark")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"everyone", "exact", "users-wildcard"}, statementIDs(statements))
+
+		statements, err = storage.ListStatementsByPrincipal("users/admin1")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"admins-only", "everyone", "users-wildcard"}, statementIDs(statements))
+
+		statements, err = storage.ListStatementsByPrincipal("roles/moderator")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"everyone", "roles"}, statementIDs(statements))
+	})
+}
+
+// forEachStatementStore runs the test against every StatementStore
+// implementation, each starting empty.
+func forEachStatementStore(t *testing.T, test func(t *testing.T, storage StatementStore)) {
+	backends := []struct {
+		name string
+		new  func(t *testing.T) StatementStore
+	}{
+		{name: "in-memory", new: func(t *testing.T) StatementStore { return NewInMemoryStorage() }},
+		{name: "mysql", new: func(t *testing.T) StatementStore { return newMigratedSQLStorage(t, SQLDialectMySQL) }},
+		{name: "postgres", new: func(t *testing.T) StatementStore { return newMigratedSQLStorage(t, SQLDialectPostgres) }},
+	}
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			test(t, backend.new(t))
+		})
+	}
+}
+
+func TestInMemoryStorage_ConditionalWrites(t *testing.T) {
+	storage := NewInMemoryStorage()
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	storage.now = func() time.Time { return now }
+
+	created, err := storage.SaveStatementWithOptions(Statement{ID: "a", Effect: EffectAllow}, WriteOptions{Actor: "users/alice", IfNotExists: true})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), created.Revision)
+	assert.Equal(t, now, created.CreatedAt)
+	assert.Equal(t, now, created.UpdatedAt)
+	assert.Equal(t, "users/alice", created.CreatedBy)
+	assert.Equal(t, "users/alice", created.UpdatedBy)
+
+	_, err = storage.SaveStatementWithOptions(Statement{ID: "a", Effect: EffectAllow}, WriteOptions{IfNotExists: true})
+	assert.ErrorIs(t, err, ErrConflict)
+
+	// Two admins read revision 1; the first write wins, the second conflicts.
+	now = now.Add(time.Hour)
+	first := created
+	first.Description = "first"
+	updated, err := storage.SaveStatementWithOptions(first, WriteOptions{Actor: "users/bob", IfMatch: created.Revision})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), updated.Revision)
+	assert.Equal(t, created.CreatedAt, updated.CreatedAt)
+	assert.Equal(t, now, updated.UpdatedAt)
+	assert.Equal(t, "users/alice", updated.CreatedBy)
+	assert.Equal(t, "users/bob", updated.UpdatedBy)
+
+	second := created
+	second.Description = "second"
+	_, err = storage.SaveStatementWithOptions(second, WriteOptions{Actor: "users/carol", IfMatch: created.Revision})
+	var conflict *ConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, "a", conflict.StatementID)
+	assert.Equal(t, uint64(1), conflict.Expected)
+	assert.Equal(t, uint64(2), conflict.Actual)
+
+	stored, err := storage.GetStatement("a")
+	require.NoError(t, err)
+	assert.Equal(t, "first", stored.Description)
+
+	_, err = storage.SaveStatementWithOptions(Statement{ID: "missing", Effect: EffectAllow}, WriteOptions{IfMatch: 1})
+	assert.ErrorIs(t, err, ErrConflict)
+
+	assert.ErrorIs(t, storage.DeleteStatementWithOptions("a", WriteOptions{IfMatch: 1}), ErrConflict)
+	require.NoError(t, storage.DeleteStatementWithOptions("a", WriteOptions{IfMatch: 2}))
+	assert.ErrorIs(t, storage.DeleteStatementWithOptions("a", WriteOptions{}), ErrStatementNotFound)
+}
+
+func TestInMemoryStorage_SaveStatementBookkeeping(t *testing.T) {
+	storage := NewInMemoryStorage()
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, storage.SaveStatement(Statement{ID: "a", Effect: EffectAllow, CreatedAt: created, CreatedBy: "users/alice", UpdatedBy: "users/alice"}))
+	require.NoError(t, storage.SaveStatement(Statement{ID: "a", Effect: EffectAllow, CreatedBy: "users/mallory", UpdatedBy: "users/bob"}))
+
+	stored, err := storage.GetStatement("a")
+	require.NoError(t, err)
+	assert.Equal(t, created, stored.CreatedAt, "creation time must survive blind overwrites")
+	assert.Equal(t, "users/alice", stored.CreatedBy)
+	assert.Equal(t, "users/bob", stored.UpdatedBy)
+	assert.False(t, stored.UpdatedAt.IsZero())
+	assert.Equal(t, uint64(2), stored.Revision)
+}
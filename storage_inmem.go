@@ -1,60 +1,352 @@
 package authorization
 
 import (
+	"context"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
+)
 
-	"github.com/bmatcuk/doublestar/v4"
+var (
+	_ StatementStore   = (*inMemoryStorage)(nil)
+	_ StatementWatcher = (*inMemoryStorage)(nil)
+	_ StatementHistory = (*inMemoryStorage)(nil)
 )
 
+// inMemoryChangeHistory is the number of change events retained for watchers
+// resuming from an earlier revision.
+const inMemoryChangeHistory = 10000
+
 type inMemoryStorage struct {
 	mu         sync.RWMutex
 	statements map[string]Statement
+	now        func() time.Time
+
+	revision uint64
+	changes  []ChangeEvent
+	// versions retains every change of every statement, oldest first.
+	versions map[string][]ChangeEvent
+	// changed is closed and replaced on every write to wake up watchers.
+	changed chan struct{}
 }
 
 func NewInMemoryStorage() *inMemoryStorage {
 	return &inMemoryStorage{
 		statements: make(map[string]Statement),
+		versions:   make(map[string][]ChangeEvent),
+		now:        time.Now,
+		changed:    make(chan struct{}),
 	}
 }
 
 func (s *inMemoryStorage) SaveStatement(statement Statement) error {
+	_, err := s.SaveStatementWithOptions(statement, WriteOptions{})
+	return err
+}
+
+func (s *inMemoryStorage) SaveStatementWithOptions(statement Statement, opts WriteOptions) (Statement, error) {
+	if err := statement.Validate(); err != nil {
+		return Statement{}, err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.statements[statement.ID] = statement
-	return nil
+	var current *Statement
+	if stmt, ok := s.statements[statement.ID]; ok {
+		current = &stmt
+	}
+	if err := checkWritePrecondition(statement.ID, current, opts); err != nil {
+		return Statement{}, err
+	}
+
+	now := s.now()
+	statement = stampStatement(statement, current, opts.Actor, now)
+	statement.Revision = s.revision + 1
+	s.commit([]ChangeEvent{{
+		Revision: statement.Revision, Type: ChangePut, StatementID: statement.ID, Statement: &statement,
+		Actor: opts.Actor, At: now,
+	}})
+	return statement, nil
 }
 
 func (s *inMemoryStorage) DeleteStatement(id string) error {
+	return s.DeleteStatementWithOptions(id, WriteOptions{})
+}
+
+func (s *inMemoryStorage) DeleteStatementWithOptions(id string, opts WriteOptions) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	delete(s.statements, id)
+	current, ok := s.statements[id]
+	if !ok {
+		return ErrStatementNotFound
+	}
+	opts.IfNotExists = false
+	if err := checkWritePrecondition(id, &current, opts); err != nil {
+		return err
+	}
+
+	s.commit([]ChangeEvent{{
+		Revision: s.revision + 1, Type: ChangeDelete, StatementID: id,
+		Actor: opts.Actor, At: s.now(),
+	}})
 	return nil
 }
 
+func (s *inMemoryStorage) ApplyBatch(ops []BatchOperation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Operations are staged on top of the stored statements so later
+	// operations see earlier ones, and a failure leaves the storage untouched.
+	staged := make(map[string]*Statement)
+	current := func(id string) *Statement {
+		if stmt, ok := staged[id]; ok {
+			return stmt
+		}
+		if stmt, ok := s.statements[id]; ok {
+			return &stmt
+		}
+		return nil
+	}
+
+	now := s.now()
+	revision := s.revision
+	events := make([]ChangeEvent, 0, len(ops))
+	for i, op := range ops {
+		id := op.id()
+		existing := current(id)
+		var err error
+		switch op.Type {
+		case ChangePut:
+			if err = op.Statement.Validate(); err != nil {
+				break
+			}
+			if err = checkWritePrecondition(id, existing, op.Options); err != nil {
+				break
+			}
+			stmt := stampStatement(op.Statement, existing, op.Options.Actor, now)
+			revision++
+			stmt.Revision = revision
+			staged[id] = &stmt
+			events = append(events, ChangeEvent{
+				Revision: revision, Type: ChangePut, StatementID: id, Statement: &stmt,
+				Actor: op.Options.Actor, At: now,
+			})
+		case ChangeDelete:
+			if existing == nil {
+				err = ErrStatementNotFound
+				break
+			}
+			opts := op.Options
+			opts.IfNotExists = false
+			if err = checkWritePrecondition(id, existing, opts); err != nil {
+				break
+			}
+			revision++
+			staged[id] = nil
+			events = append(events, ChangeEvent{
+				Revision: revision, Type: ChangeDelete, StatementID: id,
+				Actor: op.Options.Actor, At: now,
+			})
+		default:
+			err = fmt.Errorf("unknown operation type %q", op.Type)
+		}
+		if err != nil {
+			return &BatchError{Index: i, StatementID: id, Err: err}
+		}
+	}
+
+	s.commit(events)
+	return nil
+}
+
+// commit applies changes carrying consecutive revisions after the current one,
+// records them in the watch and version histories and wakes up watchers. The
+// caller must hold the write lock.
+func (s *inMemoryStorage) commit(events []ChangeEvent) {
+	for _, event := range events {
+		if event.Type == ChangePut {
+			s.statements[event.StatementID] = *event.Statement
+		} else {
+			delete(s.statements, event.StatementID)
+		}
+		s.changes = append(s.changes, event)
+		s.versions[event.StatementID] = append(s.versions[event.StatementID], event)
+		s.revision = event.Revision
+	}
+	if len(s.changes) > inMemoryChangeHistory {
+		s.changes = append([]ChangeEvent(nil), s.changes[len(s.changes)-inMemoryChangeHistory:]...)
+	}
+	if len(events) > 0 {
+		s.notifyWatchers()
+	}
+}
+
+func (s *inMemoryStorage) ListStatementVersions(id string) ([]ChangeEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	versions, ok := s.versions[id]
+	if !ok {
+		return nil, ErrStatementNotFound
+	}
+	return append([]ChangeEvent(nil), versions...), nil
+}
+
+func (s *inMemoryStorage) RestoreStatementVersion(id string, revision uint64, opts WriteOptions) (Statement, error) {
+	s.mu.RLock()
+	versions, ok := s.versions[id]
+	var restored *Statement
+	for _, version := range versions {
+		if version.Revision == revision {
+			restored = version.Statement
+		}
+	}
+	s.mu.RUnlock()
+	if !ok {
+		return Statement{}, ErrStatementNotFound
+	}
+	if restored == nil {
+		return Statement{}, ErrVersionNotFound
+	}
+	return s.SaveStatementWithOptions(*restored, opts)
+}
+
+func (s *inMemoryStorage) ListStatementsByPrincipalAt(principal Principal, at time.Time) ([]Statement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []Statement
+	for _, versions := range s.versions {
+		// Versions are ordered by time, find the last one made at or before at.
+		i := sort.Search(len(versions), func(i int) bool {
+			return versions[i].At.After(at)
+		})
+		if i == 0 || versions[i-1].Type == ChangeDelete {
+			continue
+		}
+		stmt := *versions[i-1].Statement
+		if principalMatches(stmt.Principals, principal) {
+			result = append(result, stmt)
+		}
+	}
+	return result, nil
+}
+
+// notifyWatchers wakes up watchers after changes were appended. The caller
+// must hold the write lock.
+func (s *inMemoryStorage) notifyWatchers() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *inMemoryStorage) Revision() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.revision
+}
+
+func (s *inMemoryStorage) Watch(ctx context.Context, fromRevision uint64) (<-chan ChangeEvent, error) {
+	s.mu.RLock()
+	if s.compactedAfter(fromRevision) {
+		s.mu.RUnlock()
+		return nil, ErrRevisionCompacted
+	}
+	s.mu.RUnlock()
+
+	ch := make(chan ChangeEvent, 64)
+	go func() {
+		defer close(ch)
+		last := fromRevision
+		for {
+			s.mu.RLock()
+			if s.compactedAfter(last) {
+				s.mu.RUnlock()
+				return
+			}
+			// The history is only ever appended to or replaced, so the
+			// sub-slice stays valid after the lock is released.
+			pending := s.changes[sort.Search(len(s.changes), func(i int) bool {
+				return s.changes[i].Revision > last
+			}):]
+			changed := s.changed
+			s.mu.RUnlock()
+
+			for _, event := range pending {
+				select {
+				case ch <- event:
+					last = event.Revision
+				case <-ctx.Done():
+					return
+				}
+			}
+			if len(pending) > 0 {
+				continue
+			}
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// compactedAfter reports whether some change after the given revision is no
+// longer retained. The caller must hold the lock.
+func (s *inMemoryStorage) compactedAfter(revision uint64) bool {
+	return len(s.changes) > 0 && s.changes[0].Revision > revision+1
+}
+
 func (s *inMemoryStorage) GetStatement(id string) (*Statement, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	stmt, ok := s.statements[id]
 	if !ok {
-		return nil, nil
+		return nil, ErrStatementNotFound
 	}
 	return &stmt, nil
 }
 
+func (s *inMemoryStorage) List(filter StatementFilter) (StatementPage, error) {
+	after, err := decodeStatementCursor(filter.Cursor)
+	if err != nil {
+		return StatementPage{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.statements))
+	for id := range s.statements {
+		if id > after {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var page StatementPage
+	limit := filter.limit()
+	for _, id := range ids {
+		stmt := s.statements[id]
+		if !filter.Matches(stmt) {
+			continue
+		}
+		if len(page.Statements) == limit {
+			page.NextCursor = encodeStatementCursor(page.Statements[limit-1].ID)
+			break
+		}
+		page.Statements = append(page.Statements, stmt)
+	}
+	return page, nil
+}
+
 func (s *inMemoryStorage) ListStatementsByPrincipal(principal Principal) ([]Statement, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	var result []Statement
 	for _, stmt := range s.statements {
-		for _, p := range stmt.Principals {
-			matched, err := doublestar.Match(string(p), string(principal))
-			if err != nil {
-				return nil, err
-			}
-			if matched {
-				result = append(result, stmt)
-				break
-			}
+		// Listing matches principals like the evaluator and the SQL storage.
+		if principalMatches(stmt.Principals, principal) {
+			result = append(result, stmt)
 		}
 	}
 	return result, nil
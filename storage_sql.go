@@ -0,0 +1,593 @@
+package authorization
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+var _ StatementStore = (*sqlStorage)(nil)
+
+//go:embed migrations
+var sqlMigrations embed.FS
+
+// SQLDialect identifies the flavour of SQL spoken by the database behind a
+// SQL storage. It selects the placeholder syntax and the migration set.
+type SQLDialect string
+
+const (
+	SQLDialectPostgres SQLDialect = "postgres"
+	// SQLDialectMySQL requires the DSN to enable parseTime so timestamps scan
+	// into time.Time.
+	SQLDialectMySQL SQLDialect = "mysql"
+)
+
+// placeholders returns count comma separated bind parameters, numbered from
+// start for dialects that use positional parameters.
+func (d SQLDialect) placeholders(start, count int) string {
+	params := make([]string, count)
+	for i := range params {
+		if d == SQLDialectPostgres {
+			params[i] = fmt.Sprintf("$%d", start+i)
+		} else {
+			params[i] = "?"
+		}
+	}
+	return strings.Join(params, ", ")
+}
+
+// sqlQueryer is satisfied by both *sql.DB and *sql.Tx.
+type sqlQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// sqlStorage is a database/sql backed implementation of Storage. Statements are
+// stored in a normalized schema with one table per statement list, see the
+// migrations directory.
+type sqlStorage struct {
+	db      *sql.DB
+	dialect SQLDialect
+	now     func() time.Time
+}
+
+// NewSQLStorage creates a storage on top of an open database handle. Call
+// Migrate before first use to create or upgrade the schema.
+func NewSQLStorage(db *sql.DB, dialect SQLDialect) *sqlStorage {
+	return &sqlStorage{
+		db:      db,
+		dialect: dialect,
+		now:     time.Now,
+	}
+}
+
+// Migrate applies the embedded migrations that have not been applied yet, in
+// lexical order, recording each one in authz_schema_migrations.
+func (s *sqlStorage) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS authz_schema_migrations (version VARCHAR(255) PRIMARY KEY)"); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	applied, err := s.queryStrings(ctx, s.db, "SELECT version FROM authz_schema_migrations")
+	if err != nil {
+		return fmt.Errorf("failed to list applied migrations: %w", err)
+	}
+	done := make(map[string]bool, len(applied))
+	for _, version := range applied {
+		done[version] = true
+	}
+
+	files, err := fs.Glob(sqlMigrations, "migrations/"+string(s.dialect)+"/*.sql")
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no migrations for SQL dialect %q", s.dialect)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		version := strings.TrimSuffix(path.Base(file), ".sql")
+		if done[version] {
+			continue
+		}
+		script, err := sqlMigrations.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		err = s.inTx(ctx, func(tx *sql.Tx) error {
+			for _, stmt := range strings.Split(string(script), ";") {
+				if strings.TrimSpace(stmt) == "" {
+					continue
+				}
+				if _, err := tx.ExecContext(ctx, stmt); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, "INSERT INTO authz_schema_migrations (version) VALUES ("+s.dialect.placeholders(1, 1)+")", version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %q: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func (s *sqlStorage) SaveStatement(statement Statement) error {
+	_, err := s.SaveStatementWithOptions(statement, WriteOptions{})
+	return err
+}
+
+// SaveStatementWithOptions saves the statement subject to the preconditions in
+// opts. Like the in-memory storage, every write takes the next store-wide
+// revision from authz_revision; replacing a statement also compares and swaps
+// its own revision, which locks the row until commit. When a concurrent write
+// creates the same statement first, a ConflictError is returned.
+func (s *sqlStorage) SaveStatementWithOptions(statement Statement, opts WriteOptions) (Statement, error) {
+	if err := statement.Validate(); err != nil {
+		return Statement{}, err
+	}
+	ctx := context.Background()
+	var saved Statement
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		saved, err = s.saveStatement(ctx, tx, statement, opts, s.now())
+		return err
+	})
+	if err != nil {
+		return Statement{}, err
+	}
+	return saved, nil
+}
+
+func (s *sqlStorage) DeleteStatement(id string) error {
+	return s.DeleteStatementWithOptions(id, WriteOptions{})
+}
+
+func (s *sqlStorage) DeleteStatementWithOptions(id string, opts WriteOptions) error {
+	ctx := context.Background()
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		return s.removeStatement(ctx, tx, id, opts)
+	})
+}
+
+// ApplyBatch applies the operations in a single database transaction, which is
+// rolled back if any operation fails.
+func (s *sqlStorage) ApplyBatch(ops []BatchOperation) error {
+	ctx := context.Background()
+	now := s.now()
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		for i, op := range ops {
+			var err error
+			switch op.Type {
+			case ChangePut:
+				if err = op.Statement.Validate(); err == nil {
+					_, err = s.saveStatement(ctx, tx, op.Statement, op.Options, now)
+				}
+			case ChangeDelete:
+				err = s.removeStatement(ctx, tx, op.StatementID, op.Options)
+			default:
+				err = fmt.Errorf("unknown operation type %q", op.Type)
+			}
+			if err != nil {
+				return &BatchError{Index: i, StatementID: op.id(), Err: err}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqlStorage) saveStatement(ctx context.Context, tx *sql.Tx, statement Statement, opts WriteOptions, now time.Time) (Statement, error) {
+	current, err := s.currentStatement(ctx, tx, statement.ID)
+	if err != nil {
+		return Statement{}, err
+	}
+	if err := checkWritePrecondition(statement.ID, current, opts); err != nil {
+		return Statement{}, err
+	}
+
+	statement = stampStatement(statement, current, opts.Actor, now)
+	statement.Revision, err = s.nextRevision(ctx, tx)
+	if err != nil {
+		return Statement{}, err
+	}
+	if current != nil {
+		if err := s.swapRevision(ctx, tx, current, statement.Revision); err != nil {
+			return Statement{}, err
+		}
+		if err := s.deleteStatement(ctx, tx, statement.ID); err != nil {
+			return Statement{}, err
+		}
+	}
+	if err := s.insertStatement(ctx, tx, statement); err != nil {
+		if current == nil && isUniqueViolation(err) {
+			// Another transaction created the statement after it was read.
+			return Statement{}, &ConflictError{StatementID: statement.ID}
+		}
+		return Statement{}, err
+	}
+	return statement, nil
+}
+
+func (s *sqlStorage) removeStatement(ctx context.Context, tx *sql.Tx, id string, opts WriteOptions) error {
+	current, err := s.currentStatement(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return ErrStatementNotFound
+	}
+	opts.IfNotExists = false
+	if err := checkWritePrecondition(id, current, opts); err != nil {
+		return err
+	}
+	next, err := s.nextRevision(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := s.swapRevision(ctx, tx, current, next); err != nil {
+		return err
+	}
+	return s.deleteStatement(ctx, tx, id)
+}
+
+// nextRevision increments the store-wide revision. The counter row stays locked
+// until the transaction ends, so concurrent writes are numbered in commit
+// order.
+func (s *sqlStorage) nextRevision(ctx context.Context, tx *sql.Tx) (uint64, error) {
+	if _, err := tx.ExecContext(ctx, "UPDATE authz_revision SET revision = revision + 1"); err != nil {
+		return 0, fmt.Errorf("failed to increment revision: %w", err)
+	}
+	var revision int64
+	if err := tx.QueryRowContext(ctx, "SELECT revision FROM authz_revision").Scan(&revision); err != nil {
+		return 0, fmt.Errorf("failed to read revision: %w", err)
+	}
+	return uint64(revision), nil
+}
+
+// currentStatement returns the stored statement, nil if it does not exist.
+func (s *sqlStorage) currentStatement(ctx context.Context, tx *sql.Tx, id string) (*Statement, error) {
+	statements, err := s.loadStatements(ctx, tx, []string{id})
+	if err != nil || len(statements) == 0 {
+		return nil, err
+	}
+	return &statements[0], nil
+}
+
+// swapRevision moves the statement from its current revision to the next one,
+// failing with a ConflictError if another transaction changed it since it was
+// read.
+func (s *sqlStorage) swapRevision(ctx context.Context, tx *sql.Tx, current *Statement, next uint64) error {
+	res, err := tx.ExecContext(ctx,
+		fmt.Sprintf("UPDATE authz_statements SET revision = %s WHERE id = %s AND revision = %s",
+			s.dialect.placeholders(1, 1), s.dialect.placeholders(2, 1), s.dialect.placeholders(3, 1)),
+		int64(next), current.ID, int64(current.Revision),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update statement %q: %w", current.ID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return &ConflictError{StatementID: current.ID, Expected: current.Revision}
+	}
+	return nil
+}
+
+func (s *sqlStorage) GetStatement(id string) (*Statement, error) {
+	statements, err := s.loadStatements(context.Background(), s.db, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(statements) == 0 {
+		return nil, ErrStatementNotFound
+	}
+	return &statements[0], nil
+}
+
+// List pages through the statements in ID order, as the column's collation
+// sorts them. The filter is applied to the loaded statements, reading up to
+// one page more than the limit at a time.
+func (s *sqlStorage) List(filter StatementFilter) (StatementPage, error) {
+	after, err := decodeStatementCursor(filter.Cursor)
+	if err != nil {
+		return StatementPage{}, err
+	}
+
+	// IDs are read in chunks of one more than the limit, which tells whether
+	// a next page exists, until the page is full or the table is exhausted.
+	ctx := context.Background()
+	limit := filter.limit()
+	var page StatementPage
+	for {
+		ids, err := s.queryStrings(ctx, s.db, fmt.Sprintf(
+			"SELECT id FROM authz_statements WHERE id > %s ORDER BY id LIMIT %d", s.dialect.placeholders(1, 1), limit+1), after)
+		if err != nil {
+			return StatementPage{}, fmt.Errorf("failed to list statements: %w", err)
+		}
+		statements, err := s.loadStatements(ctx, s.db, ids)
+		if err != nil {
+			return StatementPage{}, err
+		}
+		for _, stmt := range statements {
+			if !filter.Matches(stmt) {
+				continue
+			}
+			if len(page.Statements) == limit {
+				page.NextCursor = encodeStatementCursor(page.Statements[limit-1].ID)
+				return page, nil
+			}
+			page.Statements = append(page.Statements, stmt)
+		}
+		if len(ids) <= limit {
+			return page, nil
+		}
+		after = ids[len(ids)-1]
+	}
+}
+
+// ListStatementsByPrincipal narrows candidates in SQL by exact principal or by
+// the literal prefix of pattern principals, then applies glob matching to the
+// candidates.
+func (s *sqlStorage) ListStatementsByPrincipal(principal Principal) ([]Statement, error) {
+	ctx := context.Background()
+	prefixes := principalPrefixes(principal)
+	args := []any{string(principal)}
+	for _, prefix := range prefixes {
+		args = append(args, prefix)
+	}
+	query := fmt.Sprintf(
+		"SELECT DISTINCT statement_id FROM authz_statement_principals WHERE principal = %s OR literal_prefix IN (%s)",
+		s.dialect.placeholders(1, 1), s.dialect.placeholders(2, len(prefixes)),
+	)
+	ids, err := s.queryStrings(ctx, s.db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := s.loadStatements(ctx, s.db, ids)
+	if err != nil {
+		return nil, err
+	}
+	var result []Statement
+	for _, stmt := range candidates {
+		if principalMatches(stmt.Principals, principal) {
+			result = append(result, stmt)
+		}
+	}
+	return result, nil
+}
+
+func (s *sqlStorage) insertStatement(ctx context.Context, tx *sql.Tx, stmt Statement) error {
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO authz_statements (id, active, name, description, effect, created_at, updated_at, created_by, updated_by, revision) VALUES ("+s.dialect.placeholders(1, 10)+")",
+		stmt.ID, stmt.Active, stmt.Name, stmt.Description, string(stmt.Effect),
+		stmt.CreatedAt.UTC(), stmt.UpdatedAt.UTC(), stmt.CreatedBy, stmt.UpdatedBy, int64(stmt.Revision),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert statement %q: %w", stmt.ID, err)
+	}
+
+	for i, p := range stmt.Principals {
+		var prefix any
+		if literal, isPattern := literalPrefix(string(p)); isPattern {
+			prefix = literal
+		}
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO authz_statement_principals (statement_id, ordinal, principal, literal_prefix) VALUES ("+s.dialect.placeholders(1, 4)+")",
+			stmt.ID, i, string(p), prefix,
+		); err != nil {
+			return fmt.Errorf("failed to insert principal for statement %q: %w", stmt.ID, err)
+		}
+	}
+	for i, a := range stmt.Actions {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO authz_statement_actions (statement_id, ordinal, action) VALUES ("+s.dialect.placeholders(1, 3)+")",
+			stmt.ID, i, string(a),
+		); err != nil {
+			return fmt.Errorf("failed to insert action for statement %q: %w", stmt.ID, err)
+		}
+	}
+	for i, r := range stmt.Resources {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO authz_statement_resources (statement_id, ordinal, resource) VALUES ("+s.dialect.placeholders(1, 3)+")",
+			stmt.ID, i, string(r),
+		); err != nil {
+			return fmt.Errorf("failed to insert resource for statement %q: %w", stmt.ID, err)
+		}
+	}
+	for i, c := range stmt.Conditions {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO authz_statement_conditions (statement_id, ordinal, name, expression) VALUES ("+s.dialect.placeholders(1, 4)+")",
+			stmt.ID, i, c.Name, c.Expression,
+		); err != nil {
+			return fmt.Errorf("failed to insert condition for statement %q: %w", stmt.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *sqlStorage) deleteStatement(ctx context.Context, tx *sql.Tx, id string) error {
+	// Child rows are removed explicitly rather than relying on ON DELETE
+	// CASCADE, which not every engine enforces.
+	for _, table := range []string{
+		"authz_statement_principals",
+		"authz_statement_actions",
+		"authz_statement_resources",
+		"authz_statement_conditions",
+	} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE statement_id = "+s.dialect.placeholders(1, 1), id); err != nil {
+			return fmt.Errorf("failed to delete statement %q: %w", id, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM authz_statements WHERE id = "+s.dialect.placeholders(1, 1), id); err != nil {
+		return fmt.Errorf("failed to delete statement %q: %w", id, err)
+	}
+	return nil
+}
+
+// loadStatements fetches the statements with the given IDs, ordered by ID,
+// together with their principals, actions, resources and conditions.
+func (s *sqlStorage) loadStatements(ctx context.Context, q sqlQueryer, ids []string) ([]Statement, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	in := s.dialect.placeholders(1, len(ids))
+
+	rows, err := q.QueryContext(ctx,
+		"SELECT id, active, name, description, effect, created_at, updated_at, created_by, updated_by, revision FROM authz_statements WHERE id IN ("+in+") ORDER BY id",
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query statements: %w", err)
+	}
+	var statements []Statement
+	index := make(map[string]int, len(ids))
+	for rows.Next() {
+		var stmt Statement
+		var effect string
+		var revision int64
+		if err := rows.Scan(&stmt.ID, &stmt.Active, &stmt.Name, &stmt.Description, &effect,
+			&stmt.CreatedAt, &stmt.UpdatedAt, &stmt.CreatedBy, &stmt.UpdatedBy, &revision); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan statement: %w", err)
+		}
+		stmt.Effect = Effect(effect)
+		stmt.Revision = uint64(revision)
+		index[stmt.ID] = len(statements)
+		statements = append(statements, stmt)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query statements: %w", err)
+	}
+
+	children := []struct {
+		query string
+		add   func(stmt *Statement, values []string)
+	}{
+		{
+			"SELECT statement_id, principal FROM authz_statement_principals",
+			func(stmt *Statement, v []string) { stmt.Principals = append(stmt.Principals, Principal(v[0])) },
+		},
+		{
+			"SELECT statement_id, action FROM authz_statement_actions",
+			func(stmt *Statement, v []string) { stmt.Actions = append(stmt.Actions, ActionID(v[0])) },
+		},
+		{
+			"SELECT statement_id, resource FROM authz_statement_resources",
+			func(stmt *Statement, v []string) { stmt.Resources = append(stmt.Resources, Resource(v[0])) },
+		},
+		{
+			"SELECT statement_id, name, expression FROM authz_statement_conditions",
+			func(stmt *Statement, v []string) {
+				stmt.Conditions = append(stmt.Conditions, Condition{Name: v[0], Expression: v[1]})
+			},
+		},
+	}
+	for _, child := range children {
+		rows, err := q.QueryContext(ctx, child.query+" WHERE statement_id IN ("+in+") ORDER BY statement_id, ordinal", args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query statements: %w", err)
+		}
+		columns, _ := rows.Columns()
+		values := make([]string, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		for rows.Next() {
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan statement: %w", err)
+			}
+			if i, ok := index[values[0]]; ok {
+				child.add(&statements[i], values[1:])
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to query statements: %w", err)
+		}
+	}
+	return statements, nil
+}
+
+func (s *sqlStorage) queryStrings(ctx context.Context, q sqlQueryer, query string, args ...any) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqlStorage) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqlStateError is implemented by the errors of the PostgreSQL drivers.
+type sqlStateError interface {
+	SQLState() string
+}
+
+// isUniqueViolation reports whether err is a unique or primary key violation.
+func isUniqueViolation(err error) bool {
+	var state sqlStateError
+	if errors.As(err, &state) {
+		return state.SQLState() == "23505"
+	}
+	// The MySQL driver reports ER_DUP_ENTRY without a SQLState method.
+	return strings.Contains(err.Error(), "Error 1062")
+}
+
+// literalPrefix returns the part of a glob pattern before its first meta
+// character, and whether the pattern contains any meta character at all.
+func literalPrefix(pattern string) (string, bool) {
+	i := strings.IndexAny(pattern, `*?[{\`)
+	if i < 0 {
+		return pattern, false
+	}
+	return pattern[:i], true
+}
+
+// principalPrefixes returns every prefix of the principal, including the empty
+// string and the principal itself, cut on rune boundaries.
+func principalPrefixes(principal Principal) []string {
+	s := string(principal)
+	prefixes := make([]string, 0, len(s)+1)
+	for i := range s {
+		prefixes = append(prefixes, s[:i])
+	}
+	return append(prefixes, s)
+}
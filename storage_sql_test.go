@@ -0,0 +1,700 @@
+package authorization
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLStorage_Migrate(t *testing.T) {
+	forEachSQLDialect(t, func(t *testing.T, dialect SQLDialect) {
+		db := openFakeDB(t, dialect)
+		storage := NewSQLStorage(db, dialect)
+
+		require.NoError(t, storage.Migrate(t.Context()))
+		// Running the migrations again must be a no-op.
+		require.NoError(t, storage.Migrate(t.Context()))
+
+		var versions []string
+		rows, err := db.Query("SELECT version FROM authz_schema_migrations ORDER BY version")
+		require.NoError(t, err)
+		defer rows.Close()
+		for rows.Next() {
+			var version string
+			require.NoError(t, rows.Scan(&version))
+			versions = append(versions, version)
+		}
+		assert.Equal(t, []string{"0001_create_statements", "0002_add_statement_revision", "0003_add_store_revision"}, versions)
+	})
+}
+
+func TestSQLStorage_SaveGetDelete(t *testing.T) {
+	forEachSQLDialect(t, func(t *testing.T, dialect SQLDialect) {
+		storage := newMigratedSQLStorage(t, dialect)
+		now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+		storage.now = func() time.Time { return now }
+
+		stmt := Statement{
+			ID:          "allow-read",
+			Active:      true,
+			Name:        "Allow read",
+			Description: "Allows reading documents",
+			Effect:      EffectAllow,
+			Principals:  []Principal{"users/mark", "roles/*"},
+			Actions:     []ActionID{"documents:read", "documents:list"},
+			Resources:   []Resource{"documents/**"},
+			Conditions:  []Condition{{Name: "IsLocal", Expression: `context.Request.IP == "127.0.0.1"`}},
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			CreatedBy:   "users/admin",
+			UpdatedBy:   "users/admin",
+		}
+		require.NoError(t, storage.SaveStatement(stmt))
+
+		got, err := storage.GetStatement("allow-read")
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		stmt.Revision = 1
+		assert.Equal(t, stmt, *got)
+
+		// Saving again replaces the statement and all of its lists.
+		now = now.Add(time.Hour)
+		stmt.Principals = []Principal{"users/alice"}
+		stmt.Conditions = nil
+		require.NoError(t, storage.SaveStatement(stmt))
+		got, err = storage.GetStatement("allow-read")
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		stmt.Revision = 2
+		stmt.UpdatedAt = now
+		assert.Equal(t, stmt, *got)
+
+		require.NoError(t, storage.DeleteStatement("allow-read"))
+		_, err = storage.GetStatement("allow-read")
+		assert.ErrorIs(t, err, ErrStatementNotFound)
+		assert.ErrorIs(t, storage.DeleteStatement("allow-read"), ErrStatementNotFound)
+	})
+}
+
+func TestSQLStorage_ConditionalWrites(t *testing.T) {
+	forEachSQLDialect(t, func(t *testing.T, dialect SQLDialect) {
+		storage := newMigratedSQLStorage(t, dialect)
+
+		created, err := storage.SaveStatementWithOptions(Statement{ID: "a", Effect: EffectAllow}, WriteOptions{Actor: "users/alice", IfNotExists: true})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), created.Revision)
+		assert.Equal(t, "users/alice", created.CreatedBy)
+
+		_, err = storage.SaveStatementWithOptions(Statement{ID: "a", Effect: EffectAllow}, WriteOptions{IfNotExists: true})
+		assert.ErrorIs(t, err, ErrConflict)
+
+		updated, err := storage.SaveStatementWithOptions(created, WriteOptions{Actor: "users/bob", IfMatch: created.Revision})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), updated.Revision)
+		assert.Equal(t, "users/alice", updated.CreatedBy)
+		assert.Equal(t, "users/bob", updated.UpdatedBy)
+
+		_, err = storage.SaveStatementWithOptions(created, WriteOptions{IfMatch: created.Revision})
+		var conflict *ConflictError
+		require.ErrorAs(t, err, &conflict)
+		assert.Equal(t, uint64(2), conflict.Actual)
+
+		assert.ErrorIs(t, storage.DeleteStatementWithOptions("a", WriteOptions{IfMatch: 1}), ErrConflict)
+		require.NoError(t, storage.DeleteStatementWithOptions("a", WriteOptions{IfMatch: 2}))
+		assert.ErrorIs(t, storage.DeleteStatementWithOptions("a", WriteOptions{}), ErrStatementNotFound)
+	})
+}
+
+func TestSQLStorage_CreateRace(t *testing.T) {
+	forEachSQLDialect(t, func(t *testing.T, dialect SQLDialect) {
+		storage := newMigratedSQLStorage(t, dialect)
+		// Another writer commits the statement after this one found it missing.
+		fakeDBFor(t).beforeInsert = func(table string) {
+			if table == "authz_statements" {
+				fakeDBFor(t).tables[table] = append(fakeDBFor(t).tables[table], map[string]driver.Value{"id": "a"})
+			}
+		}
+
+		_, err := storage.SaveStatementWithOptions(Statement{ID: "a", Effect: EffectAllow}, WriteOptions{IfNotExists: true})
+		var conflict *ConflictError
+		require.ErrorAs(t, err, &conflict)
+		assert.Equal(t, "a", conflict.StatementID)
+		assert.Equal(t, `statement "a" was created concurrently`, conflict.Error())
+	})
+}
+
+func TestSQLStorage_ListReadsBoundedChunks(t *testing.T) {
+	forEachSQLDialect(t, func(t *testing.T, dialect SQLDialect) {
+		storage := newMigratedSQLStorage(t, dialect)
+		for i := range 30 {
+			effect := EffectAllow
+			if i == 29 {
+				effect = EffectDeny
+			}
+			require.NoError(t, storage.SaveStatement(Statement{ID: fmt.Sprintf("stmt-%02d", i), Effect: effect}))
+		}
+		var chunks []int
+		fakeDBFor(t).afterSelect = func(query string, rows int) {
+			if strings.HasPrefix(query, "SELECT id FROM authz_statements WHERE id >") {
+				chunks = append(chunks, rows)
+			}
+		}
+
+		page, err := storage.List(StatementFilter{Limit: 5})
+		require.NoError(t, err)
+		assert.Len(t, page.Statements, 5)
+		assert.NotEmpty(t, page.NextCursor)
+		assert.Equal(t, []int{6}, chunks)
+
+		// The filter drops most rows, so chunks are read until the table ends.
+		chunks = nil
+		page, err = storage.List(StatementFilter{Effect: EffectDeny, Limit: 5})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"stmt-29"}, statementIDs(page.Statements))
+		assert.Empty(t, page.NextCursor)
+		assert.Equal(t, []int{6, 6, 6, 6, 6, 0}, chunks)
+	})
+}
+
+func TestSQLStorage_ApplyBatch(t *testing.T) {
+	forEachSQLDialect(t, func(t *testing.T, dialect SQLDialect) {
+		storage := newMigratedSQLStorage(t, dialect)
+		require.NoError(t, storage.SaveStatement(Statement{ID: "old", Effect: EffectAllow, Principals: []Principal{"users/mark"}}))
+
+		err := storage.ApplyBatch([]BatchOperation{
+			BatchPut(Statement{ID: "new", Effect: EffectAllow, Principals: []Principal{"users/mark"}}, WriteOptions{}),
+			BatchDelete("old", WriteOptions{IfMatch: 7}),
+		})
+		var batchErr *BatchError
+		require.ErrorAs(t, err, &batchErr)
+		assert.Equal(t, 1, batchErr.Index)
+		assert.ErrorIs(t, err, ErrConflict)
+
+		statements, err := storage.ListStatementsByPrincipal("users/mark")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"old"}, statementIDs(statements), "failed batch must be rolled back")
+
+		require.NoError(t, storage.ApplyBatch([]BatchOperation{
+			BatchPut(Statement{ID: "new", Effect: EffectAllow, Principals: []Principal{"users/mark"}}, WriteOptions{}),
+			BatchDelete("old", WriteOptions{IfMatch: 1}),
+		}))
+		statements, err = storage.ListStatementsByPrincipal("users/mark")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"new"}, statementIDs(statements))
+	})
+}
+
+func TestSQLStorage_Evaluator(t *testing.T) {
+	forEachSQLDialect(t, func(t *testing.T, dialect SQLDialect) {
+		storage := newMigratedSQLStorage(t, dialect)
+		require.NoError(t, storage.SaveStatement(Statement{
+			ID: "allow-read", Effect: EffectAllow,
+			Principals: []Principal{"users/*"}, Actions: []ActionID{"documents:read"}, Resources: []Resource{"documents/*"},
+		}))
+		require.NoError(t, storage.SaveStatement(Statement{
+			ID: "deny-secret", Effect: EffectDeny,
+			Principals: []Principal{"users/mark"}, Actions: []ActionID{"*"}, Resources: []Resource{"documents/secret"},
+		}))
+
+		evaluator := NewEvaluator(storage)
+
+		resp, err := evaluator.Evaluate(Request{Principal: "users/mark", Action: "documents:read", Resource: "documents/public"})
+		require.NoError(t, err)
+		assert.Equal(t, EffectAllow, resp.Effect)
+
+		resp, err = evaluator.Evaluate(Request{Principal: "users/mark", Action: "documents:read", Resource: "documents/secret"})
+		require.NoError(t, err)
+		assert.Equal(t, EffectDeny, resp.Effect)
+		assert.Equal(t, `denied by statement "deny-secret"`, resp.Message)
+	})
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "postgres", err: fakeUniqueViolation{id: "a"}, want: true},
+		{name: "mysql", err: fakeDuplicateEntry{id: "a"}, want: true},
+		{name: "wrapped", err: fmt.Errorf("failed to insert statement: %w", fakeDuplicateEntry{id: "a"}), want: true},
+		{name: "other sqlstate", err: fakeSQLStateError("23503"), want: false},
+		{name: "other error", err: errors.New("Error 1452 (23000): Cannot add or update a child row"), want: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, isUniqueViolation(tc.err))
+		})
+	}
+}
+
+type fakeSQLStateError string
+
+func (e fakeSQLStateError) Error() string    { return "sqlstate " + string(e) }
+func (e fakeSQLStateError) SQLState() string { return string(e) }
+
+func TestSQLDialect_Placeholders(t *testing.T) {
+	assert.Equal(t, "$3, $4, $5", SQLDialectPostgres.placeholders(3, 3))
+	assert.Equal(t, "?, ?", SQLDialectMySQL.placeholders(3, 2))
+}
+
+// forEachSQLDialect runs the test against the fake database of every SQL
+// dialect.
+func forEachSQLDialect(t *testing.T, test func(t *testing.T, dialect SQLDialect)) {
+	for _, dialect := range []SQLDialect{SQLDialectMySQL, SQLDialectPostgres} {
+		t.Run(string(dialect), func(t *testing.T) {
+			test(t, dialect)
+		})
+	}
+}
+
+func newMigratedSQLStorage(t *testing.T, dialect SQLDialect) *sqlStorage {
+	t.Helper()
+	storage := NewSQLStorage(openFakeDB(t, dialect), dialect)
+	require.NoError(t, storage.Migrate(t.Context()))
+	return storage
+}
+
+func statementIDs(statements []Statement) []string {
+	ids := make([]string, len(statements))
+	for i, s := range statements {
+		ids[i] = s.ID
+	}
+	return ids
+}
+
+// The fake SQL driver below is an in-process stand-in for a database server.
+// It speaks the placeholders and duplicate key errors of the dialect it is
+// opened with, and understands exactly the narrow subset of SQL issued by
+// sqlStorage: CREATE TABLE/INDEX, INSERT, DELETE with a single equality,
+// UPDATE with a compare and swap or an increment, and SELECT with
+// equality/IN/greater-than terms joined by OR plus ORDER BY and LIMIT.
+
+var (
+	registerFakeDriver sync.Once
+	fakeSQLDriver      = &fakeDriver{dbs: make(map[string]*fakeDB)}
+)
+
+func openFakeDB(t *testing.T, dialect SQLDialect) *sql.DB {
+	t.Helper()
+	registerFakeDriver.Do(func() {
+		sql.Register("authz-fake", fakeSQLDriver)
+	})
+	db, err := sql.Open("authz-fake", string(dialect)+":"+t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+		fakeSQLDriver.mu.Lock()
+		delete(fakeSQLDriver.dbs, t.Name())
+		fakeSQLDriver.mu.Unlock()
+	})
+	return db
+}
+
+type fakeDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*fakeDB
+}
+
+func (d *fakeDriver) Open(dsn string) (driver.Conn, error) {
+	dialect, name, _ := strings.Cut(dsn, ":")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	db, ok := d.dbs[name]
+	if !ok {
+		db = &fakeDB{dialect: SQLDialect(dialect), tables: make(map[string][]map[string]driver.Value)}
+		d.dbs[name] = db
+	}
+	return &fakeConn{db: db}, nil
+}
+
+type fakeDB struct {
+	dialect SQLDialect
+	mu      sync.Mutex
+	tables  map[string][]map[string]driver.Value
+	// txMu serializes transactions, so rolling back to the snapshot taken
+	// at Begin cannot undo the writes of another transaction.
+	txMu sync.Mutex
+	// beforeInsert, if set, is called with mu held before every INSERT.
+	beforeInsert func(table string)
+	// afterSelect, if set, is called with mu held with the number of rows
+	// returned by every SELECT.
+	afterSelect func(query string, rows int)
+}
+
+// fakeDBFor returns the database opened by openFakeDB for the test.
+func fakeDBFor(t *testing.T) *fakeDB {
+	fakeSQLDriver.mu.Lock()
+	defer fakeSQLDriver.mu.Unlock()
+	return fakeSQLDriver.dbs[t.Name()]
+}
+
+// fakeUniqueViolation is returned for rows duplicating the id of another row
+// in PostgreSQL, with its SQLSTATE.
+type fakeUniqueViolation struct{ id driver.Value }
+
+func (e fakeUniqueViolation) Error() string    { return fmt.Sprintf("duplicate key %v", e.id) }
+func (e fakeUniqueViolation) SQLState() string { return "23505" }
+
+// fakeDuplicateEntry is returned for rows duplicating the id of another row
+// in MySQL, which reports ER_DUP_ENTRY by number only.
+type fakeDuplicateEntry struct{ id driver.Value }
+
+func (e fakeDuplicateEntry) Error() string {
+	return fmt.Sprintf("Error 1062 (23000): Duplicate entry '%v' for key 'PRIMARY'", e.id)
+}
+
+func (db *fakeDB) uniqueViolation(id driver.Value) error {
+	if db.dialect == SQLDialectPostgres {
+		return fakeUniqueViolation{id: id}
+	}
+	return fakeDuplicateEntry{id: id}
+}
+
+type fakeConn struct {
+	db       *fakeDB
+	snapshot map[string][]map[string]driver.Value
+}
+
+var fakePositionalRe = regexp.MustCompile(`\$(\d+)`)
+
+// Prepare rewrites PostgreSQL's positional parameters to "?", remembering
+// their numbers, and rejects the placeholders of the other dialect.
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	stmt := &fakeStmt{conn: c, query: strings.Join(strings.Fields(query), " ")}
+	if c.db.dialect != SQLDialectPostgres {
+		if fakePositionalRe.MatchString(stmt.query) {
+			return nil, fmt.Errorf("%s does not support positional parameters: %q", c.db.dialect, query)
+		}
+		return stmt, nil
+	}
+	if strings.Contains(stmt.query, "?") {
+		return nil, fmt.Errorf("postgres does not support ? parameters: %q", query)
+	}
+	stmt.query = fakePositionalRe.ReplaceAllStringFunc(stmt.query, func(param string) string {
+		var n int
+		fmt.Sscan(param[1:], &n)
+		stmt.positions = append(stmt.positions, n-1)
+		return "?"
+	})
+	return stmt, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.txMu.Lock()
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.snapshot = make(map[string][]map[string]driver.Value, len(c.db.tables))
+	for name, rows := range c.db.tables {
+		copied := make([]map[string]driver.Value, len(rows))
+		for i, row := range rows {
+			copied[i] = maps.Clone(row)
+		}
+		c.snapshot[name] = copied
+	}
+	return &fakeTx{conn: c}, nil
+}
+
+type fakeTx struct{ conn *fakeConn }
+
+func (tx *fakeTx) Commit() error {
+	tx.conn.snapshot = nil
+	tx.conn.db.txMu.Unlock()
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.conn.db.mu.Lock()
+	defer tx.conn.db.mu.Unlock()
+	tx.conn.db.tables = tx.conn.snapshot
+	tx.conn.snapshot = nil
+	tx.conn.db.txMu.Unlock()
+	return nil
+}
+
+var (
+	fakeCreateTableRe = regexp.MustCompile(`^CREATE TABLE (IF NOT EXISTS )?(\w+)`)
+	fakeCreateIndexRe = regexp.MustCompile(`^CREATE (UNIQUE )?INDEX `)
+	fakeInsertRe      = regexp.MustCompile(`^INSERT INTO (\w+) \(([^)]*)\) VALUES \(([^)]*)\)$`)
+	fakeDeleteRe      = regexp.MustCompile(`^DELETE FROM (\w+) WHERE (\w+) = \?$`)
+	fakeAlterTableRe  = regexp.MustCompile(`^ALTER TABLE (\w+) ADD COLUMN (\w+) .* DEFAULT (\d+)$`)
+	fakeIncrementRe   = regexp.MustCompile(`^UPDATE (\w+) SET (\w+) = (\w+) \+ 1$`)
+	fakeInsertMaxRe   = regexp.MustCompile(`^INSERT INTO (\w+) \((\w+)\) SELECT COALESCE\(MAX\((\w+)\), 0\) FROM (\w+)$`)
+	fakeUpdateRe      = regexp.MustCompile(`^UPDATE (\w+) SET (\w+) = \? WHERE (\w+) = \? AND (\w+) = \?$`)
+	fakeSelectRe      = regexp.MustCompile(`^SELECT (DISTINCT )?(.+?) FROM (\w+)(?: WHERE (.+?))?(?: ORDER BY (.+?))?(?: LIMIT (\d+))?$`)
+	fakeEqualsRe      = regexp.MustCompile(`^(\w+) = \?$`)
+	fakeGreaterRe     = regexp.MustCompile(`^(\w+) > \?$`)
+	fakeInRe          = regexp.MustCompile(`^(\w+) IN \(([?, ]*)\)$`)
+)
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+	// positions holds the argument index of every "?" rewritten from a
+	// positional parameter.
+	positions []int
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+// bind orders args as the "?" placeholders of the rewritten query.
+func (s *fakeStmt) bind(args []driver.Value) ([]driver.Value, error) {
+	if s.positions == nil {
+		return args, nil
+	}
+	bound := make([]driver.Value, len(s.positions))
+	for i, position := range s.positions {
+		if position < 0 || position >= len(args) {
+			return nil, fmt.Errorf("parameter $%d out of range", position+1)
+		}
+		bound[i] = args[position]
+	}
+	return bound, nil
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	args, err := s.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	db := s.conn.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if m := fakeCreateTableRe.FindStringSubmatch(s.query); m != nil {
+		if _, exists := db.tables[m[2]]; exists {
+			if m[1] != "" {
+				return driver.RowsAffected(0), nil
+			}
+			return nil, fmt.Errorf("table %s already exists", m[2])
+		}
+		db.tables[m[2]] = nil
+		return driver.RowsAffected(0), nil
+	}
+	if fakeCreateIndexRe.MatchString(s.query) {
+		return driver.RowsAffected(0), nil
+	}
+	if m := fakeAlterTableRe.FindStringSubmatch(s.query); m != nil {
+		var value int64
+		fmt.Sscan(m[3], &value)
+		for _, row := range db.tables[m[1]] {
+			row[m[2]] = value
+		}
+		return driver.RowsAffected(0), nil
+	}
+	if m := fakeIncrementRe.FindStringSubmatch(s.query); m != nil && m[2] == m[3] {
+		for _, row := range db.tables[m[1]] {
+			row[m[2]] = row[m[2]].(int64) + 1
+		}
+		return driver.RowsAffected(len(db.tables[m[1]])), nil
+	}
+	if m := fakeInsertMaxRe.FindStringSubmatch(s.query); m != nil {
+		var max int64
+		for _, row := range db.tables[m[4]] {
+			if v, ok := row[m[3]].(int64); ok && v > max {
+				max = v
+			}
+		}
+		db.tables[m[1]] = append(db.tables[m[1]], map[string]driver.Value{m[2]: max})
+		return driver.RowsAffected(1), nil
+	}
+	if m := fakeUpdateRe.FindStringSubmatch(s.query); m != nil {
+		var n int64
+		for _, row := range db.tables[m[1]] {
+			if row[m[3]] == args[1] && row[m[4]] == args[2] {
+				row[m[2]] = args[0]
+				n++
+			}
+		}
+		return driver.RowsAffected(n), nil
+	}
+	if m := fakeInsertRe.FindStringSubmatch(s.query); m != nil {
+		rows, ok := db.tables[m[1]]
+		if !ok {
+			return nil, fmt.Errorf("no such table: %s", m[1])
+		}
+		columns := splitFakeList(m[2])
+		if len(columns) != len(args) {
+			return nil, fmt.Errorf("expected %d arguments, got %d", len(columns), len(args))
+		}
+		if db.beforeInsert != nil {
+			db.beforeInsert(m[1])
+			rows = db.tables[m[1]]
+		}
+		row := make(map[string]driver.Value, len(columns))
+		for i, c := range columns {
+			row[c] = args[i]
+		}
+		for _, existing := range rows {
+			if id, ok := row["id"]; ok && existing["id"] == id {
+				return nil, db.uniqueViolation(id)
+			}
+		}
+		db.tables[m[1]] = append(rows, row)
+		return driver.RowsAffected(1), nil
+	}
+	if m := fakeDeleteRe.FindStringSubmatch(s.query); m != nil {
+		rows, ok := db.tables[m[1]]
+		if !ok {
+			return nil, fmt.Errorf("no such table: %s", m[1])
+		}
+		var kept []map[string]driver.Value
+		for _, row := range rows {
+			if row[m[2]] != args[0] {
+				kept = append(kept, row)
+			}
+		}
+		db.tables[m[1]] = kept
+		return driver.RowsAffected(int64(len(rows) - len(kept))), nil
+	}
+	return nil, fmt.Errorf("fake driver cannot execute %q", s.query)
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	args, err := s.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	db := s.conn.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	m := fakeSelectRe.FindStringSubmatch(s.query)
+	if m == nil {
+		return nil, fmt.Errorf("fake driver cannot query %q", s.query)
+	}
+	rows, ok := db.tables[m[3]]
+	if !ok {
+		return nil, fmt.Errorf("no such table: %s", m[3])
+	}
+	columns := splitFakeList(m[2])
+
+	match := func(map[string]driver.Value) bool { return true }
+	if m[4] != "" {
+		var terms []func(map[string]driver.Value) bool
+		for _, term := range strings.Split(m[4], " OR ") {
+			if eq := fakeEqualsRe.FindStringSubmatch(term); eq != nil {
+				column, value := eq[1], args[0]
+				args = args[1:]
+				terms = append(terms, func(row map[string]driver.Value) bool {
+					return row[column] != nil && row[column] == value
+				})
+			} else if gt := fakeGreaterRe.FindStringSubmatch(term); gt != nil {
+				column, value := gt[1], args[0]
+				args = args[1:]
+				terms = append(terms, func(row map[string]driver.Value) bool {
+					return row[column] != nil && fmt.Sprint(row[column]) > fmt.Sprint(value)
+				})
+			} else if in := fakeInRe.FindStringSubmatch(term); in != nil {
+				column, n := in[1], len(splitFakeList(in[2]))
+				values := args[:n]
+				args = args[n:]
+				terms = append(terms, func(row map[string]driver.Value) bool {
+					for _, v := range values {
+						if row[column] != nil && row[column] == v {
+							return true
+						}
+					}
+					return false
+				})
+			} else {
+				return nil, fmt.Errorf("fake driver cannot filter on %q", term)
+			}
+		}
+		match = func(row map[string]driver.Value) bool {
+			for _, term := range terms {
+				if term(row) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	var selected []map[string]driver.Value
+	for _, row := range rows {
+		if match(row) {
+			selected = append(selected, row)
+		}
+	}
+	if m[5] != "" {
+		order := splitFakeList(m[5])
+		sort.SliceStable(selected, func(i, j int) bool {
+			for _, c := range order {
+				a, b := fmt.Sprint(selected[i][c]), fmt.Sprint(selected[j][c])
+				if ai, ok := selected[i][c].(int64); ok {
+					a, b = fmt.Sprintf("%020d", ai), fmt.Sprintf("%020d", selected[j][c].(int64))
+				}
+				if a != b {
+					return a < b
+				}
+			}
+			return false
+		})
+	}
+
+	result := &fakeRows{columns: columns}
+	seen := make(map[string]bool)
+	for _, row := range selected {
+		values := make([]driver.Value, len(columns))
+		for i, c := range columns {
+			values[i] = row[c]
+		}
+		if m[1] != "" {
+			key := fmt.Sprint(values)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		result.rows = append(result.rows, values)
+	}
+	if m[6] != "" {
+		var limit int
+		fmt.Sscan(m[6], &limit)
+		result.rows = result.rows[:min(len(result.rows), limit)]
+	}
+	if db.afterSelect != nil {
+		db.afterSelect(s.query, len(result.rows))
+	}
+	return result, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func splitFakeList(list string) []string {
+	parts := strings.Split(list, ",")
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+	}
+	return parts
+}
@@ -0,0 +1,205 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultTokenExpiryLeeway = 30 * time.Second
+
+// Token is a bearer token. A zero Expiry means the token does not expire.
+type Token struct {
+	AccessToken string
+	Expiry      time.Time
+}
+
+// TokenSource provides the bearer tokens of a remote authorizer, see
+// WithTokenSource.
+type TokenSource interface {
+	Token(ctx context.Context) (Token, error)
+}
+
+// tokenInvalidator is implemented by token sources that can drop a token the
+// server rejected, so the next call fetches a fresh one.
+type tokenInvalidator interface {
+	Invalidate(accessToken string)
+}
+
+// tokenFlight is a token fetch shared by concurrent callers.
+type tokenFlight struct {
+	done  chan struct{}
+	token Token
+	err   error
+}
+
+// cachingTokenSource caches a token until shortly before it expires and
+// fetches a new one once, however many callers need it at the same time.
+type cachingTokenSource struct {
+	fetch  func(ctx context.Context) (Token, error)
+	leeway time.Duration
+	now    func() time.Time
+
+	mu    sync.Mutex
+	token Token
+	// fetchedAt is when the cached token was requested.
+	fetchedAt time.Time
+	flight    *tokenFlight
+}
+
+// NewCachingTokenSource caches the tokens returned by fetch and refreshes them
+// expiryLeeway before they expire, 30s if zero. The leeway is capped at half
+// of a token's lifetime, so short-lived tokens are still cached.
+func NewCachingTokenSource(fetch func(ctx context.Context) (Token, error), expiryLeeway time.Duration) *cachingTokenSource {
+	if expiryLeeway <= 0 {
+		expiryLeeway = defaultTokenExpiryLeeway
+	}
+	return &cachingTokenSource{fetch: fetch, leeway: expiryLeeway, now: time.Now}
+}
+
+func (s *cachingTokenSource) Token(ctx context.Context) (Token, error) {
+	s.mu.Lock()
+	if s.valid() {
+		token := s.token
+		s.mu.Unlock()
+		return token, nil
+	}
+	flight := s.flight
+	if flight == nil {
+		flight = &tokenFlight{done: make(chan struct{})}
+		s.flight = flight
+		// Fetch detached from ctx, so a caller giving up does not fail the
+		// others waiting for the same token.
+		go s.refresh(context.WithoutCancel(ctx), flight)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-flight.done:
+		return flight.token, flight.err
+	case <-ctx.Done():
+		return Token{}, ctx.Err()
+	}
+}
+
+func (s *cachingTokenSource) refresh(ctx context.Context, flight *tokenFlight) {
+	fetchedAt := s.now()
+	flight.token, flight.err = s.fetch(ctx)
+	s.mu.Lock()
+	if flight.err == nil {
+		s.token = flight.token
+		s.fetchedAt = fetchedAt
+	}
+	s.flight = nil
+	s.mu.Unlock()
+	close(flight.done)
+}
+
+// Invalidate drops the cached token if it is accessToken, which the server
+// rejected. A token refreshed in the meantime is kept.
+func (s *cachingTokenSource) Invalidate(accessToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token.AccessToken == accessToken {
+		s.token = Token{}
+	}
+}
+
+func (s *cachingTokenSource) valid() bool {
+	if s.token.AccessToken == "" {
+		return false
+	}
+	if s.token.Expiry.IsZero() {
+		return true
+	}
+	leeway := min(s.leeway, s.token.Expiry.Sub(s.fetchedAt)/2)
+	return s.now().Before(s.token.Expiry.Add(-leeway))
+}
+
+// ClientCredentialsConfig configures the OAuth2 client credentials grant.
+type ClientCredentialsConfig struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// EndpointParams are added to the token request, e.g. "audience".
+	EndpointParams url.Values
+	// HTTPClient sends the token requests. Defaults to a client with a 10s
+	// timeout.
+	HTTPClient *http.Client
+	// ExpiryLeeway refreshes tokens this long before they expire, 30s if zero,
+	// and at most half of their lifetime.
+	ExpiryLeeway time.Duration
+}
+
+// NewClientCredentialsTokenSource fetches tokens from an OAuth2 token endpoint
+// with the client credentials grant and caches them until shortly before
+// they expire.
+func NewClientCredentialsTokenSource(config ClientCredentialsConfig) *cachingTokenSource {
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: defaultRemoteTimeout}
+	}
+	source := NewCachingTokenSource(nil, config.ExpiryLeeway)
+	source.fetch = func(ctx context.Context) (Token, error) {
+		return fetchClientCredentialsToken(ctx, config, source.now)
+	}
+	return source
+}
+
+func fetchClientCredentialsToken(ctx context.Context, config ClientCredentialsConfig, now func() time.Time) (Token, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(config.Scopes) > 0 {
+		form.Set("scope", strings.Join(config.Scopes, " "))
+	}
+	for key, values := range config.EndpointParams {
+		form[key] = values
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(config.ClientSecret))
+
+	resp, err := config.HTTPClient.Do(req)
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusOK {
+		if body.Error != "" {
+			return Token{}, fmt.Errorf("token request failed with status %s: %s %s", resp.Status, body.Error, body.ErrorDescription)
+		}
+		return Token{}, fmt.Errorf("token request failed with status %s", resp.Status)
+	}
+	if decodeErr != nil {
+		return Token{}, fmt.Errorf("failed to decode token response: %w", decodeErr)
+	}
+	if body.AccessToken == "" {
+		return Token{}, fmt.Errorf("token response has no access_token")
+	}
+	if body.TokenType != "" && !strings.EqualFold(body.TokenType, "bearer") {
+		return Token{}, fmt.Errorf("unsupported token type %q", body.TokenType)
+	}
+
+	token := Token{AccessToken: body.AccessToken}
+	if body.ExpiresIn > 0 {
+		token.Expiry = now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
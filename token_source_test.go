@@ -0,0 +1,188 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachingTokenSource(t *testing.T) {
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	var fetches atomic.Int32
+	source := NewCachingTokenSource(func(ctx context.Context) (Token, error) {
+		n := fetches.Add(1)
+		return Token{AccessToken: fmt.Sprintf("token-%d", n), Expiry: now.Add(5 * time.Minute)}, nil
+	}, time.Minute)
+	source.now = func() time.Time { return now }
+
+	token, err := source.Token(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken)
+	token, err = source.Token(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken, "cached until shortly before expiry")
+
+	now = now.Add(4 * time.Minute)
+	token, err = source.Token(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token.AccessToken, "refreshed within the leeway")
+
+	source.Invalidate("token-1")
+	token, _ = source.Token(t.Context())
+	assert.Equal(t, "token-2", token.AccessToken, "invalidating an old token keeps the current one")
+	source.Invalidate("token-2")
+	token, _ = source.Token(t.Context())
+	assert.Equal(t, "token-3", token.AccessToken)
+}
+
+func TestCachingTokenSource_ShortLivedTokens(t *testing.T) {
+	now := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	var fetches atomic.Int32
+	source := NewCachingTokenSource(func(ctx context.Context) (Token, error) {
+		n := fetches.Add(1)
+		return Token{AccessToken: fmt.Sprintf("token-%d", n), Expiry: now.Add(20 * time.Second)}, nil
+	}, time.Minute)
+	source.now = func() time.Time { return now }
+
+	token, err := source.Token(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken)
+	now = now.Add(9 * time.Second)
+	token, err = source.Token(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken, "a leeway longer than the lifetime is capped at half of it")
+
+	now = now.Add(time.Second)
+	token, err = source.Token(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token.AccessToken)
+}
+
+func TestCachingTokenSource_SingleFlight(t *testing.T) {
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	source := NewCachingTokenSource(func(ctx context.Context) (Token, error) {
+		fetches.Add(1)
+		<-release
+		return Token{AccessToken: "token"}, nil
+	}, 0)
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 20)
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := source.Token(context.Background())
+			assert.NoError(t, err)
+			tokens[i] = token.AccessToken
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), fetches.Load())
+	for _, token := range tokens {
+		assert.Equal(t, "token", token)
+	}
+}
+
+func TestCachingTokenSource_Errors(t *testing.T) {
+	fail := true
+	source := NewCachingTokenSource(func(ctx context.Context) (Token, error) {
+		if fail {
+			return Token{}, errors.New("identity provider down")
+		}
+		return Token{AccessToken: "token"}, nil
+	}, 0)
+
+	_, err := source.Token(t.Context())
+	assert.ErrorContains(t, err, "identity provider down")
+	fail = false
+	token, err := source.Token(t.Context())
+	require.NoError(t, err, "errors are not cached")
+	assert.Equal(t, "token", token.AccessToken)
+}
+
+func TestClientCredentialsTokenSource(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		require.NoError(t, r.ParseForm())
+		clientID, secret, ok := r.BasicAuth()
+		if !ok || clientID != "billing" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client","error_description":"bad credentials"}`))
+			return
+		}
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "authz:evaluate authz:read", r.PostForm.Get("scope"))
+		assert.Equal(t, "https://authz.internal", r.PostForm.Get("audience"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"abc","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer server.Close()
+
+	config := ClientCredentialsConfig{
+		TokenURL:       server.URL,
+		ClientID:       "billing",
+		ClientSecret:   "s3cret",
+		Scopes:         []string{"authz:evaluate", "authz:read"},
+		EndpointParams: url.Values{"audience": {"https://authz.internal"}},
+	}
+	source := NewClientCredentialsTokenSource(config)
+	token, err := source.Token(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "abc", token.AccessToken)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), token.Expiry, time.Minute)
+	_, err = source.Token(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), requests.Load())
+
+	config.ClientSecret = "wrong"
+	_, err = NewClientCredentialsTokenSource(config).Token(t.Context())
+	assert.ErrorContains(t, err, "invalid_client bad credentials")
+}
+
+func TestRemoteAuthorizer_RefreshesTokenOnUnauthorized(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.Write([]byte(`{"effect":"allow"}`))
+	}))
+	defer server.Close()
+
+	var fetches atomic.Int32
+	source := NewCachingTokenSource(func(ctx context.Context) (Token, error) {
+		return Token{AccessToken: fmt.Sprintf("token-%d", fetches.Add(1))}, nil
+	}, 0)
+	authorizer := NewBetandbeatRemoteAuthorizer(server.URL, nil, WithTokenSource(source))
+
+	resp, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+	require.NoError(t, err)
+	assert.Equal(t, EffectAllow, resp.Effect)
+	assert.Equal(t, int32(2), calls.Load())
+
+	// A token that keeps being rejected is refreshed only once per request.
+	source.Invalidate("token-2")
+	calls.Store(0)
+	_, err = authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+	require.Error(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+}
@@ -0,0 +1,118 @@
+package authorization
+
+import (
+	"context"
+)
+
+// Names of the spans started by evaluators and authorizers.
+const (
+	SpanEvaluate          = "authz.evaluate"
+	SpanExpandingEvaluate = "authz.expanding_evaluate"
+	SpanListStatements    = "authz.storage.list_statements_by_principal"
+	SpanResolvePrincipals = "authz.resolve_principals"
+	SpanCondition         = "authz.condition"
+	SpanRemoteAuthorize   = "authz.remote.authorize"
+)
+
+// Tracer starts spans. The otelauthz package adapts an OpenTelemetry tracer,
+// NewInMemoryTracer records spans for tests.
+type Tracer interface {
+	// Start starts a span as a child of the span in ctx, if any, and returns
+	// a context carrying the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation.
+type Span interface {
+	SetAttribute(key string, value any)
+	RecordError(err error)
+	End()
+	// TraceParent returns the W3C traceparent header value identifying the
+	// span, or an empty string if it is not part of a valid trace.
+	TraceParent() string
+}
+
+// TracerOption attaches a Tracer. It is accepted by NewEvaluator,
+// NewExpandingEvaluator and NewBetandbeatRemoteAuthorizer.
+type TracerOption struct {
+	tracer Tracer
+}
+
+// WithTracer traces evaluations, storage calls, principal expansion, condition
+// evaluation and remote calls with tracer.
+func WithTracer(tracer Tracer) TracerOption {
+	return TracerOption{tracer: tracer}
+}
+
+func (o TracerOption) applyEvaluator(e *evaluator) {
+	e.tracer = o.tracer
+}
+
+func (o TracerOption) applyExpandingEvaluator(e *ExpandingEvaluator) {
+	e.tracer = o.tracer
+}
+
+func (o TracerOption) applyRemoteAuthorizer(r *remoteAuthorizer) {
+	r.tracer = o.tracer
+}
+
+// startSpan starts a span with tracer, or a no-op span if tracer is nil.
+func startSpan(ctx context.Context, tracer Tracer, name string) (context.Context, Span) {
+	if tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return tracer.Start(ctx, name)
+}
+
+func setRequestAttributes(span Span, req Request) {
+	span.SetAttribute("authz.principal", string(req.Principal))
+	span.SetAttribute("authz.action", string(req.Action))
+	span.SetAttribute("authz.resource", string(req.Resource))
+}
+
+func setResponseAttributes(span Span, resp Response, err error) {
+	if err != nil {
+		span.RecordError(err)
+		return
+	}
+	span.SetAttribute("authz.effect", string(resp.Effect))
+	if resp.Decider != nil {
+		span.SetAttribute("authz.decider", *resp.Decider)
+	}
+}
+
+// contextEvaluator is implemented by evaluators that continue the trace of
+// the evaluator wrapping them.
+type contextEvaluator interface {
+	evaluateContext(ctx context.Context, req Request) (Response, error)
+}
+
+// evaluateWithContext evaluates req with e, passing ctx on if e accepts it.
+func evaluateWithContext(ctx context.Context, e Evaluator, req Request) (Response, error) {
+	if ce, ok := e.(contextEvaluator); ok {
+		return ce.evaluateContext(ctx, req)
+	}
+	return e.Evaluate(req)
+}
+
+type traceParentKey struct{}
+
+// withTraceParent stores the traceparent header value for outgoing requests.
+func withTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, traceParentKey{}, traceParent)
+}
+
+func traceParentFromContext(ctx context.Context) string {
+	traceParent, _ := ctx.Value(traceParentKey{}).(string)
+	return traceParent
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value any) {}
+func (noopSpan) RecordError(err error)              {}
+func (noopSpan) End()                               {}
+func (noopSpan) TraceParent() string                { return "" }
@@ -0,0 +1,97 @@
+package authorization
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// RecordedSpan is a span finished by the in-memory tracer.
+type RecordedSpan struct {
+	Name         string
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Attributes   map[string]any
+	Err          error
+	Start        time.Time
+	End          time.Time
+}
+
+// inMemoryTracer records finished spans in memory, for tests.
+type inMemoryTracer struct {
+	mu    sync.Mutex
+	spans []RecordedSpan
+}
+
+// NewInMemoryTracer creates a Tracer that keeps every finished span.
+func NewInMemoryTracer() *inMemoryTracer {
+	return &inMemoryTracer{}
+}
+
+type inMemorySpanKey struct{}
+
+func (t *inMemoryTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &inMemorySpan{
+		tracer: t,
+		span: RecordedSpan{
+			Name:       name,
+			SpanID:     randomHex(8),
+			Attributes: make(map[string]any),
+			Start:      time.Now(),
+		},
+	}
+	if parent, ok := ctx.Value(inMemorySpanKey{}).(*inMemorySpan); ok {
+		span.span.TraceID = parent.span.TraceID
+		span.span.ParentSpanID = parent.span.SpanID
+	} else {
+		span.span.TraceID = randomHex(16)
+	}
+	return context.WithValue(ctx, inMemorySpanKey{}, span), span
+}
+
+// Spans returns the finished spans in the order they ended.
+func (t *inMemoryTracer) Spans() []RecordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]RecordedSpan(nil), t.spans...)
+}
+
+// Reset discards all recorded spans.
+func (t *inMemoryTracer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = nil
+}
+
+type inMemorySpan struct {
+	tracer *inMemoryTracer
+	span   RecordedSpan
+}
+
+func (s *inMemorySpan) SetAttribute(key string, value any) {
+	s.span.Attributes[key] = value
+}
+
+func (s *inMemorySpan) RecordError(err error) {
+	s.span.Err = err
+}
+
+func (s *inMemorySpan) End() {
+	s.span.End = time.Now()
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.spans = append(s.tracer.spans, s.span)
+}
+
+func (s *inMemorySpan) TraceParent() string {
+	return "00-" + s.span.TraceID + "-" + s.span.SpanID + "-01"
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
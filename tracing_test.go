@@ -0,0 +1,139 @@
+package authorization
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// spansByName indexes recorded spans by name, keeping the last of each.
+func spansByName(spans []RecordedSpan) map[string]RecordedSpan {
+	byName := make(map[string]RecordedSpan)
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	return byName
+}
+
+func TestEvaluator_Tracing(t *testing.T) {
+	storage := NewInMemoryStorage()
+	require.NoError(t, storage.SaveStatement(Statement{
+		ID: "allow-read", Effect: EffectAllow,
+		Principals: []Principal{"users/mark"}, Actions: []ActionID{"read"}, Resources: []Resource{"*"},
+		Conditions: []Condition{{Name: "from-office", Expression: `Context.Request.IP == "10.0.0.1"`}},
+	}))
+	tracer := NewInMemoryTracer()
+	evaluator := NewEvaluator(storage, WithTracer(tracer))
+
+	req := Request{Principal: "users/mark", Action: "read", Resource: "doc"}
+	req.Context.Request.IP = "10.0.0.1"
+	resp, err := evaluator.Evaluate(req)
+	require.NoError(t, err)
+	assert.Equal(t, EffectAllow, resp.Effect)
+
+	spans := spansByName(tracer.Spans())
+	require.Len(t, spans, 3)
+	root := spans[SpanEvaluate]
+	assert.Empty(t, root.ParentSpanID)
+	assert.Equal(t, "users/mark", root.Attributes["authz.principal"])
+	assert.Equal(t, "allow", root.Attributes["authz.effect"])
+	assert.Equal(t, "allow-read", root.Attributes["authz.decider"])
+
+	list := spans[SpanListStatements]
+	assert.Equal(t, root.SpanID, list.ParentSpanID)
+	assert.Equal(t, root.TraceID, list.TraceID)
+	assert.Equal(t, 1, list.Attributes["authz.statement_count"])
+
+	condition := spans[SpanCondition]
+	assert.Equal(t, root.SpanID, condition.ParentSpanID)
+	assert.Equal(t, "allow-read", condition.Attributes["authz.statement_id"])
+	assert.Equal(t, "from-office", condition.Attributes["authz.condition"])
+	assert.Equal(t, true, condition.Attributes["authz.condition_met"])
+}
+
+func TestEvaluator_TracingErrors(t *testing.T) {
+	tracer := NewInMemoryTracer()
+	evaluator := NewEvaluator(&mockStorage{listStatementsErr: assert.AnError}, WithTracer(tracer))
+
+	_, err := evaluator.Evaluate(Request{Principal: "users/mark"})
+	require.Error(t, err)
+
+	spans := spansByName(tracer.Spans())
+	assert.ErrorIs(t, spans[SpanListStatements].Err, assert.AnError)
+	assert.ErrorIs(t, spans[SpanEvaluate].Err, assert.AnError)
+}
+
+func TestExpandingEvaluator_Tracing(t *testing.T) {
+	storage := NewInMemoryStorage()
+	require.NoError(t, storage.SaveStatement(Statement{
+		ID: "allow-moderators", Effect: EffectAllow,
+		Principals: []Principal{"roles/moderator"}, Actions: []ActionID{"read"}, Resources: []Resource{"*"},
+	}))
+	resolver := NewInMemoryPrincipalResolver()
+	resolver.AddRoleMapping("users/mark", []Principal{"roles/moderator"})
+	tracer := NewInMemoryTracer()
+	evaluator := NewExpandingEvaluator(NewEvaluator(storage, WithTracer(tracer)), resolver, WithTracer(tracer))
+
+	_, err := evaluator.Evaluate(Request{Principal: "users/mark", Action: "read", Resource: "doc"})
+	require.NoError(t, err)
+
+	var root RecordedSpan
+	counts := make(map[string]int)
+	for _, span := range tracer.Spans() {
+		counts[span.Name]++
+		if span.Name == SpanExpandingEvaluate {
+			root = span
+		}
+	}
+	assert.Equal(t, map[string]int{
+		SpanExpandingEvaluate: 1,
+		SpanResolvePrincipals: 1,
+		SpanEvaluate:          2,
+		SpanListStatements:    2,
+	}, counts)
+	for _, span := range tracer.Spans() {
+		assert.Equal(t, root.TraceID, span.TraceID, "%s belongs to the expanding evaluator's trace", span.Name)
+		if span.Name == SpanResolvePrincipals || span.Name == SpanEvaluate {
+			assert.Equal(t, root.SpanID, span.ParentSpanID)
+		}
+	}
+}
+
+func TestRemoteAuthorizer_TraceParent(t *testing.T) {
+	var traceParent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceParent = r.Header.Get("traceparent")
+		w.Write([]byte(`{"effect":"allow"}`))
+	}))
+	defer server.Close()
+
+	tracer := NewInMemoryTracer()
+	ctx, parent := tracer.Start(t.Context(), "request")
+	authorizer := NewBetandbeatRemoteAuthorizer(server.URL, func() (string, error) { return "token", nil }, WithTracer(tracer))
+	_, err := authorizer.Authorize(ctx, Request{Principal: "users/mark", Action: "read", Resource: "doc"})
+	require.NoError(t, err)
+	parent.End()
+
+	spans := spansByName(tracer.Spans())
+	span := spans[SpanRemoteAuthorize]
+	assert.Equal(t, spans["request"].SpanID, span.ParentSpanID)
+	assert.Equal(t, "00-"+span.TraceID+"-"+span.SpanID+"-01", traceParent)
+	assert.Equal(t, "allow", span.Attributes["authz.effect"])
+}
+
+func TestRemoteAuthorizer_NoTracer(t *testing.T) {
+	var traceParent []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceParent = r.Header.Values("traceparent")
+		w.Write([]byte(`{"effect":"allow"}`))
+	}))
+	defer server.Close()
+
+	authorizer := NewBetandbeatRemoteAuthorizer(server.URL, func() (string, error) { return "token", nil })
+	_, err := authorizer.Authorize(t.Context(), Request{Principal: "users/mark"})
+	require.NoError(t, err)
+	assert.Empty(t, traceParent)
+}
@@ -1,8 +1,11 @@
 package authorization
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/expr-lang/expr"
 )
 
@@ -20,6 +23,41 @@ type Statement struct {
 	UpdatedAt   time.Time   `json:"updatedAt"`
 	CreatedBy   string      `json:"createdBy"`
 	UpdatedBy   string      `json:"updatedBy"`
+	// Revision is assigned by the storage on every write and serves as the
+	// statement's ETag for conditional writes.
+	Revision uint64 `json:"revision"`
+}
+
+// Validate checks that the statement is well formed: it has an ID and a known
+// effect, its patterns are valid globs and its conditions compile.
+func (s Statement) Validate() error {
+	if s.ID == "" {
+		return errors.New("statement ID cannot be empty")
+	}
+	if s.Effect != EffectAllow && s.Effect != EffectDeny {
+		return fmt.Errorf("statement %q has invalid effect %q", s.ID, s.Effect)
+	}
+	for _, p := range s.Principals {
+		if !doublestar.ValidatePattern(string(p)) {
+			return fmt.Errorf("statement %q has invalid principal pattern %q", s.ID, p)
+		}
+	}
+	for _, a := range s.Actions {
+		if !doublestar.ValidatePattern(string(a)) {
+			return fmt.Errorf("statement %q has invalid action pattern %q", s.ID, a)
+		}
+	}
+	for _, r := range s.Resources {
+		if !doublestar.ValidatePattern(string(r)) {
+			return fmt.Errorf("statement %q has invalid resource pattern %q", s.ID, r)
+		}
+	}
+	for _, c := range s.Conditions {
+		if _, err := expr.Compile(c.Expression); err != nil {
+			return fmt.Errorf("statement %q has invalid condition %q: %w", s.ID, c.Name, err)
+		}
+	}
+	return nil
 }
 
 type Effect string
@@ -70,6 +108,20 @@ type Context struct {
 		IP        string    `json:"ip"`
 		UserAgent string    `json:"user_agent"`
 	}
+	// TLS describes the connection the request was made over, if it used
+	// TLS, see ContextFromHTTPRequest.
+	TLS TLSInfo `json:"tls,omitzero"`
+}
+
+// TLSInfo describes a TLS connection.
+type TLSInfo struct {
+	// Version is the TLS version, such as "TLS 1.3".
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipher_suite"`
+	ServerName  string `json:"server_name"`
+	// ClientSubject is the subject of the client certificate, if one was
+	// presented.
+	ClientSubject string `json:"client_subject,omitempty"`
 }
 
 type Storage interface {
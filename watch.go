@@ -0,0 +1,47 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrRevisionCompacted is returned by Watch when the requested revision is
+// older than the change history retained by the storage.
+var ErrRevisionCompacted = errors.New("revision has been compacted")
+
+type ChangeType string
+
+const (
+	ChangePut    ChangeType = "put"
+	ChangeDelete ChangeType = "delete"
+)
+
+// ChangeEvent describes a single statement change. Revisions are assigned by
+// the storage and increase monotonically with every write.
+type ChangeEvent struct {
+	Revision    uint64     `json:"revision"`
+	Type        ChangeType `json:"type"`
+	StatementID string     `json:"statementId"`
+	// Statement is the new state of the statement, nil for deletes.
+	Statement *Statement `json:"statement,omitempty"`
+	// Actor is the WriteOptions.Actor of the write, if any.
+	Actor string    `json:"actor,omitempty"`
+	At    time.Time `json:"at"`
+}
+
+// StatementWatcher is implemented by storages that can stream their changes,
+// letting caches and replicas invalidate precisely instead of polling.
+//
+// To build a consistent replica, read Revision, load the statements, then Watch
+// from that revision: changes made while loading are replayed and applying
+// them again is idempotent.
+type StatementWatcher interface {
+	// Revision returns the revision of the most recent change, 0 if none.
+	Revision() uint64
+	// Watch streams, in revision order, every change after fromRevision until
+	// ctx is done. The channel is closed when ctx is done or when the watcher
+	// falls so far behind that unseen changes were compacted; in the latter
+	// case resume from the last received revision.
+	Watch(ctx context.Context, fromRevision uint64) (<-chan ChangeEvent, error)
+}
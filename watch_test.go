@@ -0,0 +1,87 @@
+package authorization
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryStorage_Watch(t *testing.T) {
+	storage := NewInMemoryStorage()
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	events, err := storage.Watch(ctx, storage.Revision())
+	require.NoError(t, err)
+
+	require.NoError(t, storage.SaveStatement(Statement{ID: "a", Effect: EffectAllow}))
+	require.NoError(t, storage.SaveStatement(Statement{ID: "b", Effect: EffectDeny}))
+	require.NoError(t, storage.DeleteStatement("a"))
+
+	got := receiveEvents(t, events, 3)
+	assert.Equal(t, []uint64{1, 2, 3}, []uint64{got[0].Revision, got[1].Revision, got[2].Revision})
+	assert.Equal(t, ChangePut, got[0].Type)
+	assert.Equal(t, "a", got[0].StatementID)
+	require.NotNil(t, got[1].Statement)
+	assert.Equal(t, EffectDeny, got[1].Statement.Effect)
+	assert.Equal(t, ChangeDelete, got[2].Type)
+	assert.Equal(t, "a", got[2].StatementID)
+	assert.Nil(t, got[2].Statement)
+	assert.Equal(t, uint64(3), storage.Revision())
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok, "channel should be closed after cancellation")
+	case <-time.After(time.Second):
+		t.Fatal("channel was not closed after cancellation")
+	}
+}
+
+func TestInMemoryStorage_WatchResume(t *testing.T) {
+	storage := NewInMemoryStorage()
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, storage.SaveStatement(Statement{ID: id, Effect: EffectAllow}))
+	}
+
+	events, err := storage.Watch(t.Context(), 1)
+	require.NoError(t, err)
+	got := receiveEvents(t, events, 2)
+	assert.Equal(t, "b", got[0].StatementID)
+	assert.Equal(t, "c", got[1].StatementID)
+
+	require.NoError(t, storage.DeleteStatement("b"))
+	got = receiveEvents(t, events, 1)
+	assert.Equal(t, uint64(4), got[0].Revision)
+}
+
+func TestInMemoryStorage_WatchCompacted(t *testing.T) {
+	storage := NewInMemoryStorage()
+	for range inMemoryChangeHistory + 5 {
+		require.NoError(t, storage.SaveStatement(Statement{ID: "a", Effect: EffectAllow}))
+	}
+
+	_, err := storage.Watch(t.Context(), 0)
+	assert.ErrorIs(t, err, ErrRevisionCompacted)
+
+	_, err = storage.Watch(t.Context(), 5)
+	assert.NoError(t, err, "the oldest retained change should still be watchable")
+}
+
+func receiveEvents(t *testing.T, events <-chan ChangeEvent, n int) []ChangeEvent {
+	t.Helper()
+	var got []ChangeEvent
+	for len(got) < n {
+		select {
+		case event, ok := <-events:
+			require.True(t, ok, "channel closed early")
+			got = append(got, event)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out after %d of %d events", len(got), n)
+		}
+	}
+	return got
+}
@@ -0,0 +1,170 @@
+package authorization
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// MemberResolver is implemented by principal resolvers that can resolve in
+// reverse, for WhoCan.
+type MemberResolver interface {
+	// ResolveMembers returns the principals that ResolvePrincipals expands
+	// to include principal, such as the users holding a role.
+	ResolveMembers(principal Principal) ([]Principal, error)
+}
+
+// AccessRule is a statement that grants or denies a principal access.
+type AccessRule struct {
+	StatementID string `json:"statementId"`
+	// Principal is the principal the statement names, such as the role the
+	// access is inherited from.
+	Principal Principal `json:"principal"`
+	// Conditions are evaluated per request and are not resolved here.
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// PrincipalAccess is a principal found by WhoCan.
+type PrincipalAccess struct {
+	// Principal may be a pattern, such as "users/*", when a statement grants
+	// access to a pattern.
+	Principal Principal `json:"principal"`
+	// Grants are the allow statements granting the access.
+	Grants []AccessRule `json:"grants"`
+	// Denies are deny statements that may revoke the access: those with
+	// conditions, and for a pattern, those denying some of the principals it
+	// matches.
+	Denies []AccessRule `json:"denies,omitempty"`
+	// Conditional is false when a grant has no conditions and no deny may
+	// revoke the access, so the principal is allowed whatever the request
+	// context.
+	Conditional bool `json:"conditional"`
+}
+
+// WhoCan returns the principals that may perform action on resource, ordered
+// by principal. It scans every statement, so it is meant for access reviews
+// rather than the request path.
+//
+// Principals inheriting access, such as the members of a role granted
+// access, are found when resolver implements MemberResolver; resolver may be
+// nil. Principals denied by a deny statement without conditions are left
+// out, taking into account the denies of the principals they resolve to, as
+// ExpandingEvaluator does.
+func WhoCan(store StatementLister, resolver PrincipalResolver, action ActionID, resource Resource) ([]PrincipalAccess, error) {
+	var allows, denies []Statement
+	filter := StatementFilter{Limit: maxStatementListLimit}
+	for {
+		page, err := store.List(filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list statements: %w", err)
+		}
+		for _, stmt := range page.Statements {
+			if !actionMatches(stmt.Actions, action) || !resourceMatches(stmt.Resources, resource) {
+				continue
+			}
+			if stmt.Effect == EffectDeny {
+				denies = append(denies, stmt)
+			} else {
+				allows = append(allows, stmt)
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+
+	// Collect the grants of every principal named by an allow statement and
+	// of their members.
+	grants := make(map[Principal][]AccessRule)
+	members, _ := resolver.(MemberResolver)
+	for _, stmt := range allows {
+		for _, principal := range stmt.Principals {
+			rule := AccessRule{StatementID: stmt.ID, Principal: principal, Conditions: stmt.Conditions}
+			grants[principal] = append(grants[principal], rule)
+			if members == nil || isPrincipalPattern(principal) {
+				continue
+			}
+			inheriting, err := members.ResolveMembers(principal)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve members of %s: %w", principal, err)
+			}
+			for _, member := range inheriting {
+				if member != principal {
+					grants[member] = append(grants[member], rule)
+				}
+			}
+		}
+	}
+
+	var result []PrincipalAccess
+	for principal, rules := range grants {
+		access := PrincipalAccess{Principal: principal, Grants: rules}
+		denied, err := applyDenies(&access, resolver, denies)
+		if err != nil {
+			return nil, err
+		}
+		if denied {
+			continue
+		}
+		access.Conditional = len(access.Denies) > 0 || !slices.ContainsFunc(rules, func(rule AccessRule) bool {
+			return len(rule.Conditions) == 0
+		})
+		result = append(result, access)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Principal < result[j].Principal
+	})
+	return result, nil
+}
+
+// applyDenies records the denies that may revoke access in access.Denies and
+// reports whether one always does.
+func applyDenies(access *PrincipalAccess, resolver PrincipalResolver, denies []Statement) (bool, error) {
+	if isPrincipalPattern(access.Principal) {
+		for _, stmt := range denies {
+			for _, denied := range stmt.Principals {
+				// A deny matching the pattern itself covers every principal
+				// it matches; one matching only some of them is an exception.
+				if patternCovers(denied, access.Principal) {
+					if len(stmt.Conditions) == 0 {
+						return true, nil
+					}
+				} else if !patternCovers(access.Principal, denied) {
+					continue
+				}
+				access.Denies = append(access.Denies, AccessRule{StatementID: stmt.ID, Principal: denied, Conditions: stmt.Conditions})
+			}
+		}
+		return false, nil
+	}
+
+	principals := []Principal{access.Principal}
+	if resolver != nil {
+		resolved, err := resolver.ResolvePrincipals(access.Principal)
+		if err != nil {
+			return false, fmt.Errorf("failed to resolve principals of %s: %w", access.Principal, err)
+		}
+		principals = resolved
+	}
+	for _, stmt := range denies {
+		for _, principal := range principals {
+			if !principalMatches(stmt.Principals, principal) {
+				continue
+			}
+			if len(stmt.Conditions) == 0 {
+				return true, nil
+			}
+			access.Denies = append(access.Denies, AccessRule{StatementID: stmt.ID, Principal: principal, Conditions: stmt.Conditions})
+			break
+		}
+	}
+	return false, nil
+}
+
+// isPrincipalPattern reports whether a principal named by a statement matches
+// more than one principal.
+func isPrincipalPattern(principal Principal) bool {
+	return strings.ContainsAny(string(principal), "*?[{")
+}
@@ -0,0 +1,102 @@
+package authorization
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var whoCanTestStatements = []Statement{
+	{ID: "admins", Effect: EffectAllow, Principals: []Principal{"roles/admin"}, Actions: []ActionID{"iam:*"}, Resources: []Resource{"users/*"}},
+	{ID: "self", Effect: EffectAllow, Principals: []Principal{"users/johndoe"}, Actions: []ActionID{"iam:DeleteUser"}, Resources: []Resource{"users/johndoe"}},
+	{ID: "support", Effect: EffectAllow, Principals: []Principal{"roles/support"}, Actions: []ActionID{"iam:DeleteUser"}, Resources: []Resource{"*"},
+		Conditions: []Condition{{Name: "office", Expression: `context.Request.IP startsWith "10."`}}},
+	{ID: "services", Effect: EffectAllow, Principals: []Principal{"services/*"}, Actions: []ActionID{"iam:DeleteUser"}, Resources: []Resource{"users/*"}},
+	{ID: "readers", Effect: EffectAllow, Principals: []Principal{"users/reader"}, Actions: []ActionID{"iam:GetUser"}, Resources: []Resource{"users/*"}},
+	{ID: "no-mallory", Effect: EffectDeny, Principals: []Principal{"users/mallory"}, Actions: []ActionID{"*"}, Resources: []Resource{"*"}},
+	{ID: "no-intern-deletes", Effect: EffectDeny, Principals: []Principal{"roles/intern"}, Actions: []ActionID{"iam:DeleteUser"}, Resources: []Resource{"*"}},
+	{ID: "no-legacy", Effect: EffectDeny, Principals: []Principal{"services/legacy"}, Actions: []ActionID{"*"}, Resources: []Resource{"*"}},
+	{ID: "night", Effect: EffectDeny, Principals: []Principal{"users/alice"}, Actions: []ActionID{"*"}, Resources: []Resource{"*"},
+		Conditions: []Condition{{Name: "night", Expression: `context.Request.At.Hour() < 6`}}},
+}
+
+func TestWhoCan(t *testing.T) {
+	storage := newTestStorage(t, whoCanTestStatements...)
+	resolver := NewInMemoryPrincipalResolver()
+	resolver.AddRoleMapping("users/alice", []Principal{"roles/admin"})
+	resolver.AddRoleMapping("users/mallory", []Principal{"roles/admin"})
+	resolver.AddRoleMapping("users/trainee", []Principal{"roles/admin", "roles/intern"})
+	resolver.AddRoleMapping("users/bob", []Principal{"roles/support"})
+
+	access, err := WhoCan(storage, resolver, "iam:DeleteUser", "users/johndoe")
+	require.NoError(t, err)
+
+	byPrincipal := make(map[Principal]PrincipalAccess)
+	var principals []Principal
+	for _, a := range access {
+		byPrincipal[a.Principal] = a
+		principals = append(principals, a.Principal)
+	}
+	assert.Equal(t, []Principal{"roles/admin", "roles/support", "services/*", "users/alice", "users/bob", "users/johndoe"}, principals,
+		"mallory and trainee are denied, reader lacks the action")
+
+	assert.False(t, byPrincipal["users/johndoe"].Conditional)
+	assert.Equal(t, []AccessRule{{StatementID: "self", Principal: "users/johndoe"}}, byPrincipal["users/johndoe"].Grants)
+
+	alice := byPrincipal["users/alice"]
+	assert.Equal(t, []AccessRule{{StatementID: "admins", Principal: "roles/admin"}}, alice.Grants, "inherited from the role")
+	require.Len(t, alice.Denies, 1)
+	assert.Equal(t, "night", alice.Denies[0].StatementID)
+	assert.True(t, alice.Conditional, "a conditional deny may revoke the access")
+
+	bob := byPrincipal["users/bob"]
+	assert.True(t, bob.Conditional)
+	require.Len(t, bob.Grants, 1)
+	assert.Equal(t, "office", bob.Grants[0].Conditions[0].Name)
+
+	// The answers agree with the evaluator.
+	evaluator := NewExpandingEvaluator(NewEvaluator(storage), resolver)
+	for principal, allowed := range map[Principal]bool{"users/johndoe": true, "users/mallory": false, "users/trainee": false, "users/reader": false} {
+		resp, err := evaluator.Evaluate(Request{Principal: principal, Action: "iam:DeleteUser", Resource: "users/johndoe"})
+		require.NoError(t, err)
+		assert.Equal(t, allowed, resp.Allowed(), principal)
+	}
+
+	services := byPrincipal["services/*"]
+	assert.True(t, services.Conditional)
+	assert.Equal(t, []AccessRule{{StatementID: "no-legacy", Principal: "services/legacy"}}, services.Denies)
+}
+
+func TestWhoCan_WithoutResolver(t *testing.T) {
+	storage := newTestStorage(t, whoCanTestStatements...)
+	access, err := WhoCan(storage, nil, "iam:GetUser", "users/johndoe")
+	require.NoError(t, err)
+
+	var principals []Principal
+	for _, a := range access {
+		principals = append(principals, a.Principal)
+	}
+	assert.Equal(t, []Principal{"roles/admin", "users/reader"}, principals)
+
+	access, err = WhoCan(storage, nil, "iam:GetUser", "accounts/1")
+	require.NoError(t, err)
+	assert.Empty(t, access)
+}
+
+func TestWhoCan_ListerOnly(t *testing.T) {
+	lister := struct{ StatementLister }{newTestStorage(t, whoCanTestStatements...)}
+	access, err := WhoCan(lister, nil, "iam:GetUser", "users/johndoe")
+	require.NoError(t, err)
+	assert.Len(t, access, 2)
+}
+
+func TestWhoCan_PatternDenied(t *testing.T) {
+	storage := NewInMemoryStorage()
+	require.NoError(t, storage.SaveStatement(Statement{ID: "all", Effect: EffectAllow, Principals: []Principal{"users/*"}, Actions: []ActionID{"read"}, Resources: []Resource{"*"}}))
+	require.NoError(t, storage.SaveStatement(Statement{ID: "freeze", Effect: EffectDeny, Principals: []Principal{"**"}, Actions: []ActionID{"read"}, Resources: []Resource{"*"}}))
+
+	access, err := WhoCan(storage, nil, "read", "docs/1")
+	require.NoError(t, err)
+	assert.Empty(t, access)
+}